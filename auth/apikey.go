@@ -0,0 +1,132 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/CoverWhale/logr"
+)
+
+// DefaultAPIKeyHeader is the header API keys are read from
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// APIKey describes the owner of an API key
+type APIKey struct {
+	Name   string
+	Scopes []string
+}
+
+// APIKeyOption is a functional option to modify the APIKeyAuthenticator
+type APIKeyOption func(*APIKeyAuthenticator)
+
+// APIKeyAuthenticator authenticates requests with static or hashed API keys. Keys are only kept as SHA-256
+// hashes and are compared in constant time.
+type APIKeyAuthenticator struct {
+	header string
+	keys   map[[sha256.Size]byte]APIKey
+}
+
+// SetAPIKeyHeader sets the header the key is read from
+func SetAPIKeyHeader(h string) APIKeyOption {
+	return func(a *APIKeyAuthenticator) {
+		a.header = h
+	}
+}
+
+// WithStaticKey adds a plain text API key
+func WithStaticKey(key string, owner APIKey) APIKeyOption {
+	return func(a *APIKeyAuthenticator) {
+		a.keys[sha256.Sum256([]byte(key))] = owner
+	}
+}
+
+// WithHashedKey adds an API key by its hex encoded SHA-256 hash, as returned by HashAPIKey. Invalid hashes
+// are logged and not added.
+func WithHashedKey(hash string, owner APIKey) APIKeyOption {
+	return func(a *APIKeyAuthenticator) {
+		b, err := hex.DecodeString(strings.TrimPrefix(hash, "sha256:"))
+		if err == nil && len(b) != sha256.Size {
+			err = fmt.Errorf("expected %d bytes but got %d", sha256.Size, len(b))
+		}
+		if err != nil {
+			logr.Errorf("invalid hash for API key %s: %v", owner.Name, err)
+			return
+		}
+
+		var h [sha256.Size]byte
+		copy(h[:], b)
+		a.keys[h] = owner
+	}
+}
+
+// HashAPIKey returns the hex encoded SHA-256 hash of the key for use with WithHashedKey
+func HashAPIKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+// NewAPIKeyAuthenticator returns an authenticator for the keys
+func NewAPIKeyAuthenticator(opts ...APIKeyOption) *APIKeyAuthenticator {
+	a := &APIKeyAuthenticator{
+		header: DefaultAPIKeyHeader,
+		keys:   make(map[[sha256.Size]byte]APIKey),
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+// Authenticate fulfills the Authenticator interface
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	return a.Validate(r.Header.Get(a.header))
+}
+
+// Validate returns the principal for the key
+func (a *APIKeyAuthenticator) Validate(key string) (*Principal, error) {
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	hash := sha256.Sum256([]byte(key))
+
+	var owner APIKey
+	found := false
+	// compare against every key so the time taken doesn't depend on which key matched
+	for k, v := range a.keys {
+		if subtle.ConstantTimeCompare(k[:], hash[:]) == 1 {
+			owner = v
+			found = true
+		}
+	}
+
+	if !found {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Principal{
+		Subject: owner.Name,
+		Method:  MethodAPIKey,
+		Scopes:  owner.Scopes,
+	}, nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package auth authenticates HTTP and NATS micro requests with JWTs, API keys, and mTLS client certificates
+// and stores the authenticated Principal for handlers and the authorization middlewares.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/CoverWhale/logr"
+)
+
+var (
+	// ErrNoCredentials is returned by an Authenticator when the request doesn't have its credentials so
+	// the next Authenticator can be tried
+	ErrNoCredentials = fmt.Errorf("no credentials")
+	// ErrInvalidCredentials is returned when credentials are present but aren't valid
+	ErrInvalidCredentials = fmt.Errorf("invalid credentials")
+)
+
+// Method is how a principal was authenticated
+type Method string
+
+const (
+	MethodJWT    Method = "jwt"
+	MethodAPIKey Method = "api_key"
+	MethodMTLS   Method = "mtls"
+	MethodNATS   Method = "nats"
+)
+
+// Principal is an authenticated caller
+type Principal struct {
+	Subject string         `json:"sub"`
+	Method  Method         `json:"method"`
+	Issuer  string         `json:"iss,omitempty"`
+	Scopes  []string       `json:"scopes,omitempty"`
+	Claims  map[string]any `json:"claims,omitempty"`
+}
+
+// HasScope reports whether the principal has the scope
+func (p *Principal) HasScope(scope string) bool {
+	for _, v := range p.Scopes {
+		if v == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of the context with the principal
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal stored by the middleware
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// Authenticator authenticates an HTTP request. ErrNoCredentials is returned if the request doesn't have
+// the credentials the Authenticator uses.
+type Authenticator interface {
+	Authenticate(*http.Request) (*Principal, error)
+}
+
+// AuthenticatorFunc allows a plain function to be used as an Authenticator
+type AuthenticatorFunc func(*http.Request) (*Principal, error)
+
+// Authenticate fulfills the Authenticator interface
+func (a AuthenticatorFunc) Authenticate(r *http.Request) (*Principal, error) {
+	return a(r)
+}
+
+// Middleware authenticates requests with the first Authenticator that finds credentials and stores the
+// principal in the request context. Requests without valid credentials get a 401.
+func Middleware(authenticators ...Authenticator) func(http.Handler) http.Handler {
+	return middleware(true, authenticators)
+}
+
+// Optional is like Middleware but lets requests without credentials through without a principal.
+// Requests with invalid credentials still get a 401.
+func Optional(authenticators ...Authenticator) func(http.Handler) http.Handler {
+	return middleware(false, authenticators)
+}
+
+func middleware(required bool, authenticators []Authenticator) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, err := authenticate(r, authenticators)
+			switch {
+			case errors.Is(err, ErrNoCredentials) && !required:
+				h.ServeHTTP(w, r)
+				return
+			case err != nil:
+				logr.Debugf("authentication failed: %v", err)
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			h.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+func authenticate(r *http.Request, authenticators []Authenticator) (*Principal, error) {
+	for _, a := range authenticators {
+		p, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return p, nil
+	}
+
+	return nil, ErrNoCredentials
+}
@@ -0,0 +1,412 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	cwerrors "github.com/CoverWhale/coverwhale-go/errors"
+	"github.com/CoverWhale/logr"
+	"github.com/nats-io/nats.go/micro"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func rsaJWK(kid string, k *rsa.PublicKey) map[string]string {
+	return map[string]string{"kid": kid, "kty": "RSA", "n": b64(k.N.Bytes()), "e": b64(big.NewInt(int64(k.E)).Bytes())}
+}
+
+func ecJWK(kid string, k *ecdsa.PublicKey) map[string]string {
+	return map[string]string{"kid": kid, "kty": "EC", "crv": "P-256", "x": b64(k.X.FillBytes(make([]byte, 32))), "y": b64(k.Y.FillBytes(make([]byte, 32)))}
+}
+
+func writeJWKS(t *testing.T, path string, keys ...map[string]string) {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest[:])
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + b64(sig)
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, rsaJWK("rsa", &rsaKey.PublicKey), ecJWK("ec", &ecKey.PublicKey))
+
+	keys, err := NewKeySet(context.Background(), FileLoader(path), SetMinRefreshInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := NewJWTAuthenticator(keys, SetIssuer("https://issuer"), SetAudience("api"))
+
+	valid := func() map[string]any {
+		return map[string]any{"sub": "user", "iss": "https://issuer", "aud": []string{"api"}, "exp": time.Now().Add(time.Hour).Unix(), "scope": "read write"}
+	}
+	with := func(k string, v any) map[string]any {
+		c := valid()
+		c[k] = v
+		return c
+	}
+	without := func(k string) map[string]any {
+		c := valid()
+		delete(c, k)
+		return c
+	}
+
+	tt := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{name: "rsa", token: sign(t, "RS256", "rsa", rsaKey, valid())},
+		{name: "ec", token: sign(t, "ES256", "ec", ecKey, valid())},
+		{name: "expired", token: sign(t, "RS256", "rsa", rsaKey, with("exp", time.Now().Add(-time.Hour).Unix())), err: ErrInvalidCredentials},
+		{name: "no expiry", token: sign(t, "RS256", "rsa", rsaKey, without("exp")), err: ErrInvalidCredentials},
+		{name: "wrong audience", token: sign(t, "RS256", "rsa", rsaKey, with("aud", "other")), err: ErrInvalidCredentials},
+		{name: "wrong issuer", token: sign(t, "RS256", "rsa", rsaKey, with("iss", "other")), err: ErrInvalidCredentials},
+		{name: "wrong key", token: sign(t, "RS256", "rsa", otherKey, valid()), err: ErrInvalidCredentials},
+		{name: "unknown key", token: sign(t, "RS256", "other", otherKey, valid()), err: ErrInvalidCredentials},
+		{name: "alg mismatch", token: sign(t, "ES256", "rsa", ecKey, valid()), err: ErrInvalidCredentials},
+		{name: "malformed", token: "abc", err: ErrInvalidCredentials},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			p, err := j.Validate(context.Background(), v.token)
+			if v.err != nil {
+				if !errors.Is(err, v.err) {
+					t.Fatalf("expected error %v but got %v", v.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if p.Subject != "user" || p.Method != MethodJWT || !p.HasScope("write") {
+				t.Errorf("unexpected principal %+v", p)
+			}
+		})
+	}
+
+	t.Run("allow no expiry", func(t *testing.T) {
+		j := NewJWTAuthenticator(keys, SetAllowNoExpiry())
+		if _, err := j.Validate(context.Background(), sign(t, "RS256", "rsa", rsaKey, without("exp"))); err != nil {
+			t.Errorf("expected token without exp to be allowed: %v", err)
+		}
+	})
+
+	t.Run("rotation", func(t *testing.T) {
+		writeJWKS(t, path, rsaJWK("rsa", &rsaKey.PublicKey), rsaJWK("other", &otherKey.PublicKey))
+
+		if _, err := j.Validate(context.Background(), sign(t, "RS256", "other", otherKey, valid())); err != nil {
+			t.Errorf("expected rotated key to be loaded: %v", err)
+		}
+	})
+}
+
+func TestKeySetRefresh(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{rsaJWK("rsa", &rsaKey.PublicKey)}})
+
+	var mu sync.Mutex
+	var calls int
+	fail := false
+	release := make(chan struct{})
+	loader := func(ctx context.Context) ([]byte, error) {
+		mu.Lock()
+		calls++
+		n, failing := calls, fail
+		mu.Unlock()
+
+		if n > 1 {
+			<-release
+		}
+		if failing {
+			return nil, fmt.Errorf("unavailable")
+		}
+		return jwks, nil
+	}
+
+	keys, err := NewKeySet(context.Background(), loader, SetMinRefreshInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("concurrent refreshes", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				keys.Key(context.Background(), "unknown")
+			}()
+		}
+
+		// let the goroutines reach the loader before it returns
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		mu.Lock()
+		defer mu.Unlock()
+		if calls > 2 {
+			t.Errorf("expected one reload but the loader was called %d times", calls-1)
+		}
+	})
+
+	t.Run("failed refresh", func(t *testing.T) {
+		mu.Lock()
+		calls, fail = 0, true
+		mu.Unlock()
+		keys.minRefresh = time.Minute
+
+		keys.Refresh(context.Background())
+		for i := 0; i < 5; i++ {
+			if _, err := keys.Key(context.Background(), "unknown"); !errors.Is(err, ErrKeyNotFound) {
+				t.Errorf("expected ErrKeyNotFound but got %v", err)
+			}
+		}
+
+		if calls != 1 {
+			t.Errorf("expected failed reload to be rate limited but the loader was called %d times", calls)
+		}
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	keys := NewAPIKeyAuthenticator(
+		WithStaticKey("static", APIKey{Name: "static"}),
+		WithHashedKey(HashAPIKey("hashed"), APIKey{Name: "hashed", Scopes: []string{"admin"}}),
+	)
+
+	tt := []struct {
+		name     string
+		required bool
+		key      string
+		status   int
+		subject  string
+	}{
+		{name: "static key", required: true, key: "static", status: http.StatusOK, subject: "static"},
+		{name: "hashed key", required: true, key: "hashed", status: http.StatusOK, subject: "hashed"},
+		{name: "invalid key", required: true, key: "wrong", status: http.StatusUnauthorized},
+		{name: "missing key", required: true, status: http.StatusUnauthorized},
+		{name: "optional missing key", status: http.StatusOK},
+		{name: "optional invalid key", key: "wrong", status: http.StatusUnauthorized},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			var subject string
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if p, ok := PrincipalFromContext(r.Context()); ok {
+					subject = p.Subject
+				}
+			})
+
+			mw := Optional(keys)
+			if v.required {
+				mw = Middleware(keys)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if v.key != "" {
+				req.Header.Set(DefaultAPIKeyHeader, v.key)
+			}
+			w := httptest.NewRecorder()
+			mw(h).ServeHTTP(w, req)
+
+			if w.Code != v.status {
+				t.Errorf("expected status %d but got %d", v.status, w.Code)
+			}
+			if subject != v.subject {
+				t.Errorf("expected subject %q but got %q", v.subject, subject)
+			}
+		})
+	}
+}
+
+func TestMTLSAuthenticator(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://coverwhale/service")
+
+	tt := []struct {
+		name    string
+		state   *tls.ConnectionState
+		subject string
+		err     error
+	}{
+		{name: "no tls", err: ErrNoCredentials},
+		{name: "unverified", state: &tls.ConnectionState{}, err: ErrNoCredentials},
+		{name: "uri san", state: certState(&x509.Certificate{URIs: []*url.URL{spiffe}, Subject: pkix.Name{CommonName: "cn"}}), subject: "spiffe://coverwhale/service"},
+		{name: "common name", state: certState(&x509.Certificate{Subject: pkix.Name{CommonName: "cn"}}), subject: "cn"},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.TLS = v.state
+
+			p, err := NewMTLSAuthenticator().Authenticate(req)
+			if !errors.Is(err, v.err) {
+				t.Fatalf("expected error %v but got %v", v.err, err)
+			}
+			if err == nil && p.Subject != v.subject {
+				t.Errorf("expected subject %q but got %q", v.subject, p.Subject)
+			}
+		})
+	}
+}
+
+func certState(cert *x509.Certificate) *tls.ConnectionState {
+	cert.SerialNumber = big.NewInt(1)
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+}
+
+type testRequest struct {
+	micro.Request
+	subject string
+	headers micro.Headers
+}
+
+func (t testRequest) Subject() string {
+	return t.subject
+}
+
+func (t testRequest) Headers() micro.Headers {
+	return t.headers
+}
+
+func TestNATSHandler(t *testing.T) {
+	keys := NewAPIKeyAuthenticator(WithStaticKey("static", APIKey{Name: "static"}))
+
+	tt := []struct {
+		name       string
+		msgSubject string
+		headers    micro.Headers
+		subject    string
+		err        bool
+	}{
+		{name: "request info", msgSubject: "quotes.get", headers: micro.Headers{NATSRequestInfoHeader: {`{"acc":"APP","user":"UABC","name":"client"}`}}, subject: "UABC"},
+		{name: "request info on untrusted subject", msgSubject: "internal.quotes.get", headers: micro.Headers{NATSRequestInfoHeader: {`{"acc":"APP","user":"UABC","name":"client"}`}}, err: true},
+		{name: "api key", headers: micro.Headers{DefaultAPIKeyHeader: {"static"}}, subject: "static"},
+		{name: "invalid api key", headers: micro.Headers{DefaultAPIKeyHeader: {"wrong"}}, err: true},
+		{name: "missing credentials", headers: micro.Headers{}, err: true},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			var subject string
+			h := NATSHandler(func(l *logr.Logger, r micro.Request) error {
+				if p, ok := NATSPrincipal(r); ok {
+					subject = p.Subject
+				}
+				return nil
+			}, NATSUser("quotes.>"), keys)
+
+			err := h(logr.NewLogger(), testRequest{subject: v.msgSubject, headers: v.headers})
+			if v.err {
+				var ce cwerrors.ClientError
+				if !errors.As(err, &ce) || ce.Status != http.StatusUnauthorized {
+					t.Fatalf("expected unauthorized client error but got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if subject != v.subject {
+				t.Errorf("expected subject %q but got %q", v.subject, subject)
+			}
+		})
+	}
+}
+
+func TestSubjectMatches(t *testing.T) {
+	tt := []struct {
+		pattern string
+		subject string
+		matches bool
+	}{
+		{pattern: "quotes.get", subject: "quotes.get", matches: true},
+		{pattern: "quotes.*", subject: "quotes.get", matches: true},
+		{pattern: "quotes.*", subject: "quotes.get.1", matches: false},
+		{pattern: "quotes.>", subject: "quotes.get.1", matches: true},
+		{pattern: "quotes.>", subject: "quotes", matches: false},
+		{pattern: "quotes.get", subject: "internal.quotes.get", matches: false},
+	}
+
+	for _, v := range tt {
+		t.Run(v.pattern+" "+v.subject, func(t *testing.T) {
+			if SubjectMatches(v.pattern, v.subject) != v.matches {
+				t.Errorf("expected %t for %s and %s", v.matches, v.pattern, v.subject)
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrKeyNotFound = fmt.Errorf("signing key not found")
+)
+
+// JWKSLoader loads a JSON Web Key Set
+type JWKSLoader func(ctx context.Context) ([]byte, error)
+
+// FileLoader loads a JWKS from a local file
+func FileLoader(path string) JWKSLoader {
+	return func(ctx context.Context) ([]byte, error) {
+		return os.ReadFile(path)
+	}
+}
+
+// URLLoader loads a JWKS from a URL. The default HTTP client is used if client is nil.
+func URLLoader(url string, client *http.Client) JWKSLoader {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status fetching JWKS from %s: %d", url, resp.StatusCode)
+		}
+
+		return io.ReadAll(resp.Body)
+	}
+}
+
+// DiscoverJWKS returns the jwks_uri from the OIDC discovery document of the issuer
+func DiscoverJWKS(ctx context.Context, issuer string, client *http.Client) (string, error) {
+	data, err := URLLoader(strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", client)(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var doc struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return "", fmt.Errorf("error decoding discovery document: %w", err)
+	}
+
+	if doc.JWKSURI == "" {
+		return "", fmt.Errorf("discovery document for %s has no jwks_uri", issuer)
+	}
+
+	return doc.JWKSURI, nil
+}
+
+// KeySetOption is a functional option to modify the KeySet
+type KeySetOption func(*KeySet)
+
+// KeySet holds the public keys from a JWKS. Keys are reloaded after the refresh interval, and when a token
+// is signed by an unknown key so rotated keys are picked up without a restart. Concurrent reloads share one
+// call to the loader.
+type KeySet struct {
+	mu       sync.RWMutex
+	keys     map[string]crypto.PublicKey
+	loadedAt time.Time
+	// attemptedAt is the last reload, successful or not, so a failing JWKS isn't loaded on every request
+	attemptedAt time.Time
+	inflight    *refreshCall
+
+	loader     JWKSLoader
+	refresh    time.Duration
+	minRefresh time.Duration
+}
+
+// SetRefreshInterval sets how often keys are reloaded. The default is 1 hour.
+func SetRefreshInterval(d time.Duration) KeySetOption {
+	return func(k *KeySet) {
+		k.refresh = d
+	}
+}
+
+// SetMinRefreshInterval sets the minimum time between reloads, including failed ones, caused by unknown or stale
+// keys. The default is 1 minute.
+func SetMinRefreshInterval(d time.Duration) KeySetOption {
+	return func(k *KeySet) {
+		k.minRefresh = d
+	}
+}
+
+// NewKeySet loads the keys from the loader
+func NewKeySet(ctx context.Context, loader JWKSLoader, opts ...KeySetOption) (*KeySet, error) {
+	k := &KeySet{
+		loader:     loader,
+		refresh:    time.Hour,
+		minRefresh: time.Minute,
+	}
+
+	for _, opt := range opts {
+		opt(k)
+	}
+
+	if err := k.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// refreshCall is a reload in progress that concurrent callers wait for
+type refreshCall struct {
+	done chan struct{}
+	err  error
+}
+
+// Refresh reloads the keys. If a reload is already in progress Refresh waits for it instead of calling the
+// loader again.
+func (k *KeySet) Refresh(ctx context.Context) error {
+	k.mu.Lock()
+	if c := k.inflight; c != nil {
+		k.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	c := &refreshCall{done: make(chan struct{})}
+	k.inflight = c
+	k.attemptedAt = time.Now()
+	k.mu.Unlock()
+
+	c.err = k.load(ctx)
+
+	k.mu.Lock()
+	k.inflight = nil
+	k.mu.Unlock()
+	close(c.done)
+
+	return c.err
+}
+
+func (k *KeySet) load(ctx context.Context) error {
+	data, err := k.loader(ctx)
+	if err != nil {
+		return fmt.Errorf("error loading JWKS: %w", err)
+	}
+
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys = keys
+	k.loadedAt = time.Now()
+
+	return nil
+}
+
+// Key returns the key for the key ID. An empty key ID is allowed when the set has a single key. Unknown and
+// stale keys reload the set at most once per min refresh interval.
+func (k *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	key, ok, loadedAt, attemptedAt := k.lookup(kid)
+
+	stale := time.Since(loadedAt) > k.refresh
+	if ok && !stale {
+		return key, nil
+	}
+
+	if time.Since(attemptedAt) > k.minRefresh {
+		if err := k.Refresh(ctx); err != nil {
+			if ok {
+				// keep using the known key if the JWKS can't be reloaded
+				return key, nil
+			}
+			return nil, err
+		}
+		key, ok, _, _ = k.lookup(kid)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, kid)
+	}
+
+	return key, nil
+}
+
+func (k *KeySet) lookup(kid string) (crypto.PublicKey, bool, time.Time, time.Time) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if kid == "" && len(k.keys) == 1 {
+		for _, v := range k.keys {
+			return v, true, k.loadedAt, k.attemptedAt
+		}
+	}
+
+	key, ok := k.keys[kid]
+	return key, ok, k.loadedAt, k.attemptedAt
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS returns the RSA, EC, and Ed25519 signing keys in the JWKS by key ID. Other keys are ignored.
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("error decoding JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, v := range set.Keys {
+		if v.Use != "" && v.Use != "sig" {
+			continue
+		}
+
+		key, err := v.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing key %q: %w", v.Kid, err)
+		}
+		if key != nil {
+			keys[v.Kid] = key
+		}
+	}
+
+	return keys, nil
+}
+
+func (j jwk) publicKey() (crypto.PublicKey, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeBigInt(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(j.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", j.Crv)
+		}
+		x, err := decodeBigInt(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", j.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", j.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, nil
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,320 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// JWTOption is a functional option to modify the JWTAuthenticator
+type JWTOption func(*JWTAuthenticator)
+
+// JWTAuthenticator validates bearer tokens signed by keys in a KeySet. RS, PS, ES, and EdDSA algorithms are
+// supported.
+type JWTAuthenticator struct {
+	keys      *KeySet
+	issuer    string
+	audiences []string
+	leeway    time.Duration
+	noExpiry  bool
+	now       func() time.Time
+}
+
+// SetIssuer requires the iss claim to match the issuer
+func SetIssuer(iss string) JWTOption {
+	return func(j *JWTAuthenticator) {
+		j.issuer = iss
+	}
+}
+
+// SetAudience requires the aud claim to contain one of the audiences
+func SetAudience(aud ...string) JWTOption {
+	return func(j *JWTAuthenticator) {
+		j.audiences = append(j.audiences, aud...)
+	}
+}
+
+// SetLeeway sets the allowed clock skew when checking exp and nbf. The default is 1 minute.
+func SetLeeway(d time.Duration) JWTOption {
+	return func(j *JWTAuthenticator) {
+		j.leeway = d
+	}
+}
+
+// SetAllowNoExpiry accepts tokens without an exp claim. By default they are rejected since they never expire.
+func SetAllowNoExpiry() JWTOption {
+	return func(j *JWTAuthenticator) {
+		j.noExpiry = true
+	}
+}
+
+// NewJWTAuthenticator returns an authenticator that validates tokens with the keys
+func NewJWTAuthenticator(keys *KeySet, opts ...JWTOption) *JWTAuthenticator {
+	j := &JWTAuthenticator{
+		keys:   keys,
+		leeway: time.Minute,
+		now:    time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(j)
+	}
+
+	return j
+}
+
+// Authenticate fulfills the Authenticator interface with the bearer token in the Authorization header
+func (j *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := BearerToken(r.Header.Get("Authorization"))
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	return j.Validate(r.Context(), token)
+}
+
+// BearerToken returns the token from an Authorization header value
+func BearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+
+	return strings.TrimSpace(token), true
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Validate verifies the token's signature and claims and returns the principal
+func (j *JWTAuthenticator) Validate(ctx context.Context, token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidCredentials)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	key, err := j.keys.Key(ctx, header.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	if err := verify(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	var claims map[string]any
+	dec := json.NewDecoder(base64.NewDecoder(base64.RawURLEncoding, strings.NewReader(parts[1])))
+	dec.UseNumber()
+	if err := dec.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	if err := j.checkClaims(claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	p := &Principal{
+		Method: MethodJWT,
+		Claims: claims,
+	}
+	p.Subject, _ = claims["sub"].(string)
+	p.Issuer, _ = claims["iss"].(string)
+	p.Scopes = scopes(claims)
+
+	return p, nil
+}
+
+func (j *JWTAuthenticator) checkClaims(claims map[string]any) error {
+	now := j.now()
+
+	exp, ok, err := numericDate(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if !ok && !j.noExpiry {
+		return fmt.Errorf("token has no expiry")
+	}
+	if ok && now.After(exp.Add(j.leeway)) {
+		return fmt.Errorf("token is expired")
+	}
+
+	nbf, ok, err := numericDate(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(j.leeway).Before(nbf) {
+		return fmt.Errorf("token is not valid yet")
+	}
+
+	if j.issuer != "" && claims["iss"] != j.issuer {
+		return fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+
+	if len(j.audiences) > 0 && !audienceMatches(claims["aud"], j.audiences) {
+		return fmt.Errorf("unexpected audience %v", claims["aud"])
+	}
+
+	return nil
+}
+
+func numericDate(claims map[string]any, name string) (time.Time, bool, error) {
+	v, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("invalid %s claim", name)
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid %s claim: %w", name, err)
+	}
+
+	return time.Unix(int64(f), 0), true, nil
+}
+
+func audienceMatches(aud any, audiences []string) bool {
+	var values []string
+	switch v := aud.(type) {
+	case string:
+		values = []string{v}
+	case []any:
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	for _, v := range values {
+		for _, a := range audiences {
+			if v == a {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// scopes reads the space separated scope claim or the scp list claim
+func scopes(claims map[string]any) []string {
+	if s, ok := claims["scope"].(string); ok {
+		return strings.Fields(s)
+	}
+
+	var scopes []string
+	if list, ok := claims["scp"].([]any); ok {
+		for _, v := range list {
+			if s, ok := v.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+
+	return scopes
+}
+
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func verify(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	case "EdDSA":
+		k, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type doesn't match %s", alg)
+		}
+		if !ed25519.Verify(k, signed, sig) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type doesn't match %s", alg)
+		}
+		return rsa.VerifyPKCS1v15(k, hash, digest, sig)
+	case "PS":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type doesn't match %s", alg)
+		}
+		return rsa.VerifyPSS(k, hash, digest, sig, nil)
+	default:
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type doesn't match %s", alg)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return fmt.Errorf("invalid signature")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/x509"
+	"net/http"
+)
+
+// IdentityFunc returns the subject for a verified client certificate
+type IdentityFunc func(*x509.Certificate) string
+
+// MTLSOption is a functional option to modify the MTLSAuthenticator
+type MTLSOption func(*MTLSAuthenticator)
+
+// MTLSAuthenticator authenticates requests with verified TLS client certificates. The server must request
+// and verify client certificates.
+type MTLSAuthenticator struct {
+	identity IdentityFunc
+}
+
+// SetIdentityFunc sets how the subject is read from the certificate. The default is the first URI SAN,
+// such as a SPIFFE ID, then the common name.
+func SetIdentityFunc(f IdentityFunc) MTLSOption {
+	return func(m *MTLSAuthenticator) {
+		m.identity = f
+	}
+}
+
+// NewMTLSAuthenticator returns an authenticator for client certificates
+func NewMTLSAuthenticator(opts ...MTLSOption) *MTLSAuthenticator {
+	m := &MTLSAuthenticator{
+		identity: CertIdentity,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// CertIdentity returns the first URI SAN of the certificate or the common name
+func CertIdentity(cert *x509.Certificate) string {
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+
+	return cert.Subject.CommonName
+}
+
+// Authenticate fulfills the Authenticator interface
+func (m *MTLSAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+	subject := m.identity(cert)
+	if subject == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Principal{
+		Subject: subject,
+		Method:  MethodMTLS,
+		Issuer:  cert.Issuer.CommonName,
+		Claims: map[string]any{
+			"serial":    cert.SerialNumber.String(),
+			"dns_names": cert.DNSNames,
+		},
+	}, nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	cwerrors "github.com/CoverWhale/coverwhale-go/errors"
+	"github.com/CoverWhale/logr"
+	"github.com/nats-io/nats.go/micro"
+)
+
+// NATSRequestInfoHeader is the header the NATS server adds with the requesting client's info to requests
+// that cross a service import with response info shared
+const NATSRequestInfoHeader = "Nats-Request-Info"
+
+// NATSClientInfo is the client info in the Nats-Request-Info header. The JWT is passed along as is and isn't
+// verified.
+type NATSClientInfo struct {
+	Account   string   `json:"acc"`
+	User      string   `json:"user,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	Host      string   `json:"host,omitempty"`
+	ID        uint64   `json:"id,omitempty"`
+	Server    string   `json:"server,omitempty"`
+	Cluster   string   `json:"cluster,omitempty"`
+	JWT       string   `json:"jwt,omitempty"`
+	IssuerKey string   `json:"issuer_key,omitempty"`
+	NameTag   string   `json:"name_tag,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
+// NATSAuthenticator authenticates a NATS micro request. ErrNoCredentials is returned if the request doesn't
+// have the credentials the NATSAuthenticator uses.
+type NATSAuthenticator interface {
+	AuthenticateNATS(micro.Request) (*Principal, error)
+}
+
+// NATSAuthenticatorFunc allows a plain function to be used as a NATSAuthenticator
+type NATSAuthenticatorFunc func(micro.Request) (*Principal, error)
+
+// AuthenticateNATS fulfills the NATSAuthenticator interface
+func (n NATSAuthenticatorFunc) AuthenticateNATS(r micro.Request) (*Principal, error) {
+	return n(r)
+}
+
+// NATSUser authenticates requests with the NATS user in the Nats-Request-Info header. The server only sets the
+// header on requests that cross a service import with share enabled, and it doesn't remove a header sent by the
+// client, so any client that can publish to a subject directly can forge it. The header is only used on requests
+// to the given subjects, which can use the * and > wildcards and must only be reachable through such an import.
+// Requests to other subjects are treated as having no credentials.
+func NATSUser(subjects ...string) NATSAuthenticator {
+	return NATSAuthenticatorFunc(func(r micro.Request) (*Principal, error) {
+		header := r.Headers().Get(NATSRequestInfoHeader)
+		if header == "" || !matchesAny(subjects, r.Subject()) {
+			return nil, ErrNoCredentials
+		}
+
+		var info NATSClientInfo
+		if err := json.Unmarshal([]byte(header), &info); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+		}
+
+		subject := info.User
+		if subject == "" {
+			subject = info.Name
+		}
+
+		return &Principal{
+			Subject: subject,
+			Method:  MethodNATS,
+			Issuer:  info.IssuerKey,
+			Claims: map[string]any{
+				"account":  info.Account,
+				"name":     info.Name,
+				"name_tag": info.NameTag,
+				"tags":     info.Tags,
+			},
+		}, nil
+	})
+}
+
+// AuthenticateNATS fulfills the NATSAuthenticator interface with the bearer token in the Authorization header
+func (j *JWTAuthenticator) AuthenticateNATS(r micro.Request) (*Principal, error) {
+	token, ok := BearerToken(r.Headers().Get("Authorization"))
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	return j.Validate(context.Background(), token)
+}
+
+// AuthenticateNATS fulfills the NATSAuthenticator interface
+func (a *APIKeyAuthenticator) AuthenticateNATS(r micro.Request) (*Principal, error) {
+	return a.Validate(r.Headers().Get(a.header))
+}
+
+// Request is a micro.Request with the authenticated principal. It is passed to handlers wrapped with NATSHandler.
+type Request struct {
+	micro.Request
+	Principal *Principal
+}
+
+// NATSPrincipal returns the principal of a request passed to a handler wrapped with NATSHandler. It is the
+// NATS equivalent of PrincipalFromContext.
+func NATSPrincipal(r micro.Request) (*Principal, bool) {
+	req, ok := r.(*Request)
+	if !ok || req.Principal == nil {
+		return nil, false
+	}
+
+	return req.Principal, true
+}
+
+// NATSHandler authenticates micro requests with the first NATSAuthenticator that finds credentials and passes
+// the request to the handler as a *Request. Requests without valid credentials get a 401 client error. The
+// handler has the same signature as a HandlerWithErrors.
+func NATSHandler(h func(*logr.Logger, micro.Request) error, authenticators ...NATSAuthenticator) func(*logr.Logger, micro.Request) error {
+	return func(logger *logr.Logger, r micro.Request) error {
+		for _, a := range authenticators {
+			p, err := a.AuthenticateNATS(r)
+			if errors.Is(err, ErrNoCredentials) {
+				continue
+			}
+			if err != nil {
+				logger.Debugf("authentication failed: %v", err)
+				return cwerrors.NewClientError(ErrInvalidCredentials, http.StatusUnauthorized)
+			}
+
+			return h(logger, &Request{Request: r, Principal: p})
+		}
+
+		return cwerrors.NewClientError(ErrNoCredentials, http.StatusUnauthorized)
+	}
+}
+
+func matchesAny(patterns []string, subject string) bool {
+	for _, v := range patterns {
+		if SubjectMatches(v, subject) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SubjectMatches reports whether a subject matches a pattern that can contain * and > wildcards
+func SubjectMatches(pattern, subject string) bool {
+	pTokens := strings.Split(pattern, ".")
+	sTokens := strings.Split(subject, ".")
+
+	for i, v := range pTokens {
+		if v == ">" {
+			return len(sTokens) > i
+		}
+		if i >= len(sTokens) {
+			return false
+		}
+		if v != "*" && v != sTokens[i] {
+			return false
+		}
+	}
+
+	return len(pTokens) == len(sTokens)
+}
@@ -16,103 +16,264 @@ package graphql
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 )
 
 type ClientOption func(*GraphQLClient)
 
 type GraphQLClient struct {
-	client *http.Client
-	URL    string
-}
-
-type gqlResponse struct {
-	Errors []gqlError `json:"errors"`
-}
-
-type gqlError struct {
-	Message string `json:"message"`
+	client    *http.Client
+	URL       string
+	headers   http.Header
+	transport Transport
 }
 
+// Query is the request body sent by the deprecated Query method
+//
+// Deprecated: use Request
 type Query struct {
 	Query     string `json:"query"`
 	Variables `json:"variables"`
 }
 
+// Variables wraps the variables sent by the deprecated Query method
+//
+// Deprecated: use Request variables
 type Variables struct {
 	Data json.RawMessage `json:"data"`
 }
 
-func handleGraphQLErrors(b []byte) error {
-	var g gqlResponse
-	if err := json.Unmarshal(b, &g); err != nil {
-		return err
+// Request is a GraphQL operation
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+	// Header is sent with the request in addition to the client headers
+	Header http.Header `json:"-"`
+}
+
+// RequestOption is a functional option to modify a request
+type RequestOption func(*Request)
+
+// NewRequest returns a request for the query
+func NewRequest(query string, opts ...RequestOption) *Request {
+	r := &Request{
+		Query:  query,
+		Header: make(http.Header),
 	}
 
-	if g.Errors == nil {
-		return nil
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// WithVariables adds variables to the request
+func WithVariables(vars map[string]any) RequestOption {
+	return func(r *Request) {
+		for k, v := range vars {
+			WithVariable(k, v)(r)
+		}
+	}
+}
+
+// WithVariable adds a single variable to the request
+func WithVariable(name string, value any) RequestOption {
+	return func(r *Request) {
+		if r.Variables == nil {
+			r.Variables = make(map[string]any)
+		}
+		r.Variables[name] = value
+	}
+}
+
+// WithOperationName selects the operation to run when the query has more than one
+func WithOperationName(name string) RequestOption {
+	return func(r *Request) {
+		r.OperationName = name
+	}
+}
+
+// WithHeader adds a header to the request
+func WithHeader(key, value string) RequestOption {
+	return func(r *Request) {
+		if r.Header == nil {
+			r.Header = make(http.Header)
+		}
+		r.Header.Add(key, value)
+	}
+}
+
+// WithBearerToken sets the Authorization header for the request
+func WithBearerToken(token string) RequestOption {
+	return func(r *Request) {
+		if r.Header == nil {
+			r.Header = make(http.Header)
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// Response is a GraphQL response. Data can be set along with Errors when part of the operation failed.
+type Response struct {
+	Data       json.RawMessage `json:"data,omitempty"`
+	Errors     Errors          `json:"errors,omitempty"`
+	Extensions map[string]any  `json:"extensions,omitempty"`
+}
+
+// Location is a position in the query
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Error is a single GraphQL error
+type Error struct {
+	Message    string         `json:"message"`
+	Path       []any          `json:"path,omitempty"`
+	Locations  []Location     `json:"locations,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
 	}
 
-	var errors error
-	for _, v := range g.Errors {
-		errors = fmt.Errorf("%w", fmt.Errorf("%s", v.Message))
+	path := make([]string, len(e.Path))
+	for i, v := range e.Path {
+		path[i] = fmt.Sprint(v)
 	}
 
-	return errors
+	return fmt.Sprintf("%s: %s", strings.Join(path, "."), e.Message)
+}
+
+// Errors are the errors from a GraphQL response. Each error can be found with errors.As.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, v := range e {
+		messages[i] = v.Error()
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, v := range e {
+		errs[i] = v
+	}
+
+	return errs
+}
+
+// HTTPError is returned when the server responds with a non 200 status and no GraphQL errors
+type HTTPError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (h *HTTPError) Error() string {
+	return fmt.Sprintf("error: status %d: %s", h.StatusCode, string(h.Body))
 }
 
 func NewGraphQLClient(url string, opts ...ClientOption) *GraphQLClient {
 	c := &GraphQLClient{
-		client: http.DefaultClient,
-		URL:    url,
+		client:  http.DefaultClient,
+		URL:     url,
+		headers: make(http.Header),
 	}
 
 	for _, opt := range opts {
 		opt(c)
 	}
 
+	if c.transport == nil {
+		c.transport = NewHTTPTransport(fmt.Sprintf("%s/query", url), c.client)
+	}
+
 	return c
 }
 
+// SetTransport sends requests with the transport instead of HTTP to the client URL
+func SetTransport(t Transport) ClientOption {
+	return func(c *GraphQLClient) {
+		c.transport = t
+	}
+}
+
 func SetHTTPClient(client *http.Client) ClientOption {
 	return func(c *GraphQLClient) {
 		c.client = client
 	}
 }
 
-func (g *GraphQLClient) newPostRequest(url string, data []byte) ([]byte, error) {
+// SetHeader adds a header to every request
+func SetHeader(key, value string) ClientOption {
+	return func(c *GraphQLClient) {
+		c.headers.Add(key, value)
+	}
+}
 
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+// Do sends the request with the client's transport. GraphQL errors are returned as Errors along with the
+// response so partial data can still be read.
+func (g *GraphQLClient) Do(ctx context.Context, r *Request) (*Response, error) {
+	resp, err := g.transport.RoundTrip(ctx, g.withHeaders(r))
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Add("Content-Type", "application/json")
-
-	resp, err := g.client.Do(req)
-	if err != nil {
-		return nil, err
+	if len(resp.Errors) > 0 {
+		return resp, resp.Errors
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	return resp, nil
+}
+
+// withHeaders returns a copy of the request with the client headers added
+func (g *GraphQLClient) withHeaders(r *Request) *Request {
+	req := *r
+	req.Header = make(http.Header)
+	for k, v := range g.headers {
+		req.Header[k] = append([]string{}, v...)
+	}
+	for k, v := range r.Header {
+		req.Header[k] = append([]string{}, v...)
 	}
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("error: %v", string(body))
+	return &req
+}
+
+// Execute sends the request and decodes the response data into T. When the response has errors, any partial
+// data is decoded and returned with them.
+func Execute[T any](ctx context.Context, g *GraphQLClient, r *Request) (T, error) {
+	var result T
+
+	resp, err := g.Do(ctx, r)
+	if resp == nil {
+		return result, err
 	}
 
-	if err := handleGraphQLErrors(body); err != nil {
-		return nil, err
+	if len(resp.Data) > 0 && string(resp.Data) != "null" {
+		if decodeErr := json.Unmarshal(resp.Data, &result); decodeErr != nil && err == nil {
+			return result, fmt.Errorf("error decoding data: %w", decodeErr)
+		}
 	}
 
-	return body, nil
+	return result, err
 }
 
+// Query sends the query with the variables from r wrapped in a data variable and returns the raw response
+//
+// Deprecated: use Do or Execute
 func (g *GraphQLClient) Query(query string, r io.Reader) ([]byte, error) {
 	var b bytes.Buffer
 
@@ -141,3 +302,50 @@ func (g *GraphQLClient) query(query string, vars json.RawMessage) ([]byte, error
 
 	return g.newPostRequest(url, data)
 }
+
+func (g *GraphQLClient) newPostRequest(url string, data []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range g.headers {
+		req.Header[k] = append([]string{}, v...)
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("error: %v", string(body))
+	}
+
+	if err := handleGraphQLErrors(body); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// handleGraphQLErrors returns every error in the response
+func handleGraphQLErrors(b []byte) error {
+	var g Response
+	if err := json.Unmarshal(b, &g); err != nil {
+		return err
+	}
+
+	if len(g.Errors) == 0 {
+		return nil
+	}
+
+	return g.Errors
+}
@@ -0,0 +1,122 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type product struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type productResult struct {
+	Product *product `json:"product"`
+}
+
+func TestExecute(t *testing.T) {
+	var received Request
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		json.NewDecoder(r.Body).Decode(&received)
+
+		switch received.Variables["id"] {
+		case "1":
+			w.Write([]byte(`{"data": {"product": {"id": "1", "name": "truck"}}}`))
+		case "partial":
+			w.Write([]byte(`{"data": {"product": {"id": "partial", "name": null}}, "errors": [
+				{"message": "name is restricted", "path": ["product", "name"], "extensions": {"code": "FORBIDDEN"}},
+				{"message": "second error", "locations": [{"line": 1, "column": 2}]}
+			]}`))
+		case "bad":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors": [{"message": "invalid variable"}]}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`bad gateway`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewGraphQLClient(server.URL, SetHeader("X-Client", "test"))
+	query := `query product($id: ID!) { product(id: $id) { id name } } query other { __typename }`
+
+	tt := []struct {
+		name     string
+		id       string
+		expected *product
+		errors   int
+		status   int
+	}{
+		{name: "data", id: "1", expected: &product{ID: "1", Name: "truck"}},
+		{name: "partial data", id: "partial", expected: &product{ID: "partial"}, errors: 2},
+		{name: "graphql errors with status", id: "bad", errors: 1},
+		{name: "http error", id: "other", status: http.StatusBadGateway},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			req := NewRequest(query, WithVariable("id", v.id), WithOperationName("product"), WithBearerToken("token"))
+			result, err := Execute[productResult](context.Background(), client, req)
+
+			if received.OperationName != "product" || headers.Get("Authorization") != "Bearer token" || headers.Get("X-Client") != "test" {
+				t.Errorf("unexpected request %+v %v", received, headers)
+			}
+
+			if v.expected != nil && (result.Product == nil || *result.Product != *v.expected) {
+				t.Errorf("expected %+v but got %+v", v.expected, result.Product)
+			}
+
+			var gqlErrs Errors
+			if v.errors > 0 {
+				if !errors.As(err, &gqlErrs) || len(gqlErrs) != v.errors {
+					t.Fatalf("expected %d errors but got %v", v.errors, err)
+				}
+			}
+
+			var httpErr *HTTPError
+			if v.status > 0 && (!errors.As(err, &httpErr) || httpErr.StatusCode != v.status) {
+				t.Errorf("expected status %d but got %v", v.status, err)
+			}
+
+			if v.errors == 0 && v.status == 0 && err != nil {
+				t.Errorf("expected no error but got %v", err)
+			}
+		})
+	}
+
+	t.Run("error details", func(t *testing.T) {
+		_, err := Execute[productResult](context.Background(), client, NewRequest(query, WithVariable("id", "partial")))
+
+		var gqlErr *Error
+		if !errors.As(err, &gqlErr) {
+			t.Fatalf("expected an Error but got %v", err)
+		}
+		if gqlErr.Extensions["code"] != "FORBIDDEN" || len(gqlErr.Path) != 2 {
+			t.Errorf("unexpected error %+v", gqlErr)
+		}
+		if !strings.Contains(err.Error(), "product.name: name is restricted") || !strings.Contains(err.Error(), "second error") {
+			t.Errorf("expected every message but got %s", err)
+		}
+	})
+}
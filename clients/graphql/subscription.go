@@ -0,0 +1,235 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// headers and events used by the transports/nats resolver for subscriptions
+const (
+	eventHeader   = "Graphql-Event"
+	controlHeader = "Graphql-Control-Subject"
+	streamHeader  = "Graphql-Stream-Subject"
+
+	eventNext     = "next"
+	eventComplete = "complete"
+	eventStream   = "stream"
+)
+
+var ErrSubscriptionsNotSupported = fmt.Errorf("transport does not support subscriptions")
+
+// SubscriptionTransport is a transport that can stream the responses of subscription operations
+type SubscriptionTransport interface {
+	Subscribe(ctx context.Context, r *Request) (*Subscription, error)
+}
+
+// Subscription receives the responses of a subscription operation
+type Subscription struct {
+	next  func(context.Context) (*Response, error)
+	close func() error
+}
+
+// Next waits for the next response. Like Do, a response with errors is returned with them. It returns io.EOF
+// when the subscription is complete.
+func (s *Subscription) Next(ctx context.Context) (*Response, error) {
+	resp, err := s.next(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Errors) > 0 {
+		return resp, resp.Errors
+	}
+
+	return resp, nil
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() error {
+	return s.close()
+}
+
+// Subscribe starts a subscription operation. The client's transport must implement SubscriptionTransport.
+func (g *GraphQLClient) Subscribe(ctx context.Context, r *Request) (*Subscription, error) {
+	t, ok := g.transport.(SubscriptionTransport)
+	if !ok {
+		return nil, ErrSubscriptionsNotSupported
+	}
+
+	return t.Subscribe(ctx, g.withHeaders(r))
+}
+
+// msgSource is the part of a nats.Subscription used to read subscription events
+type msgSource interface {
+	NextMsgWithContext(ctx context.Context) (*nats.Msg, error)
+	Unsubscribe() error
+}
+
+// Subscribe sends the subscription to the resolver and reads the events from the reply inbox, or from the
+// JetStream subject when the resolver publishes events to a stream
+func (n *NATSTransport) Subscribe(ctx context.Context, r *Request) (*Subscription, error) {
+	msg, err := n.newMsg(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	inbox := n.conn.NewInbox()
+	sub, err := n.conn.SubscribeSync(inbox)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Reply = inbox
+	if err := n.conn.PublishMsg(msg); err != nil {
+		sub.Unsubscribe()
+		return nil, fmt.Errorf("error sending subscription on %s: %w", n.subject, err)
+	}
+
+	startCtx, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
+
+	first, err := sub.NextMsgWithContext(startCtx)
+	if err == nil && first.Header.Get("Status") == "503" {
+		err = nats.ErrNoResponders
+	}
+	if err != nil {
+		sub.Unsubscribe()
+		return nil, fmt.Errorf("error starting subscription on %s: %w", n.subject, err)
+	}
+
+	s := &natsSubscription{
+		conn:    n.conn,
+		source:  sub,
+		pending: first,
+		control: first.Header.Get(controlHeader),
+		single:  first.Header.Get(eventHeader) == "",
+		stop:    make(chan struct{}),
+	}
+
+	if first.Header.Get(eventHeader) == eventStream {
+		js, err := n.conn.JetStream()
+		if err != nil {
+			sub.Unsubscribe()
+			return nil, err
+		}
+
+		streamSub, err := js.SubscribeSync(first.Header.Get(streamHeader), nats.OrderedConsumer())
+		if err != nil {
+			sub.Unsubscribe()
+			return nil, fmt.Errorf("error reading subscription stream: %w", err)
+		}
+		sub.Unsubscribe()
+
+		s.source = streamSub
+		s.pending = nil
+	}
+
+	if s.control != "" && n.keepAlive > 0 {
+		go s.keepAlive(n.keepAlive)
+	}
+
+	return &Subscription{next: s.next, close: s.close}, nil
+}
+
+type natsSubscription struct {
+	conn    *nats.Conn
+	source  msgSource
+	pending *nats.Msg
+	control string
+	// single is a normal response, such as a validation error, instead of a subscription
+	single bool
+
+	mu   sync.Mutex
+	done bool
+	stop chan struct{}
+	once sync.Once
+}
+
+func (s *natsSubscription) next(ctx context.Context) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done {
+		return nil, io.EOF
+	}
+
+	msg := s.pending
+	s.pending = nil
+	if msg == nil {
+		var err error
+		msg, err = s.source.NextMsgWithContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.single {
+		s.done = true
+		return decodeNATSReply(msg)
+	}
+
+	switch msg.Header.Get(eventHeader) {
+	case eventComplete:
+		s.done = true
+		return nil, io.EOF
+	case eventNext:
+		return decodeNATSReply(msg)
+	}
+
+	return nil, fmt.Errorf("unexpected subscription event %q", msg.Header.Get(eventHeader))
+}
+
+func (s *natsSubscription) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.conn.Publish(s.control, []byte("ping"))
+		}
+	}
+}
+
+func (s *natsSubscription) close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.stop)
+
+		s.mu.Lock()
+		done := s.done
+		s.done = true
+		s.mu.Unlock()
+
+		if !done && s.control != "" && s.conn != nil {
+			err = s.conn.Publish(s.control, []byte(eventComplete))
+		}
+
+		if unsubErr := s.source.Unsubscribe(); err == nil {
+			err = unsubErr
+		}
+	})
+
+	return err
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphql
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+type fakeSource struct {
+	msgs         []*nats.Msg
+	unsubscribed bool
+}
+
+func (f *fakeSource) NextMsgWithContext(ctx context.Context) (*nats.Msg, error) {
+	if len(f.msgs) == 0 {
+		return nil, context.DeadlineExceeded
+	}
+
+	msg := f.msgs[0]
+	f.msgs = f.msgs[1:]
+	return msg, nil
+}
+
+func (f *fakeSource) Unsubscribe() error {
+	f.unsubscribed = true
+	return nil
+}
+
+func eventMsg(event, data string) *nats.Msg {
+	msg := nats.NewMsg("inbox")
+	msg.Data = []byte(data)
+	if event != "" {
+		msg.Header.Set(eventHeader, event)
+	}
+
+	return msg
+}
+
+func TestNATSSubscription(t *testing.T) {
+	tt := []struct {
+		name   string
+		msgs   []*nats.Msg
+		single bool
+		data   []string
+		err    error
+	}{
+		{
+			name: "events",
+			msgs: []*nats.Msg{
+				eventMsg(eventNext, `{"data":{"count":1}}`),
+				eventMsg(eventNext, `{"data":{"count":2}}`),
+				eventMsg(eventComplete, ""),
+			},
+			data: []string{`{"count":1}`, `{"count":2}`},
+			err:  io.EOF,
+		},
+		{
+			name:   "single response",
+			msgs:   []*nats.Msg{eventMsg("", `{"data":{"hello":"world"}}`)},
+			single: true,
+			data:   []string{`{"hello":"world"}`},
+			err:    io.EOF,
+		},
+		{
+			name:   "single error response",
+			msgs:   []*nats.Msg{eventMsg("", `{"errors":[{"message":"bad subscription"}]}`)},
+			single: true,
+			err:    &Error{},
+		},
+		{
+			name: "unexpected event",
+			msgs: []*nats.Msg{eventMsg("stream", "")},
+			err:  errors.New(`unexpected subscription event "stream"`),
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			source := &fakeSource{msgs: v.msgs}
+			ns := &natsSubscription{source: source, single: v.single, stop: make(chan struct{})}
+			s := &Subscription{next: ns.next, close: ns.close}
+
+			var data []string
+			var err error
+			for {
+				var resp *Response
+				resp, err = s.Next(context.Background())
+				if err != nil {
+					break
+				}
+				data = append(data, string(resp.Data))
+			}
+
+			if len(data) != len(v.data) {
+				t.Fatalf("expected %d responses but got %d", len(v.data), len(data))
+			}
+			for i := range data {
+				if data[i] != v.data[i] {
+					t.Errorf("expected %s but got %s", v.data[i], data[i])
+				}
+			}
+
+			var gqlErr *Error
+			switch {
+			case errors.As(v.err, &gqlErr):
+				if !errors.As(err, &gqlErr) {
+					t.Errorf("expected a GraphQL error but got %v", err)
+				}
+			case err.Error() != v.err.Error():
+				t.Errorf("expected %v but got %v", v.err, err)
+			}
+
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !source.unsubscribed {
+				t.Error("expected subscription to be unsubscribed")
+			}
+		})
+	}
+}
+
+func TestSubscribeUnsupported(t *testing.T) {
+	client := NewGraphQLClient("http://localhost")
+	if _, err := client.Subscribe(context.Background(), NewRequest("subscription { count }")); !errors.Is(err, ErrSubscriptionsNotSupported) {
+		t.Errorf("expected %v but got %v", ErrSubscriptionsNotSupported, err)
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	cwerrors "github.com/CoverWhale/coverwhale-go/errors"
+	"github.com/CoverWhale/coverwhale-go/transports/correlation"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+)
+
+// timeoutHeader tells the transports/nats resolver how long the client waits for a response
+const timeoutHeader = "X-Timeout"
+
+// Transport sends a request and returns the decoded response. GraphQL errors are returned in the response,
+// not as an error.
+type Transport interface {
+	RoundTrip(ctx context.Context, r *Request) (*Response, error)
+}
+
+// HTTPTransport posts requests to a GraphQL endpoint
+type HTTPTransport struct {
+	client *http.Client
+	url    string
+}
+
+// NewHTTPTransport returns a transport for the endpoint URL, such as https://example.com/query
+func NewHTTPTransport(url string, client *http.Client) *HTTPTransport {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &HTTPTransport{
+		client: client,
+		url:    url,
+	}
+}
+
+func (h *HTTPTransport) RoundTrip(ctx context.Context, r *Request) (*Response, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range r.Header {
+		req.Header[k] = append([]string{}, v...)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/graphql-response+json, application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var gqlResp Response
+	if err := json.Unmarshal(body, &gqlResp); err != nil || (resp.StatusCode != http.StatusOK && len(gqlResp.Errors) == 0) {
+		if resp.StatusCode != http.StatusOK {
+			return nil, &HTTPError{StatusCode: resp.StatusCode, Body: body}
+		}
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	return &gqlResp, nil
+}
+
+// NATSTransport sends requests to the GraphQL resolver served by transports/nats.NATSClient
+type NATSTransport struct {
+	conn      *nats.Conn
+	subject   string
+	timeout   time.Duration
+	keepAlive time.Duration
+}
+
+// NATSTransportOption is a functional option to modify the NATS transport
+type NATSTransportOption func(*NATSTransport)
+
+// NewNATSTransport returns a transport for the service subject, such as prime.services.products.>. Requests
+// are sent to <subject>.graphql like the NATSClient resolver listens on. The default timeout is 5s.
+func NewNATSTransport(nc *nats.Conn, subject string, opts ...NATSTransportOption) *NATSTransport {
+	t := &NATSTransport{
+		conn:      nc,
+		subject:   fmt.Sprintf("%s.graphql", strings.TrimSuffix(subject, ".>")),
+		timeout:   5 * time.Second,
+		keepAlive: 20 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+// SetNATSTimeout sets how long to wait for a reply when the context has no earlier deadline
+func SetNATSTimeout(d time.Duration) NATSTransportOption {
+	return func(t *NATSTransport) {
+		t.timeout = d
+	}
+}
+
+// SetNATSKeepAlive sets how often subscriptions send a keepalive to the resolver. It must be shorter than the
+// resolver's idle timeout, which defaults to a minute.
+func SetNATSKeepAlive(d time.Duration) NATSTransportOption {
+	return func(t *NATSTransport) {
+		t.keepAlive = d
+	}
+}
+
+func (n *NATSTransport) RoundTrip(ctx context.Context, r *Request) (*Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
+
+	msg, err := n.newMsg(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	// the resolver stops working on the request once the client has given up, which is the earlier of the
+	// context's deadline and the timeout
+	deadline, _ := ctx.Deadline()
+	msg.Header.Set(timeoutHeader, time.Until(deadline).String())
+
+	reply, err := n.conn.RequestMsgWithContext(ctx, msg)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request on %s: %w", n.subject, err)
+	}
+
+	return decodeNATSReply(reply)
+}
+
+// newMsg encodes the request with its headers and the trace context and correlation ID from the context
+func (n *NATSTransport) newMsg(ctx context.Context, r *Request) (*nats.Msg, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := nats.NewMsg(n.subject)
+	msg.Data = data
+	for k, v := range r.Header {
+		msg.Header[k] = append([]string{}, v...)
+	}
+	correlation.Inject(ctx, msg.Header)
+
+	return msg, nil
+}
+
+// decodeNATSReply decodes a resolver reply. Errors returned by a micro handler are checked first, from the
+// Nats-Service-Error-Code and Nats-Service-Error headers, and returned as an errors.ClientError like
+// transports/nats Request does. The resolver replies with {"error": "..."} when it can't encode the response.
+func decodeNATSReply(msg *nats.Msg) (*Response, error) {
+	if code := msg.Header.Get(micro.ErrorCodeHeader); code != "" {
+		status, err := strconv.Atoi(code)
+		if err != nil {
+			status = http.StatusInternalServerError
+		}
+
+		ce, err := cwerrors.ParseClientError(status, msg.Data)
+		if err != nil {
+			description := msg.Header.Get(micro.ErrorHeader)
+			if description == "" {
+				description = http.StatusText(status)
+			}
+			return nil, cwerrors.NewClientError(fmt.Errorf("%s", description), status)
+		}
+
+		return nil, ce
+	}
+
+	var reply struct {
+		Response
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(msg.Data, &reply); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	if reply.Error != "" && len(reply.Errors) == 0 {
+		return nil, fmt.Errorf("error: %s", reply.Error)
+	}
+
+	return &reply.Response, nil
+}
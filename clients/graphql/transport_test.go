@@ -0,0 +1,143 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	cwerrors "github.com/CoverWhale/coverwhale-go/errors"
+	"github.com/CoverWhale/coverwhale-go/transports/correlation"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type transportFunc func(context.Context, *Request) (*Response, error)
+
+func (t transportFunc) RoundTrip(ctx context.Context, r *Request) (*Response, error) {
+	return t(ctx, r)
+}
+
+func TestSetTransport(t *testing.T) {
+	var header http.Header
+	transport := transportFunc(func(ctx context.Context, r *Request) (*Response, error) {
+		header = r.Header
+		return &Response{Data: json.RawMessage(`{"product": {"id": "1"}}`)}, nil
+	})
+
+	client := NewGraphQLClient("", SetTransport(transport), SetHeader("X-Client", "test"))
+	result, err := Execute[productResult](context.Background(), client, NewRequest("{ product { id } }", WithHeader("X-Request", "1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Product.ID != "1" {
+		t.Errorf("expected product 1 but got %+v", result.Product)
+	}
+	if header.Get("X-Client") != "test" || header.Get("X-Request") != "1" {
+		t.Errorf("expected client and request headers but got %v", header)
+	}
+}
+
+func TestDecodeNATSReply(t *testing.T) {
+	tt := []struct {
+		name    string
+		data    string
+		headers map[string]string
+		errors  int
+		err     bool
+		status  int
+	}{
+		{name: "data", data: `{"data": {"product": {"id": "1"}}}`},
+		{name: "graphql errors", data: `{"errors": [{"message": "a"}, {"message": "b"}], "data": null}`, errors: 2},
+		{name: "resolver error", data: `{"error": "internal server error"}`, err: true},
+		{name: "invalid json", data: `nope`, err: true},
+		{name: "client error", data: `{"error": "rate limited"}`, headers: map[string]string{micro.ErrorCodeHeader: "429", micro.ErrorHeader: "rate limited"}, err: true, status: http.StatusTooManyRequests},
+		{name: "service error", headers: map[string]string{micro.ErrorCodeHeader: "503", micro.ErrorHeader: "unavailable"}, err: true, status: http.StatusServiceUnavailable},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			msg := nats.NewMsg("test")
+			msg.Data = []byte(v.data)
+			for k, val := range v.headers {
+				msg.Header.Set(k, val)
+			}
+
+			resp, err := decodeNATSReply(msg)
+			if (err != nil) != v.err {
+				t.Fatalf("expected error %t but got %v", v.err, err)
+			}
+			if v.status != 0 {
+				var ce cwerrors.ClientError
+				if !errors.As(err, &ce) || ce.Code() != v.status {
+					t.Errorf("expected client error with status %d but got %v", v.status, err)
+				}
+			}
+			if v.err {
+				return
+			}
+
+			if len(resp.Errors) != v.errors {
+				t.Errorf("expected %d errors but got %d", v.errors, len(resp.Errors))
+			}
+
+			var gqlErrs Errors
+			if v.errors > 0 && !errors.As(resp.Errors, &gqlErrs) {
+				t.Errorf("expected Errors")
+			}
+		})
+	}
+}
+
+func TestNATSTransportMsg(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(prev)
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled})
+
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+	ctx = correlation.WithID(ctx, "abc")
+
+	transport := &NATSTransport{subject: "prime.services.products.graphql"}
+	msg, err := transport.newMsg(ctx, NewRequest("{ product { id } }", WithHeader("X-Request", "1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Subject != "prime.services.products.graphql" {
+		t.Errorf("expected subject prime.services.products.graphql but got %s", msg.Subject)
+	}
+	if msg.Header.Get("X-Request") != "1" {
+		t.Errorf("expected X-Request header 1 but got %q", msg.Header.Get("X-Request"))
+	}
+	if msg.Header.Get(correlation.Header) != "abc" {
+		t.Errorf("expected correlation ID abc but got %q", msg.Header.Get(correlation.Header))
+	}
+
+	got := correlation.Extract(context.Background(), msg.Header)
+	if trace.SpanContextFromContext(got).TraceID() != traceID {
+		t.Errorf("expected trace ID %s but got %s", traceID, trace.SpanContextFromContext(got).TraceID())
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	cwerrors "github.com/CoverWhale/coverwhale-go/errors"
+	"github.com/CoverWhale/coverwhale-go/internal/jsonschema"
+	cwnats "github.com/CoverWhale/coverwhale-go/transports/nats"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/segmentio/ksuid"
+	"github.com/spf13/cobra"
+)
+
+// sends a request to a micro service endpoint
+var callCmd = &cobra.Command{
+	Use:   "call <service> <endpoint> [payload]",
+	Short: "Send a request to a NATS micro service endpoint",
+	Long: `Sends a request to a micro service endpoint. The subject is resolved from the service info and the
+request ID wildcard is filled with a new KSUID, which is also sent in the X-Request-ID header. The payload is checked against the endpoint's request_schema
+before it is sent. Use - as the payload to read it from stdin.`,
+	Example: `  cwgoctl call example add '{"a": 1, "b": 2}'
+  cat request.json | cwgoctl call example add -
+  cwgoctl call example lookup --token us-east '{"id": "123"}'`,
+	Args: cobra.RangeArgs(2, 3),
+	RunE: call,
+}
+
+func init() {
+	rootCmd.AddCommand(callCmd)
+	addNATSFlags(callCmd)
+	callCmd.Flags().StringP("file", "f", "", "File to read the payload from")
+	callCmd.Flags().StringSlice("token", nil, "Values for subject wildcards other than the request ID, in order")
+	callCmd.Flags().StringArrayP("header", "H", nil, "Request header as key:value")
+	callCmd.Flags().Bool("no-validate", false, "Send the payload without checking the request schema")
+	callCmd.Flags().Bool("raw", false, "Print the response without formatting")
+}
+
+func call(cmd *cobra.Command, args []string) error {
+	file, _ := cmd.Flags().GetString("file")
+	tokens, _ := cmd.Flags().GetStringSlice("token")
+	headers, _ := cmd.Flags().GetStringArray("header")
+	noValidate, _ := cmd.Flags().GetBool("no-validate")
+	raw, _ := cmd.Flags().GetBool("raw")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	payload, err := readPayload(cmd, args, file)
+	if err != nil {
+		return err
+	}
+
+	nc, err := natsConnect(cmd)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	info, err := discoverService(cmd, nc, args[0])
+	if err != nil {
+		return err
+	}
+
+	var endpoint *micro.EndpointInfo
+	for i, v := range info.Endpoints {
+		if v.Name == args[1] {
+			endpoint = &info.Endpoints[i]
+			break
+		}
+	}
+	if endpoint == nil {
+		return fmt.Errorf("endpoint %s not found in service %s", args[1], args[0])
+	}
+
+	if schema, ok := endpoint.Metadata[cwnats.RequestSchemaKey]; ok && !noValidate {
+		if err := jsonschema.Validate([]byte(schema), payload); err != nil {
+			return err
+		}
+	}
+
+	id := ksuid.New().String()
+	subject, err := cwnats.RequestSubjectWithID(endpoint.Subject, id, tokens...)
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = payload
+	for _, v := range headers {
+		key, val, ok := strings.Cut(v, ":")
+		if !ok {
+			return fmt.Errorf("invalid header %q, expected key:value", v)
+		}
+		msg.Header.Add(strings.TrimSpace(key), strings.TrimSpace(val))
+	}
+	// the header matches the request ID in the subject like RequestClient sends
+	msg.Header.Set(cwnats.RequestIDHeader, id)
+
+	if cfg.Debug {
+		fmt.Fprintf(cmd.ErrOrStderr(), "sending request on %s\n", subject)
+	}
+
+	resp, err := nc.RequestMsg(msg, timeout)
+	if err != nil {
+		return fmt.Errorf("error sending request on %s: %w", subject, err)
+	}
+
+	if code := resp.Header.Get(micro.ErrorCodeHeader); code != "" {
+		return responseError(cmd.ErrOrStderr(), code, resp)
+	}
+
+	out := cmd.OutOrStdout()
+	var buf bytes.Buffer
+	if raw || json.Indent(&buf, resp.Data, "", "  ") != nil {
+		_, err := out.Write(resp.Data)
+		return err
+	}
+
+	buf.WriteString("\n")
+	_, err = out.Write(buf.Bytes())
+	return err
+}
+
+// readPayload returns the payload from the file flag, stdin, or the argument. An empty payload is sent
+// when none is given.
+func readPayload(cmd *cobra.Command, args []string, file string) ([]byte, error) {
+	switch {
+	case file != "":
+		return os.ReadFile(file)
+	case len(args) < 3:
+		return nil, nil
+	case args[2] == "-":
+		return io.ReadAll(cmd.InOrStdin())
+	}
+
+	return []byte(args[2]), nil
+}
+
+// responseError prints the errors envelope of a failed request
+func responseError(w io.Writer, code string, resp *nats.Msg) error {
+	status, _ := strconv.Atoi(code)
+	description := resp.Header.Get(micro.ErrorHeader)
+
+	ce, err := cwerrors.ParseClientError(status, resp.Data)
+	if err != nil {
+		if len(resp.Data) > 0 {
+			fmt.Fprintln(w, string(resp.Data))
+		}
+		return fmt.Errorf("request failed with code %s: %s", code, description)
+	}
+
+	for _, v := range ce.ErrorsWithMetadata {
+		fmt.Fprintf(w, "%s (%s/%s): %s\n", v.Code, v.Type, v.Level, v.Message)
+	}
+	if len(ce.ErrorsWithMetadata) == 0 {
+		fmt.Fprintln(w, ce.Details)
+	}
+	keys := make([]string, 0, len(ce.Params))
+	for k := range ce.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %s: %v\n", k, ce.Params[k])
+	}
+
+	return fmt.Errorf("request failed with code %s: %s", code, description)
+}
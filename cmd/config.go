@@ -0,0 +1,96 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/CoverWhale/coverwhale-go/config/codegen"
+	"github.com/spf13/cobra"
+)
+
+// subcommand for working with config schemas
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Work with CUE config schemas",
+}
+
+var configGenCmd = &cobra.Command{
+	Use:   "gen",
+	Short: "Generate Go config types from a CUE schema or a CUE schema from Go types",
+	Long: `Generates Go types from a CUE schema so the struct passed to config.Unmarshal always matches the schema.
+Passing --from-go generates a CUE schema from an existing Go struct instead.`,
+	Example: `  cwgoctl config gen --schema config/schema.cue --package config --type Config --output config/config_gen.go
+  cwgoctl config gen --from-go config/config.go --type AppConfig --output config/schema.cue`,
+	RunE: configGen,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configGenCmd)
+	configGenCmd.Flags().String("schema", "", "CUE schema to generate Go types from")
+	configGenCmd.Flags().String("from-go", "", "Go file to generate a CUE schema from")
+	configGenCmd.Flags().String("type", "Config", "Name of the Go type to generate or read")
+	configGenCmd.Flags().String("package", "config", "Package name for generated Go code")
+	configGenCmd.Flags().StringP("output", "o", "", "File to write to, defaults to stdout")
+	configGenCmd.MarkFlagsMutuallyExclusive("schema", "from-go")
+	configGenCmd.MarkFlagsOneRequired("schema", "from-go")
+}
+
+func configGen(cmd *cobra.Command, args []string) error {
+	schema, _ := cmd.Flags().GetString("schema")
+	fromGo, _ := cmd.Flags().GetString("from-go")
+	typeName, _ := cmd.Flags().GetString("type")
+	pkg, _ := cmd.Flags().GetString("package")
+	output, _ := cmd.Flags().GetString("output")
+
+	var out []byte
+	var err error
+
+	if schema != "" {
+		out, err = generateFromFile(schema, func(b []byte) ([]byte, error) {
+			return codegen.GenerateGo(b, pkg, typeName)
+		})
+	} else {
+		out, err = generateFromFile(fromGo, func(b []byte) ([]byte, error) {
+			return codegen.GenerateCUE(b, typeName)
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	if output == "" || cfg.Debug {
+		_, err := os.Stdout.Write(out)
+		return err
+	}
+
+	return os.WriteFile(output, out, 0644)
+}
+
+func generateFromFile(path string, gen func([]byte) ([]byte, error)) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := gen(data)
+	if err != nil {
+		return nil, fmt.Errorf("error generating from %s: %w", path, err)
+	}
+
+	return out, nil
+}
@@ -15,6 +15,7 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"log"
@@ -23,6 +24,7 @@ import (
 	"text/template"
 
 	"github.com/CoverWhale/coverwhale-go/cmd/tpl"
+	"github.com/CoverWhale/coverwhale-go/config/codegen"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -80,7 +82,7 @@ func service(cmd *cobra.Command, args []string) error {
 	cfg.Service.Module = mod
 
 	if !cfg.Debug {
-		dirs := []string{"./cmd", "./service", "./.github/workflows"}
+		dirs := []string{"./cmd", "./service", "./config", "./.github/workflows"}
 		if cfg.Service.EnableGraphql {
 			dirs = append(dirs, "./graph")
 		}
@@ -115,6 +117,9 @@ func service(cmd *cobra.Command, args []string) error {
 		createDocs(dd),
 		createNats(dd),
 		createNatsCmdHelper(dd),
+		createConfigSchema(dd),
+		createConfigLoader(dd),
+		createConfigTypes(dd),
 	}
 
 	if cfg.Service.EnableEdgeDB {
@@ -208,6 +213,41 @@ func createNatsCmdHelper(dd Delims) CreateFileFromTemplate {
 	}
 }
 
+// config
+// templates under config.go
+func createConfigSchema(dd Delims) CreateFileFromTemplate {
+	return func(s *Service) error {
+		return cfg.Service.createOrPrintFile("config/schema.cue", tpl.ConfigSchema(), dd)
+	}
+}
+
+func createConfigLoader(dd Delims) CreateFileFromTemplate {
+	return func(s *Service) error {
+		return cfg.Service.createOrPrintFile("config/config.go", tpl.ConfigLoader(), dd)
+	}
+}
+
+// createConfigTypes generates the Go config types from the rendered schema template so they always match
+func createConfigTypes(dd Delims) CreateFileFromTemplate {
+	return func(s *Service) error {
+		if dd.First == "" && dd.Second == "" {
+			dd = Delims{First: "{{", Second: "}}"}
+		}
+
+		var schema bytes.Buffer
+		if err := s.handleOutput(&schema, tpl.ConfigSchema(), dd); err != nil {
+			return err
+		}
+
+		types, err := codegen.GenerateGo(schema.Bytes(), "config", "Config")
+		if err != nil {
+			return fmt.Errorf("error generating config types: %s", err)
+		}
+
+		return writeOrPrintFile("config/config_gen.go", types)
+	}
+}
+
 // build and deployments
 // templates under deployment.go
 func createMakefile(dd Delims) CreateFileFromTemplate {
@@ -333,8 +373,19 @@ func (s *Service) createOrPrintFile(n string, b []byte, d Delims) error {
 		d.Second = "}}"
 	}
 
+	var buf bytes.Buffer
+	if err := s.handleOutput(&buf, b, d); err != nil {
+		return err
+	}
+
+	return writeOrPrintFile(n, buf.Bytes())
+}
+
+// writeOrPrintFile writes a generated file, or prints it in debug mode
+func writeOrPrintFile(n string, b []byte) error {
 	if cfg.Debug {
-		return s.handleOutput(os.Stdout, b, d)
+		_, err := os.Stdout.Write(b)
+		return err
 	}
 
 	f, err := os.Create(n)
@@ -344,7 +395,8 @@ func (s *Service) createOrPrintFile(n string, b []byte, d Delims) error {
 
 	defer f.Close()
 
-	return s.handleOutput(f, b, d)
+	_, err = f.Write(b)
+	return err
 }
 
 func (s *Service) handleOutput(w io.Writer, b []byte, d Delims) error {
@@ -0,0 +1,346 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	cwnats "github.com/CoverWhale/coverwhale-go/transports/nats"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/spf13/cobra"
+)
+
+// subcommand for discovering NATS micro services
+var servicesCmd = &cobra.Command{
+	Use:   "services",
+	Short: "Discover NATS micro services and their endpoints",
+}
+
+var servicesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List running services",
+	Args:  cobra.NoArgs,
+	RunE:  servicesList,
+}
+
+var servicesInfoCmd = &cobra.Command{
+	Use:   "info <service>",
+	Short: "Show the endpoints of a service",
+	Args:  cobra.ExactArgs(1),
+	RunE:  servicesInfo,
+}
+
+var servicesStatsCmd = &cobra.Command{
+	Use:   "stats [service]",
+	Short: "Show request stats for each service instance",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  servicesStats,
+}
+
+var servicesPingCmd = &cobra.Command{
+	Use:   "ping [service]",
+	Short: "Ping service instances",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  servicesPing,
+}
+
+var servicesSchemaCmd = &cobra.Command{
+	Use:   "schema <service> [endpoint]",
+	Short: "Print the request and response schemas of a service's endpoints",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE:  servicesSchema,
+}
+
+var servicesAsyncAPICmd = &cobra.Command{
+	Use:     "asyncapi <service>",
+	Short:   "Export an AsyncAPI document for a service",
+	Args:    cobra.ExactArgs(1),
+	Example: `  cwgoctl services asyncapi example -o asyncapi.json`,
+	RunE:    servicesAsyncAPI,
+}
+
+func init() {
+	rootCmd.AddCommand(servicesCmd)
+	servicesCmd.AddCommand(servicesListCmd, servicesInfoCmd, servicesStatsCmd, servicesPingCmd, servicesSchemaCmd, servicesAsyncAPICmd)
+	addNATSFlags(servicesCmd)
+	servicesCmd.PersistentFlags().Bool("json", false, "Print JSON instead of a table")
+	servicesAsyncAPICmd.Flags().StringP("output", "o", "", "File to write to, defaults to stdout")
+}
+
+// addNATSFlags adds the connection flags shared by commands that talk to NATS
+func addNATSFlags(cmd *cobra.Command) {
+	server := os.Getenv("NATS_URL")
+	if server == "" {
+		server = nats.DefaultURL
+	}
+
+	cmd.PersistentFlags().StringP("server", "s", server, "NATS server urls")
+	cmd.PersistentFlags().String("creds", "", "NATS credentials file")
+	cmd.PersistentFlags().Duration("timeout", cwnats.DefaultDiscoveryTimeout, "How long to wait for responses")
+}
+
+func natsConnect(cmd *cobra.Command) (*nats.Conn, error) {
+	server, _ := cmd.Flags().GetString("server")
+	creds, _ := cmd.Flags().GetString("creds")
+
+	opts := []nats.Option{nats.Name("cwgoctl")}
+	if creds != "" {
+		opts = append(opts, nats.UserCredentials(creds))
+	}
+
+	nc, err := nats.Connect(server, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %w", server, err)
+	}
+
+	return nc, nil
+}
+
+// discoverService returns the info of the first responding instance of the service
+func discoverService(cmd *cobra.Command, nc *nats.Conn, name string) (micro.Info, error) {
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	infos, err := cwnats.DiscoverServices(nc, name, timeout)
+	if err != nil {
+		return micro.Info{}, err
+	}
+	if len(infos) == 0 {
+		return micro.Info{}, fmt.Errorf("no instances of service %s responded", name)
+	}
+
+	return infos[0], nil
+}
+
+func serviceArg(args []string) string {
+	if len(args) > 0 {
+		return args[0]
+	}
+
+	return ""
+}
+
+func printJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func servicesList(cmd *cobra.Command, args []string) error {
+	nc, err := natsConnect(cmd)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	infos, err := cwnats.DiscoverServices(nc, "", timeout)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Name == infos[j].Name {
+			return infos[i].ID < infos[j].ID
+		}
+		return infos[i].Name < infos[j].Name
+	})
+
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		return printJSON(cmd.OutOrStdout(), infos)
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tID\tVERSION\tENDPOINTS\tDESCRIPTION")
+	for _, v := range infos {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", v.Name, v.ID, v.Version, len(v.Endpoints), v.Description)
+	}
+
+	return w.Flush()
+}
+
+func servicesInfo(cmd *cobra.Command, args []string) error {
+	nc, err := natsConnect(cmd)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	info, err := discoverService(cmd, nc, args[0])
+	if err != nil {
+		return err
+	}
+
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		return printJSON(cmd.OutOrStdout(), info)
+	}
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "%s %s\n", info.Name, info.Version)
+	if info.Description != "" {
+		fmt.Fprintln(out, info.Description)
+	}
+	fmt.Fprintln(out)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ENDPOINT\tSUBJECT\tQUEUE GROUP\tSCHEMAS")
+	for _, v := range info.Endpoints {
+		var schemas []string
+		for _, k := range []string{cwnats.RequestSchemaKey, cwnats.ResponseSchemaKey} {
+			if _, ok := v.Metadata[k]; ok {
+				schemas = append(schemas, strings.TrimSuffix(k, "_schema"))
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", v.Name, v.Subject, v.QueueGroup, strings.Join(schemas, ","))
+	}
+
+	return w.Flush()
+}
+
+func servicesStats(cmd *cobra.Command, args []string) error {
+	nc, err := natsConnect(cmd)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	stats, err := cwnats.ServiceStats(nc, serviceArg(args), timeout)
+	if err != nil {
+		return err
+	}
+
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		return printJSON(cmd.OutOrStdout(), stats)
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tID\tENDPOINT\tREQUESTS\tERRORS\tAVG LATENCY\tLAST ERROR")
+	for _, s := range stats {
+		for _, e := range s.Endpoints {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\n", s.Name, s.ID, e.Name, e.NumRequests, e.NumErrors, e.AverageProcessingTime, e.LastError)
+		}
+	}
+
+	return w.Flush()
+}
+
+func servicesPing(cmd *cobra.Command, args []string) error {
+	nc, err := natsConnect(cmd)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	pings, err := cwnats.PingServices(nc, serviceArg(args), timeout)
+	if err != nil {
+		return err
+	}
+	if len(pings) == 0 {
+		return fmt.Errorf("no services responded")
+	}
+
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		return printJSON(cmd.OutOrStdout(), pings)
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tID\tVERSION\tRTT")
+	for _, v := range pings {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", v.Name, v.ID, v.Version, v.RTT.Round(time.Microsecond))
+	}
+
+	return w.Flush()
+}
+
+func servicesSchema(cmd *cobra.Command, args []string) error {
+	nc, err := natsConnect(cmd)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	info, err := discoverService(cmd, nc, args[0])
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	found := false
+	for _, v := range info.Endpoints {
+		if len(args) > 1 && v.Name != args[1] {
+			continue
+		}
+		found = true
+
+		fmt.Fprintf(out, "%s (%s)\n", v.Name, v.Subject)
+		for _, k := range []string{cwnats.RequestSchemaKey, cwnats.ResponseSchemaKey} {
+			schema, ok := v.Metadata[k]
+			if !ok {
+				continue
+			}
+
+			var buf bytes.Buffer
+			if err := json.Indent(&buf, []byte(schema), "", "  "); err != nil {
+				buf.Reset()
+				buf.WriteString(schema)
+			}
+			fmt.Fprintf(out, "%s:\n%s\n", k, buf.String())
+		}
+		fmt.Fprintln(out)
+	}
+
+	if !found {
+		return fmt.Errorf("endpoint %s not found in service %s", args[1], args[0])
+	}
+
+	return nil
+}
+
+func servicesAsyncAPI(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+
+	nc, err := natsConnect(cmd)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	info, err := discoverService(cmd, nc, args[0])
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := printJSON(&buf, cwnats.AsyncAPI(info)); err != nil {
+		return err
+	}
+
+	if output == "" || cfg.Debug {
+		_, err := cmd.OutOrStdout().Write(buf.Bytes())
+		return err
+	}
+
+	return os.WriteFile(output, buf.Bytes(), 0644)
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpl
+
+func ConfigSchema() []byte {
+	return []byte(`// Config is the {{ .Name }} service config
+
+// Name of the service
+name: string | *"{{ .Name }}"
+
+// Port is the HTTP server port
+port: int & >0 | *8080
+
+// LogLevel sets the level of the logger
+log_level: "error" | "info" | "debug" | *"info"
+
+nats: #Nats
+
+// NATS holds the NATS connection settings
+#Nats: {
+	// URLs is a comma separated list of NATS servers
+	urls: string | *"nats://localhost:4222"
+
+	// Name is the connection name shown in server monitoring
+	name?: string
+
+	// CredentialsFile is the path to a NATS user credentials file
+	credentials_file?: string
+
+	// NKeyFile is the path to an NKey seed file
+	nkey_file?: string
+
+	// JWT and Seed authenticate with a user JWT and NKey seed. Use secret references such as env://NATS_SEED
+	jwt?:  string @secret()
+	seed?: string @secret()
+
+	// TLSCertFile and TLSKeyFile are a client certificate for mTLS. TLSCAFile verifies the server.
+	tls_cert_file?: string
+	tls_key_file?:  string
+	tls_ca_file?:   string
+
+	// InboxPrefix is the prefix of reply subjects
+	inbox_prefix?: string
+
+	// ConnectTimeout is how many seconds to wait for the first connection
+	connect_timeout: int & >0 | *10
+
+	// ReconnectWait is how many seconds to wait between reconnect attempts
+	reconnect_wait: int & >0 | *2
+
+	// MaxReconnects is the number of reconnect attempts. -1 reconnects forever.
+	max_reconnects: int | *-1
+}
+`)
+}
+
+func ConfigLoader() []byte {
+	return []byte(`package config
+
+import (
+    _ "embed"
+
+    cwconfig "github.com/CoverWhale/coverwhale-go/config"
+)
+
+// Schema is the CUE schema used to validate the config. The Config type is generated from it so
+// run go generate after changing the schema.
+//
+//go:embed schema.cue
+var Schema string
+
+//go:generate cwgoctl config gen --schema schema.cue --package config --type Config --output config_gen.go
+
+// Load reads the config file at path and validates it against the schema
+func Load(path string, opts ...cwconfig.Option) (Config, error) {
+    return cwconfig.Unmarshal(Config{}, Schema, path, opts...)
+}
+`)
+}
@@ -74,11 +74,13 @@ import (
     "fmt"
     "math/rand"
     "net/http"
+    "os"
     "time"
 
     "github.com/99designs/gqlgen/graphql/handler"
     "github.com/99designs/gqlgen/graphql/playground"
     "github.com/CoverWhale/logr"
+    "github.com/CoverWhale/coverwhale-go/auth"
     cwhttp "github.com/CoverWhale/coverwhale-go/transports/http"
     {{ if .EnableTelemetry -}}
     "github.com/CoverWhale/coverwhale-go/metrics"
@@ -170,19 +172,20 @@ func testing(w http.ResponseWriter, r *http.Request) error {
     return nil
 }
 
+// ExampleMiddleware authenticates requests with the API key in the API_KEY environment variable. Use
+// auth.NewJWTAuthenticator to validate tokens from an identity provider instead.
 func ExampleMiddleware(l *logr.Logger) func(h http.Handler) http.Handler {
+    keys := auth.NewAPIKeyAuthenticator(
+        auth.WithStaticKey(os.Getenv("API_KEY"), auth.APIKey{Name: "example"}),
+    )
+    authenticate := auth.Middleware(keys)
+
     return func(h http.Handler) http.Handler {
-        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-            if r.Header.Get("Authorization") == "" {
-                l.Info("unauthorized")
-                w.WriteHeader(401)
-                w.Write([]byte("unauthorized"))
-                return
-            }
-
-            l.Info("in middleware")
+        return authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            p, _ := auth.PrincipalFromContext(r.Context())
+            l.Infof("request from %s", p.Subject)
             h.ServeHTTP(w, r)
-        })
+        }))
     }
 }
 `)
@@ -490,6 +493,14 @@ func bindNatsFlags(cmd *cobra.Command) {
     viper.BindPFlag("nats_jwt", cmd.Flags().Lookup("nats-jwt"))
     viper.BindPFlag("nats_secret", cmd.Flags().Lookup("nats-secret"))
     viper.BindPFlag("credentials_file", cmd.Flags().Lookup("credentials-file"))
+    viper.BindPFlag("nats_nkey_file", cmd.Flags().Lookup("nats-nkey-file"))
+    viper.BindPFlag("nats_tls_cert_file", cmd.Flags().Lookup("nats-tls-cert-file"))
+    viper.BindPFlag("nats_tls_key_file", cmd.Flags().Lookup("nats-tls-key-file"))
+    viper.BindPFlag("nats_tls_ca_file", cmd.Flags().Lookup("nats-tls-ca-file"))
+    viper.BindPFlag("nats_inbox_prefix", cmd.Flags().Lookup("nats-inbox-prefix"))
+    viper.BindPFlag("nats_connect_timeout", cmd.Flags().Lookup("nats-connect-timeout"))
+    viper.BindPFlag("nats_reconnect_wait", cmd.Flags().Lookup("nats-reconnect-wait"))
+    viper.BindPFlag("nats_max_reconnects", cmd.Flags().Lookup("nats-max-reconnects"))
     viper.BindPFlag("use_traffic_shaping", cmd.Flags().Lookup("use-traffic-shaping"))
 }
 
@@ -499,6 +510,14 @@ func natsFlags(cmd *cobra.Command) {
     cmd.PersistentFlags().String("nats-seed", "", "NATS seed as a string")
     cmd.PersistentFlags().String("credentials-file", "", "Path to NATS user credentials file")
     cmd.PersistentFlags().String("nats-urls", "nats://localhost:4222", "NATS URLs")
+    cmd.PersistentFlags().String("nats-nkey-file", "", "Path to NATS NKey seed file")
+    cmd.PersistentFlags().String("nats-tls-cert-file", "", "Path to NATS client certificate")
+    cmd.PersistentFlags().String("nats-tls-key-file", "", "Path to NATS client certificate key")
+    cmd.PersistentFlags().String("nats-tls-ca-file", "", "Path to CA to verify the NATS server")
+    cmd.PersistentFlags().String("nats-inbox-prefix", "", "Prefix of NATS reply subjects")
+    cmd.PersistentFlags().Int("nats-connect-timeout", 10, "Seconds to wait for the first NATS connection")
+    cmd.PersistentFlags().Int("nats-reconnect-wait", 2, "Seconds to wait between NATS reconnect attempts")
+    cmd.PersistentFlags().Int("nats-max-reconnects", -1, "NATS reconnect attempts, -1 reconnects forever")
     cmd.PersistentFlags().Bool("use-traffic-shaping", false, "Local development connection")
 }
 
@@ -522,30 +541,45 @@ func NatsHelper() []byte {
 import (
 	"os"
 
-        "github.com/CoverWhale/logr"
-        "github.com/nats-io/jsm.go/natscontext"
-        "github.com/nats-io/nats.go"
-        "github.com/spf13/viper"
+	cwconfig "github.com/CoverWhale/coverwhale-go/config"
+	cwnats "github.com/CoverWhale/coverwhale-go/transports/nats"
+	"github.com/CoverWhale/logr"
+	"github.com/nats-io/jsm.go/natscontext"
+	"github.com/nats-io/nats.go"
+	"github.com/spf13/viper"
 )
 
 func newNatsConnection(name string) (*nats.Conn, error) {
-	opts := []nats.Option{nats.Name(name), nats.MaxReconnects(-1)}
-
-        _, ok := os.LookupEnv("USER")
+	_, ok := os.LookupEnv("USER")
 
-        if viper.GetString("credentials_file") == "" && viper.GetString("nats_jwt") == "" && ok {
-                logr.Debug("using NATS context")
-                return natscontext.Connect("", opts...)
-        }
+	if viper.GetString("credentials_file") == "" && viper.GetString("nats_jwt") == "" && viper.GetString("nats_nkey_file") == "" && ok {
+		logr.Debug("using NATS context")
+		return natscontext.Connect("", nats.Name(name), nats.MaxReconnects(-1))
+	}
 
-        if viper.GetString("nats_jwt") != "" {
-                opts = append(opts, nats.UserJWTAndSeed(viper.GetString("nats_jwt"), viper.GetString("nats_seed")))
-        }
-        if viper.GetString("credentials_file") != "" {
-                opts = append(opts, nats.UserCredentials(viper.GetString("credentials_file")))
-        }
+	// the fields are the nats section of config/schema.cue. A config.NATS loaded with config.Load can be
+	// passed instead with cwnats.ConnectionConfig(cfg.NATS).
+	client := cwnats.NewNATSClient("", nil, cwnats.SetConnectionConfig(cwnats.ConnectionConfig{
+		URLs:            viper.GetString("nats_urls"),
+		Name:            name,
+		CredentialsFile: viper.GetString("credentials_file"),
+		NKeyFile:        viper.GetString("nats_nkey_file"),
+		JWT:             cwconfig.Secret(viper.GetString("nats_jwt")),
+		Seed:            cwconfig.Secret(viper.GetString("nats_seed")),
+		TLSCertFile:     viper.GetString("nats_tls_cert_file"),
+		TLSKeyFile:      viper.GetString("nats_tls_key_file"),
+		TLSCAFile:       viper.GetString("nats_tls_ca_file"),
+		InboxPrefix:     viper.GetString("nats_inbox_prefix"),
+		ConnectTimeout:  viper.GetInt("nats_connect_timeout"),
+		ReconnectWait:   viper.GetInt("nats_reconnect_wait"),
+		MaxReconnects:   viper.GetInt("nats_max_reconnects"),
+	}))
+
+	if err := client.Connect(); err != nil {
+		return nil, err
+	}
 
-        return nats.Connect(viper.GetString("nats_urls"), opts...)
+	return client.Conn, nil
 }
 `)
 }
@@ -0,0 +1,249 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CoverWhale/coverwhale-go/config"
+)
+
+var schema = `
+// Config is the service config
+
+// Data holds nested data
+#Data: {
+	// SomeValue is a value
+	SomeValue: string | *"test"
+}
+
+// Port is the listening port
+Port: int | *8080
+Address?: string
+Ratio: number
+Tags: [...string]
+Labels: [string]: string
+Data: #Data
+Items: [...#Data]
+nats_url: string
+urls: string
+api_key: string @secret()
+tokens?: [...string] @secret()
+`
+
+var goSource = `package config
+
+// AppConfig is the application config
+type AppConfig struct {
+	// Port is the listening port
+	Port     int               ` + "`json:\"port\"`" + `
+	Password config.Secret     ` + "`json:\"password\"`" + `
+	Address *string
+	Tags    []string          ` + "`json:\"tags,omitempty\"`" + `
+	Labels  map[string]string
+	Data    Data
+	ignored string
+}
+
+// Data holds nested data
+type Data struct {
+	SomeValue string
+	Ratio     float64
+}
+`
+
+func TestGenerateGo(t *testing.T) {
+	out, err := GenerateGo([]byte(schema), "config", "Config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		Header,
+		"package config",
+		`import cwconfig "github.com/CoverWhale/coverwhale-go/config"`,
+		"// Config is the service config\ntype Config struct {",
+		"// Port is the listening port",
+		"Port int `json:\"Port\"`",
+		"Address string `json:\"Address,omitempty\"`",
+		"Ratio float64 `json:\"Ratio\"`",
+		"Tags []string `json:\"Tags\"`",
+		"Labels map[string]string `json:\"Labels\"`",
+		"Data Data `json:\"Data\"`",
+		"Items []Data `json:\"Items\"`",
+		"NATSURL string `json:\"nats_url\"`",
+		"URLs string `json:\"urls\"`",
+		"APIKey cwconfig.Secret `json:\"api_key\"`",
+		"Tokens []cwconfig.Secret `json:\"tokens,omitempty\"`",
+		"// Data holds nested data",
+		"type Data struct {",
+		"// SomeValue is a value",
+	}
+
+	for _, v := range want {
+		if !strings.Contains(normalize(string(out)), v) {
+			t.Errorf("expected generated code to contain %q but got\n%s", v, out)
+		}
+	}
+}
+
+func TestGenerateCUE(t *testing.T) {
+	tt := []struct {
+		name     string
+		typeName string
+		want     []string
+		err      error
+	}{
+		{
+			name:     "struct",
+			typeName: "AppConfig",
+			want: []string{
+				"// AppConfig is the application config\n\n",
+				"password: string @secret()",
+				"// Port is the listening port",
+				"port: int",
+				"Address?: string",
+				"tags?: [...string]",
+				"Labels: {[string]: string}",
+				"Data: #Data",
+				"// Data holds nested data",
+				"#Data: {",
+				"SomeValue: string",
+				"Ratio: number",
+			},
+		},
+		{name: "missing type", typeName: "Missing", err: ErrTypeNotFound},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			out, err := GenerateCUE([]byte(goSource), v.typeName)
+			if !errors.Is(err, v.err) {
+				t.Fatalf("expected error %v but got %v", v.err, err)
+			}
+
+			for _, w := range v.want {
+				if !strings.Contains(normalize(string(out)), w) {
+					t.Errorf("expected generated schema to contain %q but got\n%s", w, out)
+				}
+			}
+
+			if strings.Contains(string(out), "ignored") {
+				t.Errorf("expected unexported fields to be skipped but got\n%s", out)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	cue, err := GenerateCUE([]byte(goSource), "AppConfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GenerateGo(cue, "config", "AppConfig"); err != nil {
+		t.Errorf("expected generated schema to compile but got %v\n%s", err, cue)
+	}
+}
+
+func TestGenerateGoDuplicateType(t *testing.T) {
+	schema := `
+server: {
+	port: int
+}
+
+#Server: {
+	host: string
+}
+
+backup: #Server
+`
+
+	if _, err := GenerateGo([]byte(schema), "config", "Config"); !errors.Is(err, ErrDuplicateType) {
+		t.Errorf("expected %v but got %v", ErrDuplicateType, err)
+	}
+}
+
+const durationSource = `package config
+
+import "time"
+
+type ServerConfig struct {
+	Timeout time.Duration ` + "`json:\"timeout\"`" + `
+}
+`
+
+type durationConfig struct {
+	Timeout time.Duration `json:"timeout"`
+}
+
+func TestDurationRoundTrip(t *testing.T) {
+	schema, err := GenerateCUE([]byte(durationSource), "ServerConfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fp := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(fp, []byte(`{"timeout": 5000000000}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.Unmarshal(durationConfig{}, string(schema), fp)
+	if err != nil {
+		t.Fatalf("expected generated schema to decode but got %v\n%s", err, schema)
+	}
+	if cfg.Timeout != 5*time.Second {
+		t.Errorf("expected timeout 5s but got %s", cfg.Timeout)
+	}
+}
+
+func TestExportedName(t *testing.T) {
+	tt := []struct {
+		label string
+		want  string
+	}{
+		{label: "nats_url", want: "NATSURL"},
+		{label: "urls", want: "URLs"},
+		{label: "api-key", want: "APIKey"},
+		{label: "tls_ca_file", want: "TLSCAFile"},
+		{label: "nkey_file", want: "NKeyFile"},
+		{label: "SomeValue", want: "SomeValue"},
+		{label: "status", want: "Status"},
+		{label: "1st", want: "X1st"},
+	}
+
+	for _, v := range tt {
+		t.Run(v.label, func(t *testing.T) {
+			if got := exportedName(v.label); got != v.want {
+				t.Errorf("expected %s but got %s", v.want, got)
+			}
+		})
+	}
+}
+
+// normalize collapses the alignment whitespace added by the formatters
+func normalize(s string) string {
+	var lines []string
+	for _, v := range strings.Split(s, "\n") {
+		lines = append(lines, strings.Join(strings.Fields(v), " "))
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,264 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrTypeNotFound = fmt.Errorf("type not found")
+	ErrNotStruct    = fmt.Errorf("type is not a struct")
+	// ErrDuplicateType is returned when two CUE structs, such as a server field and a #Server definition,
+	// would generate Go types with the same name
+	ErrDuplicateType = fmt.Errorf("duplicate type name")
+)
+
+type cueGenerator struct {
+	structs map[string]*ast.TypeSpec
+	defs    []string
+	seen    map[string]bool
+	buf     bytes.Buffer
+}
+
+// GenerateCUE parses Go source and returns a CUE schema for the struct named typeName. The fields of the
+// struct become the top level fields of the schema and any other structs from the same source that it uses
+// become definitions. Field names follow the json tag, omitempty and pointer fields become optional, and Go
+// doc comments are kept. config.Secret fields get the @secret() attribute.
+func GenerateCUE(src []byte, typeName string) ([]byte, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &cueGenerator{
+		structs: make(map[string]*ast.TypeSpec),
+		seen:    make(map[string]bool),
+	}
+
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			// doc comments on single type declarations are attached to the GenDecl
+			if ts.Doc == nil && len(gd.Specs) == 1 {
+				ts.Doc = gd.Doc
+			}
+			g.structs[ts.Name.Name] = ts
+		}
+	}
+
+	root, ok := g.structs[typeName]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTypeNotFound, typeName)
+	}
+
+	st, ok := root.Type.(*ast.StructType)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotStruct, typeName)
+	}
+
+	g.seen[typeName] = true
+	var body bytes.Buffer
+	// the blank line keeps the root doc from attaching to the first field
+	if root.Doc != nil {
+		writeCUEComment(&body, root.Doc.Text(), "")
+		body.WriteString("\n")
+	}
+	g.writeFields(&body, st, "")
+
+	// definitions are written after the fields since they are collected while walking them
+	for i := 0; i < len(g.defs); i++ {
+		ts := g.structs[g.defs[i]]
+		body.WriteString("\n")
+		writeCUEComment(&body, ts.Doc.Text(), "")
+		fmt.Fprintf(&body, "#%s: {\n", ts.Name.Name)
+		g.writeFields(&body, ts.Type.(*ast.StructType), "\t")
+		body.WriteString("}\n")
+	}
+
+	return body.Bytes(), nil
+}
+
+func (g *cueGenerator) writeFields(buf *bytes.Buffer, st *ast.StructType, indent string) {
+	for _, field := range st.Fields.List {
+		name, optional, skip := fieldName(field)
+		if skip {
+			continue
+		}
+
+		if _, ok := field.Type.(*ast.StarExpr); ok {
+			optional = true
+		}
+
+		writeCUEComment(buf, field.Doc.Text(), indent)
+		if optional {
+			name += "?"
+		}
+		var attr string
+		if isSecret(field.Type) {
+			attr = fmt.Sprintf(" @%s()", SecretAttribute)
+		}
+		fmt.Fprintf(buf, "%s%s: %s%s\n", indent, name, g.cueType(field.Type, indent), attr)
+	}
+}
+
+// isSecret reports whether a field is a config.Secret or a pointer, slice, or map of them
+func isSecret(expr ast.Expr) bool {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return isSecret(t.X)
+	case *ast.ArrayType:
+		return isSecret(t.Elt)
+	case *ast.MapType:
+		return isSecret(t.Value)
+	case *ast.SelectorExpr:
+		return t.Sel.Name == "Secret"
+	}
+
+	return false
+}
+
+// fieldName returns the CUE label for a struct field, whether it is optional, and whether it should be skipped
+func fieldName(field *ast.Field) (string, bool, bool) {
+	// embedded and unexported fields aren't decoded by CUE
+	if len(field.Names) == 0 || !field.Names[0].IsExported() {
+		return "", false, true
+	}
+
+	name := field.Names[0].Name
+	var optional bool
+
+	if field.Tag != nil {
+		tag, err := strconv.Unquote(field.Tag.Value)
+		if err == nil {
+			if jsonTag, ok := reflect.StructTag(tag).Lookup("json"); ok {
+				parts := strings.Split(jsonTag, ",")
+				if parts[0] == "-" {
+					return "", false, true
+				}
+				if parts[0] != "" {
+					name = parts[0]
+				}
+				for _, v := range parts[1:] {
+					if v == "omitempty" {
+						optional = true
+					}
+				}
+			}
+		}
+	}
+
+	if !isIdentifier(name) {
+		name = strconv.Quote(name)
+	}
+
+	return name, optional, false
+}
+
+func (g *cueGenerator) cueType(expr ast.Expr, indent string) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return g.cueType(t.X, indent)
+	case *ast.ArrayType:
+		if ident, ok := t.Elt.(*ast.Ident); ok && ident.Name == "byte" {
+			return "bytes"
+		}
+		return fmt.Sprintf("[...%s]", g.cueType(t.Elt, indent))
+	case *ast.MapType:
+		return fmt.Sprintf("{[string]: %s}", g.cueType(t.Value, indent))
+	case *ast.StructType:
+		var buf bytes.Buffer
+		buf.WriteString("{\n")
+		g.writeFields(&buf, t, indent+"\t")
+		buf.WriteString(indent + "}")
+		return buf.String()
+	case *ast.SelectorExpr:
+		// the config package's Secret type is decoded from a string and time.Duration from its nanoseconds
+		switch t.Sel.Name {
+		case "Secret":
+			return "string"
+		case "Duration":
+			return "int"
+		}
+		return "_"
+	case *ast.Ident:
+		switch t.Name {
+		case "string":
+			return "string"
+		case "bool":
+			return "bool"
+		case "int", "int8", "int16", "int32", "int64":
+			return "int"
+		case "uint", "uint8", "uint16", "uint32", "uint64":
+			return "int & >=0"
+		case "float32", "float64":
+			return "number"
+		case "any":
+			return "_"
+		}
+
+		ts, ok := g.structs[t.Name]
+		if !ok {
+			return "_"
+		}
+		if _, ok := ts.Type.(*ast.StructType); !ok {
+			// named non-struct types such as type Level string use their underlying type
+			return g.cueType(ts.Type, indent)
+		}
+		if !g.seen[t.Name] {
+			g.seen[t.Name] = true
+			g.defs = append(g.defs, t.Name)
+		}
+		return "#" + t.Name
+	default:
+		return "_"
+	}
+}
+
+func writeCUEComment(buf *bytes.Buffer, doc, indent string) {
+	doc = strings.TrimSpace(doc)
+	if doc == "" {
+		return
+	}
+
+	for _, line := range strings.Split(doc, "\n") {
+		fmt.Fprintf(buf, "%s// %s\n", indent, line)
+	}
+}
+
+func isIdentifier(s string) bool {
+	for i, r := range s {
+		if r == '_' || r == '$' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			continue
+		}
+		if i > 0 && r >= '0' && r <= '9' {
+			continue
+		}
+		return false
+	}
+
+	return s != ""
+}
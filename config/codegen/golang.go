@@ -0,0 +1,290 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package codegen keeps CUE config schemas and the Go structs passed to config.Unmarshal in sync by
+// generating one from the other.
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+)
+
+const (
+	// Header is added to the top of every generated Go file
+	Header = "// Code generated by cwgoctl config gen. DO NOT EDIT."
+	// SecretAttribute marks a CUE string field, such as password: string @secret(), that is generated as a
+	// config.Secret so it is redacted
+	SecretAttribute = "secret"
+
+	secretImport = `cwconfig "github.com/CoverWhale/coverwhale-go/config"`
+	secretType   = "cwconfig.Secret"
+)
+
+// commonInitialisms are written in upper case in generated identifiers, like golint's list
+var commonInitialisms = map[string]string{
+	"acl": "ACL", "api": "API", "ascii": "ASCII", "ca": "CA", "cpu": "CPU", "css": "CSS", "dns": "DNS",
+	"eof": "EOF", "guid": "GUID", "html": "HTML", "http": "HTTP", "https": "HTTPS", "id": "ID", "ip": "IP",
+	"json": "JSON", "jwt": "JWT", "kv": "KV", "nats": "NATS", "nkey": "NKey", "qps": "QPS", "ram": "RAM",
+	"rpc": "RPC", "sla": "SLA", "smtp": "SMTP", "sql": "SQL", "ssh": "SSH", "tcp": "TCP", "tls": "TLS",
+	"ttl": "TTL", "udp": "UDP", "ui": "UI", "uid": "UID", "uri": "URI", "url": "URL", "utf8": "UTF8",
+	"uuid": "UUID", "vm": "VM", "xml": "XML", "xsrf": "XSRF", "xss": "XSS",
+}
+
+type goType struct {
+	name   string
+	doc    string
+	fields []goField
+}
+
+type goField struct {
+	name string
+	typ  string
+	tag  string
+	doc  string
+}
+
+type goGenerator struct {
+	types []*goType
+	// seen is where each type name was generated from, so two structs with the same name are an error
+	seen    map[string]string
+	secrets bool
+}
+
+// GenerateGo compiles a CUE schema and returns Go source for package pkg containing a struct named typeName
+// for the top level fields of the schema. Definitions such as #Data become their own types, doc comments on
+// CUE fields become Go doc comments, and optional fields are tagged with omitempty. A comment at the top of the
+// schema followed by a blank line becomes the doc comment of the root type. Fields with the @secret()
+// attribute are generated as config.Secret. Structs that would generate types with the same name, such as a
+// server field and a #Server definition, return ErrDuplicateType.
+func GenerateGo(schema []byte, pkg, typeName string) ([]byte, error) {
+	v := cuecontext.New().CompileBytes(schema)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	g := &goGenerator{
+		seen: make(map[string]string),
+	}
+
+	if err := g.structType(typeName, "the schema root", docText(v), v, true); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s\n\npackage %s\n", Header, pkg)
+	if g.secrets {
+		fmt.Fprintf(&buf, "\nimport %s\n", secretImport)
+	}
+	for _, t := range g.types {
+		buf.WriteString("\n")
+		writeComment(&buf, t.doc, "")
+		fmt.Fprintf(&buf, "type %s struct {\n", t.name)
+		for _, f := range t.fields {
+			writeComment(&buf, f.doc, "\t")
+			fmt.Fprintf(&buf, "\t%s %s `%s`\n", f.name, f.typ, f.tag)
+		}
+		buf.WriteString("}\n")
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+// structType adds a Go type for the struct value v and any types it depends on. Definitions are only
+// collected from the root value since that's where the schemas in this repo declare them. source is the
+// definition or field the struct comes from.
+func (g *goGenerator) structType(name, source, doc string, v cue.Value, root bool) error {
+	if seen, ok := g.seen[name]; ok {
+		if seen != source {
+			return fmt.Errorf("%w: %s is generated for both %s and %s", ErrDuplicateType, name, seen, source)
+		}
+		return nil
+	}
+	g.seen[name] = source
+
+	t := &goType{name: name, doc: doc}
+	g.types = append(g.types, t)
+
+	iter, err := v.Fields(cue.Definitions(root), cue.Optional(true))
+	if err != nil {
+		return err
+	}
+
+	for iter.Next() {
+		sel := iter.Selector()
+		fv := iter.Value()
+
+		if sel.IsDefinition() {
+			def := exportedName(strings.TrimPrefix(sel.String(), "#"))
+			if err := g.structType(def, sel.String(), docText(fv), fv, false); err != nil {
+				return err
+			}
+			continue
+		}
+
+		label := unquote(sel.String())
+		attr := fv.Attribute(SecretAttribute)
+		secret := attr.Err() == nil
+		typ, err := g.typeOf(name, exportedName(label), fv, secret)
+		if err != nil {
+			return err
+		}
+
+		tag := label
+		if iter.IsOptional() {
+			tag = fmt.Sprintf("%s,omitempty", tag)
+		}
+
+		t.fields = append(t.fields, goField{
+			name: exportedName(label),
+			typ:  typ,
+			tag:  fmt.Sprintf("json:%q", tag),
+			doc:  docText(fv),
+		})
+	}
+
+	return nil
+}
+
+// typeOf maps a CUE value to a Go type, generating named types for nested structs. Strings in secret fields,
+// including list and map elements, are config.Secret.
+func (g *goGenerator) typeOf(parent, field string, v cue.Value, secret bool) (string, error) {
+	if def, sel, ok := definitionName(v); ok {
+		if err := g.structType(def, sel, docText(v), v, false); err != nil {
+			return "", err
+		}
+		return def, nil
+	}
+
+	switch v.IncompleteKind() {
+	case cue.StringKind:
+		if secret {
+			g.secrets = true
+			return secretType, nil
+		}
+		return "string", nil
+	case cue.IntKind:
+		return "int", nil
+	case cue.FloatKind, cue.NumberKind:
+		return "float64", nil
+	case cue.BoolKind:
+		return "bool", nil
+	case cue.BytesKind:
+		return "[]byte", nil
+	case cue.ListKind:
+		elem, err := g.typeOf(parent, field+"Item", v.LookupPath(cue.MakePath(cue.AnyIndex)), secret)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + elem, nil
+	case cue.StructKind:
+		if pattern := v.LookupPath(cue.MakePath(cue.AnyString)); pattern.Exists() {
+			elem, err := g.typeOf(parent, field+"Value", pattern, secret)
+			if err != nil {
+				return "", err
+			}
+			return "map[string]" + elem, nil
+		}
+
+		name := field
+		if parent != "" && len(g.types) > 0 && g.types[0].name != parent {
+			name = parent + field
+		}
+		if err := g.structType(name, "field "+v.Path().String(), "", v, false); err != nil {
+			return "", err
+		}
+		return name, nil
+	default:
+		return "any", nil
+	}
+}
+
+// definitionName returns the Go type name and the definition for a value that references a definition, such
+// as Data: #Data
+func definitionName(v cue.Value) (string, string, bool) {
+	_, p := v.ReferencePath()
+	sels := p.Selectors()
+	if len(sels) == 0 || !sels[len(sels)-1].IsDefinition() {
+		return "", "", false
+	}
+
+	def := sels[len(sels)-1].String()
+	return exportedName(strings.TrimPrefix(def, "#")), def, true
+}
+
+func docText(v cue.Value) string {
+	var docs []string
+	for _, d := range v.Doc() {
+		docs = append(docs, strings.TrimSpace(d.Text()))
+	}
+
+	return strings.Join(docs, "\n")
+}
+
+func writeComment(buf *bytes.Buffer, doc, indent string) {
+	if doc == "" {
+		return
+	}
+
+	for _, line := range strings.Split(doc, "\n") {
+		fmt.Fprintf(buf, "%s// %s\n", indent, line)
+	}
+}
+
+func unquote(s string) string {
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+
+	return s
+}
+
+// exportedName converts labels such as nats_url or api-key into exported Go identifiers such as NATSURL and
+// APIKey. Initialisms and their plurals, such as urls, are upper case.
+func exportedName(label string) string {
+	parts := strings.FieldsFunc(label, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var b strings.Builder
+	for _, p := range parts {
+		lower := strings.ToLower(p)
+		if initialism, ok := commonInitialisms[lower]; ok {
+			b.WriteString(initialism)
+			continue
+		}
+		if initialism, ok := commonInitialisms[strings.TrimSuffix(lower, "s")]; ok && strings.HasSuffix(lower, "s") {
+			b.WriteString(initialism + "s")
+			continue
+		}
+
+		r := []rune(p)
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+
+	name := b.String()
+	if name == "" || unicode.IsDigit([]rune(name)[0]) {
+		name = "X" + name
+	}
+
+	return name
+}
@@ -19,6 +19,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 
 	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/cuecontext"
@@ -35,9 +36,13 @@ type cueConfig[T any] struct {
 	schema     string
 	filePath   string
 	userConfig T
+	options    options
 }
 
-func Unmarshal[T any](config T, schema, filePath string) (T, error) {
+// Unmarshal loads the file at filePath, unifies it with the CUE schema, and decodes the result into config.
+// Any string values that are secret references, such as env://VAR, file:///run/secrets/x, or a scheme registered
+// with WithResolver, are replaced with the resolved secret.
+func Unmarshal[T any](config T, schema, filePath string, opts ...Option) (T, error) {
 	ext := filepath.Ext(filePath)
 
 	cfg := cueConfig[T]{
@@ -46,6 +51,7 @@ func Unmarshal[T any](config T, schema, filePath string) (T, error) {
 		schema:     schema,
 		filePath:   filePath,
 		userConfig: config,
+		options:    newOptions(opts...),
 	}
 
 	switch ext {
@@ -91,5 +97,9 @@ func (c *cueConfig[T]) loadCueConfig() (T, error) {
 		return c.userConfig, err
 	}
 
+	if err := c.options.resolveSecrets(reflect.ValueOf(&c.userConfig), ""); err != nil {
+		return c.userConfig, err
+	}
+
 	return c.userConfig, nil
 }
@@ -0,0 +1,50 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"time"
+
+	"github.com/CoverWhale/coverwhale-go/metrics"
+	"github.com/CoverWhale/logr"
+)
+
+// Option is a functional option to modify how the config is loaded
+type Option func(*options)
+
+type options struct {
+	resolvers     map[string]SecretResolver
+	strictSecrets bool
+	exporter      *metrics.Exporter
+	logger        *logr.Logger
+	debounce      time.Duration
+}
+
+func newOptions(opts ...Option) options {
+	o := options{
+		resolvers: map[string]SecretResolver{
+			EnvScheme:  ResolverFunc(resolveEnv),
+			FileScheme: ResolverFunc(resolveFile),
+		},
+		logger:   logr.NewLogger(),
+		debounce: 100 * time.Millisecond,
+	}
+
+	for _, v := range opts {
+		v(&o)
+	}
+
+	return o
+}
@@ -0,0 +1,240 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	EnvScheme    = "env"
+	FileScheme   = "file"
+	NATSKVScheme = "nats-kv"
+
+	redacted = "[REDACTED]"
+)
+
+var (
+	ErrSecretNotFound = fmt.Errorf("secret not found")
+	ErrInvalidSecret  = fmt.Errorf("invalid secret reference")
+	// ErrPlainSecret is returned with WithStrictSecrets for a secret reference in a field that isn't a Secret,
+	// since the resolved value wouldn't be redacted
+	ErrPlainSecret = fmt.Errorf("secret reference must be in a config.Secret field")
+
+	secretType = reflect.TypeOf(Secret(""))
+)
+
+// SecretResolver resolves the part of a secret reference after the scheme, for example
+// VAR in env://VAR, into the secret value.
+type SecretResolver interface {
+	Resolve(ref string) (string, error)
+}
+
+// ResolverFunc allows a plain function to be used as a SecretResolver
+type ResolverFunc func(string) (string, error)
+
+// Resolve satisfies the SecretResolver interface
+func (f ResolverFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+// Secret is a string that is redacted whenever it is printed, logged, or marshaled to JSON.
+// Use Value to get the actual secret.
+type Secret string
+
+// Value returns the unredacted secret
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// String satisfies the fmt.Stringer interface and redacts the secret
+func (s Secret) String() string {
+	return redacted
+}
+
+// GoString redacts the secret when printed with %#v
+func (s Secret) GoString() string {
+	return redacted
+}
+
+// MarshalJSON redacts the secret when the config is encoded as JSON
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redacted)
+}
+
+// WithResolver registers a SecretResolver for a scheme. Registering a scheme that already exists replaces
+// the existing resolver.
+func WithResolver(scheme string, r SecretResolver) Option {
+	return func(o *options) {
+		o.resolvers[scheme] = r
+	}
+}
+
+// WithStrictSecrets fails loading with ErrPlainSecret when a string that isn't a config.Secret holds a reference
+// for a registered scheme. Without it those strings, such as file:// paths, are left alone.
+func WithStrictSecrets() Option {
+	return func(o *options) {
+		o.strictSecrets = true
+	}
+}
+
+// WithNATSKVResolver registers a resolver for nats-kv://bucket/key references
+func WithNATSKVResolver(js nats.JetStreamContext) Option {
+	return WithResolver(NATSKVScheme, NewNATSKVResolver(js))
+}
+
+// NewNATSKVResolver returns a SecretResolver that looks up bucket/key references in a JetStream key value store
+func NewNATSKVResolver(js nats.JetStreamContext) SecretResolver {
+	return ResolverFunc(func(ref string) (string, error) {
+		bucket, key, ok := strings.Cut(ref, "/")
+		if !ok || bucket == "" || key == "" {
+			return "", fmt.Errorf("%w: %s://%s", ErrInvalidSecret, NATSKVScheme, ref)
+		}
+
+		kv, err := js.KeyValue(bucket)
+		if err != nil {
+			return "", err
+		}
+
+		entry, err := kv.Get(key)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s://%s: %v", ErrSecretNotFound, NATSKVScheme, ref, err)
+		}
+
+		return string(entry.Value()), nil
+	})
+}
+
+func resolveEnv(ref string) (string, error) {
+	val, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("%w: %s://%s", ErrSecretNotFound, EnvScheme, ref)
+	}
+
+	return val, nil
+}
+
+func resolveFile(ref string) (string, error) {
+	data, err := os.ReadFile(ref)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s://%s: %v", ErrSecretNotFound, FileScheme, ref, err)
+	}
+
+	// mounted secrets commonly end with a newline which is never part of the secret
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// resolveSecrets walks the decoded config and replaces any Secret that is a reference with a registered scheme
+// with the resolved value. A reference in any other string is an error so resolved secrets are always redacted.
+// Strings with unregistered schemes, such as http://, are left alone.
+func (o options) resolveSecrets(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Interface {
+			// values inside of an interface can't be set so resolve a copy and put it back
+			elem := reflect.New(v.Elem().Type()).Elem()
+			elem.Set(v.Elem())
+			if err := o.resolveSecrets(elem, path); err != nil {
+				return err
+			}
+			if v.CanSet() {
+				v.Set(elem)
+			}
+			return nil
+		}
+		return o.resolveSecrets(v.Elem(), path)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if err := o.resolveSecrets(v.Field(i), joinFieldPath(path, field.Name)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := o.resolveSecrets(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(iter.Value().Type()).Elem()
+			elem.Set(iter.Value())
+			if err := o.resolveSecrets(elem, fmt.Sprintf("%s[%v]", path, iter.Key())); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	case reflect.String:
+		scheme, ok := o.scheme(v.String())
+		if !ok {
+			return nil
+		}
+		if v.Type() != secretType {
+			if o.strictSecrets {
+				return fmt.Errorf("%w: %s uses %s://", ErrPlainSecret, path, scheme)
+			}
+			return nil
+		}
+
+		resolved, err := o.resolve(v.String())
+		if err != nil {
+			return err
+		}
+		if v.CanSet() {
+			v.SetString(resolved)
+		}
+	}
+
+	return nil
+}
+
+func joinFieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+// scheme returns the scheme of s if it is a reference for a registered scheme
+func (o options) scheme(s string) (string, bool) {
+	scheme, _, ok := strings.Cut(s, "://")
+	if !ok {
+		return "", false
+	}
+
+	_, ok = o.resolvers[scheme]
+	return scheme, ok
+}
+
+// resolve returns the resolved secret for a reference with a registered scheme
+func (o options) resolve(s string) (string, error) {
+	scheme, ref, _ := strings.Cut(s, "://")
+	return o.resolvers[scheme].Resolve(ref)
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type secretConfig struct {
+	Name     string
+	Password Secret
+	Headers  map[string]Secret
+}
+
+var secretSchema = `
+Name: string
+Password: string
+Headers: [string]: string
+`
+
+func TestUnmarshalSecrets(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CW_TEST_PASSWORD", "from-env")
+
+	custom := WithResolver("vault", ResolverFunc(func(ref string) (string, error) {
+		return strings.ToUpper(ref), nil
+	}))
+
+	tt := []struct {
+		name string
+		data string
+		opts []Option
+		want secretConfig
+		err  error
+	}{
+		{name: "env", data: `{"Name": "test", "Password": "env://CW_TEST_PASSWORD"}`, want: secretConfig{Name: "test", Password: "from-env"}},
+		{name: "file", data: fmt.Sprintf(`{"Name": "test", "Password": "file://%s"}`, secretFile), want: secretConfig{Name: "test", Password: "from-file"}},
+		{name: "custom resolver", data: `{"Name": "test", "Password": "vault://abc", "Headers": {"api-key": "vault://key"}}`, opts: []Option{custom}, want: secretConfig{Name: "test", Password: "ABC", Headers: map[string]Secret{"api-key": "KEY"}}},
+		{name: "unregistered scheme", data: `{"Name": "http://localhost", "Password": "plain"}`, want: secretConfig{Name: "http://localhost", Password: "plain"}},
+		{name: "missing env", data: `{"Name": "test", "Password": "env://CW_TEST_MISSING"}`, err: ErrSecretNotFound},
+		{name: "reference in plain string", data: `{"Name": "file:///x", "Password": "plain"}`, want: secretConfig{Name: "file:///x", Password: "plain"}},
+		{name: "strict reference in plain string", data: `{"Name": "env://CW_TEST_PASSWORD", "Password": "plain"}`, opts: []Option{WithStrictSecrets()}, err: ErrPlainSecret},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			fp := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(fp, []byte(v.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := Unmarshal(secretConfig{}, secretSchema, fp, v.opts...)
+			if !errors.Is(err, v.err) {
+				t.Fatalf("expected error %v but got %v", v.err, err)
+			}
+			if v.err != nil {
+				return
+			}
+
+			if config.Name != v.want.Name || config.Password.Value() != v.want.Password.Value() {
+				t.Errorf("expected %#v but got %#v", v.want, config)
+			}
+
+			for k, want := range v.want.Headers {
+				if config.Headers[k].Value() != want.Value() {
+					t.Errorf("expected header %s to be %s but got %s", k, want.Value(), config.Headers[k].Value())
+				}
+			}
+		})
+	}
+}
+
+func TestSecretRedaction(t *testing.T) {
+	cfg := secretConfig{Name: "test", Password: "hunter2"}
+
+	printed := []string{
+		fmt.Sprintf("%v", cfg),
+		fmt.Sprintf("%+v", cfg),
+		fmt.Sprintf("%s", cfg.Password),
+		fmt.Sprintf("%#v", cfg.Password),
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed = append(printed, string(data))
+
+	for _, v := range printed {
+		if strings.Contains(v, "hunter2") {
+			t.Errorf("expected secret to be redacted but got %s", v)
+		}
+	}
+}
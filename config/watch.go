@@ -0,0 +1,209 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/CoverWhale/coverwhale-go/metrics"
+	"github.com/CoverWhale/logr"
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Watcher holds the latest valid config loaded from a file and reloads it whenever the file changes.
+// Kubernetes ConfigMap updates, which swap a symlink instead of writing to the file, are also detected.
+type Watcher[T any] struct {
+	config   T
+	schema   string
+	filePath string
+	opts     []Option
+	options  options
+
+	mu      sync.RWMutex
+	current T
+	subs    map[int]chan T
+	nextSub int
+
+	reloads *prometheus.CounterVec
+}
+
+// reloads is shared by every Watcher, labeled by file, since a collector can only be registered once
+var reloads = metrics.NewCounterVec("config_reloads_total", "Config reloads by result", []string{"file", "result"})
+
+// WithExporter adds the reload metrics of a Watcher to the exporter so they are registered when the
+// server starts. Watchers share the metrics, so several can use the same exporter. It has no effect on
+// Unmarshal.
+func WithExporter(e *metrics.Exporter) Option {
+	return func(o *options) {
+		o.exporter = e
+	}
+}
+
+// WithLogger sets the logger used by a Watcher to report reloads. It has no effect on Unmarshal.
+func WithLogger(l *logr.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithDebounce sets how long a Watcher waits for file events to settle before reloading. Editors and
+// ConfigMap updates often produce several events for a single change. It has no effect on Unmarshal.
+func WithDebounce(d time.Duration) Option {
+	return func(o *options) {
+		o.debounce = d
+	}
+}
+
+// NewWatcher loads the config the same way as Unmarshal and returns a Watcher holding it. Call Watch to
+// start reloading on changes.
+func NewWatcher[T any](config T, schema, filePath string, opts ...Option) (*Watcher[T], error) {
+	current, err := Unmarshal(config, schema, filePath, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	o := newOptions(opts...)
+
+	w := &Watcher[T]{
+		config:   config,
+		schema:   schema,
+		filePath: filepath.Clean(filePath),
+		opts:     opts,
+		options:  o,
+		current:  current,
+		subs:     make(map[int]chan T),
+		reloads:  reloads,
+	}
+
+	if o.exporter != nil {
+		o.exporter.Add(reloads)
+	}
+
+	return w, nil
+}
+
+// Current returns the latest valid config
+func (w *Watcher[T]) Current() T {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.current
+}
+
+// Subscribe returns a channel that receives the config after every successful reload and a function to
+// unsubscribe. Only the newest config is kept for slow subscribers.
+func (w *Watcher[T]) Subscribe() (<-chan T, func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	id := w.nextSub
+	w.nextSub++
+	ch := make(chan T, 1)
+	w.subs[id] = ch
+
+	return ch, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		if _, ok := w.subs[id]; ok {
+			delete(w.subs, id)
+			close(ch)
+		}
+	}
+}
+
+// Metrics returns the reload metrics so they can be registered manually when WithExporter isn't used. They
+// are shared by every Watcher so only register them once.
+func (w *Watcher[T]) Metrics() []prometheus.Collector {
+	return []prometheus.Collector{w.reloads}
+}
+
+// Watch reloads the config whenever the file changes until the context is canceled. The directory is watched
+// instead of the file so that atomic renames and ConfigMap symlink swaps are seen. Invalid configs are
+// logged and counted but never published; subscribers keep the last valid config.
+func (w *Watcher[T]) Watch(ctx context.Context) error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	if err := fw.Add(filepath.Dir(w.filePath)); err != nil {
+		return err
+	}
+
+	realPath, _ := filepath.EvalSymlinks(w.filePath)
+
+	timer := time.NewTimer(w.options.debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return nil
+			}
+			w.options.logger.Errorf("error watching config %s: %v", w.filePath, err)
+		case event, ok := <-fw.Events:
+			if !ok {
+				return nil
+			}
+
+			newReal, _ := filepath.EvalSymlinks(w.filePath)
+			fileChanged := filepath.Clean(event.Name) == w.filePath && event.Has(fsnotify.Write|fsnotify.Create)
+			linkChanged := newReal != "" && newReal != realPath
+			if !fileChanged && !linkChanged {
+				continue
+			}
+
+			realPath = newReal
+			timer.Reset(w.options.debounce)
+		case <-timer.C:
+			w.reload()
+		}
+	}
+}
+
+func (w *Watcher[T]) reload() {
+	cfg, err := Unmarshal(w.config, w.schema, w.filePath, w.opts...)
+	if err != nil {
+		w.reloads.WithLabelValues(w.filePath, "failure").Inc()
+		w.options.logger.Errorf("error reloading config %s, keeping previous config: %v", w.filePath, err)
+		return
+	}
+
+	w.reloads.WithLabelValues(w.filePath, "success").Inc()
+	w.options.logger.Infof("reloaded config %s", w.filePath)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.current = cfg
+	for _, ch := range w.subs {
+		// drop a config the subscriber hasn't read yet so it always gets the newest one
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- cfg
+	}
+}
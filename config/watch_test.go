@@ -0,0 +1,151 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CoverWhale/coverwhale-go/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWatcherReload(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(fp, []byte(`{"name": "first"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewWatcher(testConfig{}, schema, fp, WithDebounce(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Current().Name != "first" {
+		t.Fatalf("expected initial config name first but got %s", w.Current().Name)
+	}
+
+	updates, unsubscribe := w.Subscribe()
+	defer unsubscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Watch(ctx)
+	// give the watcher time to add the directory
+	time.Sleep(50 * time.Millisecond)
+
+	if err := os.WriteFile(fp, []byte(`{"name": "second"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case cfg := <-updates:
+		if cfg.Name != "second" {
+			t.Errorf("expected reloaded config name second but got %s", cfg.Name)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for reload")
+	}
+
+	// invalid configs are never published and the last valid config is kept
+	if err := os.WriteFile(fp, []byte(`{"name": 1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case cfg := <-updates:
+		t.Errorf("expected invalid config to be skipped but got %v", cfg)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if w.Current().Name != "second" {
+		t.Errorf("expected current config name second but got %s", w.Current().Name)
+	}
+}
+
+func TestWatcherSymlinkSwap(t *testing.T) {
+	// mimic how Kubernetes updates a mounted ConfigMap by swapping the ..data symlink
+	dir := t.TempDir()
+	for _, v := range []string{"v1", "v2"} {
+		if err := os.Mkdir(filepath.Join(dir, v), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, v, "config.json"), []byte(`{"name": "`+v+`"}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Symlink("v1", filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	fp := filepath.Join(dir, "config.json")
+	if err := os.Symlink(filepath.Join("..data", "config.json"), fp); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewWatcher(testConfig{}, schema, fp, WithDebounce(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updates, unsubscribe := w.Subscribe()
+	defer unsubscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Watch(ctx)
+	time.Sleep(50 * time.Millisecond)
+
+	if err := os.Symlink("v2", filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case cfg := <-updates:
+		if cfg.Name != "v2" {
+			t.Errorf("expected reloaded config name v2 but got %s", cfg.Name)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for reload")
+	}
+}
+
+func TestWatcherSharedMetrics(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(fp, []byte(`{"name": "first"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	exporter := metrics.NewExporter()
+	for i := 0; i < 2; i++ {
+		if _, err := NewWatcher(testConfig{}, schema, fp, WithExporter(exporter)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	registry := prometheus.NewRegistry()
+	for _, v := range exporter.Metrics {
+		if err := registry.Register(v); err != nil {
+			t.Errorf("expected watchers to share metrics but got %v", err)
+		}
+	}
+}
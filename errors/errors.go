@@ -3,7 +3,15 @@ package errors
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"net/http"
+	"strconv"
 	"strings"
+	"time"
+)
+
+var (
+	ErrRateLimited = fmt.Errorf("rate limit exceeded")
 )
 
 // ClientError represents a non-server error
@@ -22,6 +30,9 @@ type ClientError struct {
 
 	// Additional parameters for the error
 	Params map[string]any
+
+	// Headers are added to the response, such as Retry-After
+	Headers map[string]string
 }
 
 type ErrorWithMetadata struct {
@@ -113,6 +124,50 @@ func WithAdditionalParams(params map[string]any) ClientErrorOpt {
 	}
 }
 
+// WithHeaders adds headers to the response
+func WithHeaders(headers map[string]string) ClientErrorOpt {
+	return func(c *ClientError) {
+		if c.Headers == nil {
+			c.Headers = make(map[string]string)
+		}
+		for k, v := range headers {
+			c.Headers[k] = v
+		}
+	}
+}
+
+// ResponseHeaders returns the headers to add to the response
+func (c ClientError) ResponseHeaders() map[string]string {
+	return c.Headers
+}
+
+// RateLimited returns a 429 client error telling the client to retry after the duration. The wait is rounded
+// up to whole seconds for the Retry-After header.
+func RateLimited(retryAfter time.Duration, opts ...ClientErrorOpt) ClientError {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	opts = append([]ClientErrorOpt{
+		WithHeaders(map[string]string{"Retry-After": strconv.Itoa(seconds)}),
+	}, opts...)
+
+	ce := NewClientError(ErrRateLimited, http.StatusTooManyRequests, opts...)
+	ce.ErrorsWithMetadata[0].Code = "CWRATE1"
+
+	// options can replace the params, so retry_after is added after them
+	params := map[string]any{"retry_after": seconds}
+	for k, v := range ce.Params {
+		if k != "retry_after" {
+			params[k] = v
+		}
+	}
+	ce.Params = params
+
+	return ce
+}
+
 // NewClientError returns a new client error. If no metadata errors are given, default error metadata is returned
 func NewClientError(err error, code int, opts ...ClientErrorOpt) ClientError {
 	metadata := ErrorWithMetadata{
@@ -134,3 +189,50 @@ func NewClientError(err error, code int, opts ...ClientErrorOpt) ClientError {
 
 	return ce
 }
+
+// ParseClientError decodes an error body written by Body back into a client error with the status. The
+// {"error": "..."} body written by the HTTP transport is also accepted.
+func ParseClientError(status int, body []byte) (ClientError, error) {
+	var envelope struct {
+		Errors []json.RawMessage `json:"errors"`
+		Error  string            `json:"error"`
+		Params map[string]any    `json:"params"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return ClientError{}, fmt.Errorf("invalid error body: %w", err)
+	}
+
+	if envelope.Errors == nil && envelope.Error == "" {
+		return ClientError{}, fmt.Errorf("invalid error body: missing errors")
+	}
+
+	ce := ClientError{
+		Status: status,
+		Params: envelope.Params,
+	}
+
+	var messages []string
+	if envelope.Error != "" {
+		messages = append(messages, envelope.Error)
+	}
+
+	for _, v := range envelope.Errors {
+		var message string
+		if err := json.Unmarshal(v, &message); err == nil {
+			messages = append(messages, message)
+			continue
+		}
+
+		var metadata ErrorWithMetadata
+		if err := json.Unmarshal(v, &metadata); err != nil {
+			return ClientError{}, fmt.Errorf("invalid error body: %w", err)
+		}
+		ce.ErrorsWithMetadata = append(ce.ErrorsWithMetadata, metadata)
+		messages = append(messages, metadata.Message)
+	}
+
+	ce.Details = strings.Join(messages, "; ")
+	ce.DetailedError = fmt.Errorf("%s", ce.Details)
+
+	return ce, nil
+}
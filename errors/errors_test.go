@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 )
 
 func TestClientErrorBody(t *testing.T) {
@@ -153,3 +154,97 @@ func TestClientErrorBody(t *testing.T) {
 		})
 	}
 }
+
+func TestParseClientError(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		details  string
+		metadata int
+		params   int
+		err      bool
+	}{
+		{
+			name:     "metadata errors",
+			body:     string(NewClientError(fmt.Errorf("too many requests"), 429, WithAdditionalParams(map[string]any{"retry_after": 1})).Body()),
+			details:  "too many requests",
+			metadata: 1,
+			params:   1,
+		},
+		{
+			name:    "message errors",
+			body:    `{"errors": ["invalid input", "missing name"]}`,
+			details: "invalid input; missing name",
+		},
+		{
+			name:    "http error",
+			body:    `{"error": "not found"}`,
+			details: "not found",
+		},
+		{
+			name: "not an error",
+			body: `{"id": 1}`,
+			err:  true,
+		},
+		{
+			name: "invalid json",
+			body: `internal server error`,
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ce, err := ParseClientError(400, []byte(tt.body))
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %t but got %v", tt.err, err)
+			}
+			if tt.err {
+				return
+			}
+
+			if ce.Status != 400 || ce.Details != tt.details {
+				t.Errorf("expected status 400 and details %q but got %d %q", tt.details, ce.Status, ce.Details)
+			}
+			if len(ce.ErrorsWithMetadata) != tt.metadata || len(ce.Params) != tt.params {
+				t.Errorf("expected %d metadata errors and %d params but got %+v", tt.metadata, tt.params, ce)
+			}
+		})
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []ClientErrorOpt
+		params map[string]any
+	}{
+		{
+			name:   "default",
+			params: map[string]any{"retry_after": 2},
+		},
+		{
+			name:   "additional params",
+			opts:   []ClientErrorOpt{WithAdditionalParams(map[string]any{"limit": 10})},
+			params: map[string]any{"retry_after": 2, "limit": 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ce := RateLimited(1500*time.Millisecond, tt.opts...)
+
+			if ce.ResponseHeaders()["Retry-After"] != "2" {
+				t.Errorf("expected Retry-After 2 but got %q", ce.ResponseHeaders()["Retry-After"])
+			}
+			if len(ce.Params) != len(tt.params) {
+				t.Fatalf("expected params %v but got %v", tt.params, ce.Params)
+			}
+			for k, v := range tt.params {
+				if ce.Params[k] != v {
+					t.Errorf("expected %s to be %v but got %v", k, v, ce.Params[k])
+				}
+			}
+		})
+	}
+}
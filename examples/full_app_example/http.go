@@ -15,6 +15,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -79,25 +80,30 @@ func (a *Application) createProduct(w http.ResponseWriter, r *http.Request) erro
 	return nil
 }
 
-func getProductByID(w http.ResponseWriter, r *http.Request, pm ProductManager) {
-	id := r.PathValue("id")
-	txn := newrelic.FromContext(r.Context())
+type productRequest struct {
+	ID string `path:"id"`
+}
+
+func (a *Application) getProductByID(ctx context.Context, req productRequest) (*Product, error) {
+	txn := newrelic.FromContext(ctx)
 	s := newrelic.DatastoreSegment{
 		StartTime:  newrelic.StartSegmentNow(txn),
 		Product:    "in-memory",
 		Collection: "products",
 		Operation:  "get by id",
 		QueryParameters: map[string]interface{}{
-			"id": id,
+			"id": req.ID,
 		},
 	}
 
-	p := GetProduct(id, pm)
+	p := GetProduct(req.ID, a.ProductManager)
 	s.End()
 
-	if err := json.NewEncoder(w).Encode(p); err != nil {
-		log.Println(err)
+	if p == nil {
+		return nil, cwhttp.NewClientError(fmt.Errorf("product not found"), http.StatusNotFound)
 	}
+
+	return p, nil
 }
 
 func getProducts(w http.ResponseWriter, r *http.Request, pm ProductManager) {
@@ -192,7 +198,7 @@ func (a *Application) buildRoutes(l *logr.Logger) []cwhttp.Route {
 		{
 			Method:  http.MethodGet,
 			Path:    "/products/{id}",
-			Handler: cwhttp.HandleWithContext(getProductByID, a.ProductManager),
+			Handler: cwhttp.Handle(a.getProductByID, cwhttp.WithHandlerLogger(l)),
 		},
 		{
 			Method:  http.MethodGet,
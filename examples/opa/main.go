@@ -21,6 +21,7 @@ import (
 	"net/http"
 
 	"github.com/CoverWhale/coverwhale-go/opa"
+	"github.com/CoverWhale/coverwhale-go/opa/underwriting"
 	cwhttp "github.com/CoverWhale/coverwhale-go/transports/http"
 	"github.com/CoverWhale/coverwhale-go/transports/http/middleware"
 	"github.com/CoverWhale/logr"
@@ -54,7 +55,7 @@ func getRoutes(l *logr.Logger) []cwhttp.Route {
 		{
 			Method:  http.MethodPost,
 			Path:    "/test-custom-decision",
-			Handler: middleware.CustomValidator(http.HandlerFunc(test), opaValidateDecision, opa.SideCarOPA, "cw/underwriting/decision"),
+			Handler: middleware.CustomResultValidator[underwriting.Input, underwriting.Decision](http.HandlerFunc(test), opaValidateDecision, opa.SideCarOPA, "cw/underwriting/decision"),
 		},
 	}
 }
@@ -79,17 +80,17 @@ func test(w http.ResponseWriter, r *http.Request) {
 }
 
 // custom validation function to send to OPA.
-func opaValidate(data []byte) (opa.OPARequest, error) {
+func opaValidate(data []byte) (opa.OPARequest[underwriting.Input], error) {
 	var req Request
 
 	if err := json.Unmarshal(data, &req); err != nil {
-		return opa.OPARequest{}, err
+		return opa.OPARequest[underwriting.Input]{}, err
 	}
 
-	var vehicles []opa.Vehicle
+	var vehicles []underwriting.Vehicle
 
 	for _, v := range req.Vehicles {
-		vehicles = append(vehicles, opa.Vehicle{
+		vehicles = append(vehicles, underwriting.Vehicle{
 			ID:       v.VIN,
 			BodyType: v.BodyType,
 			Class:    v.Class,
@@ -97,11 +98,11 @@ func opaValidate(data []byte) (opa.OPARequest, error) {
 		})
 	}
 
-	return opa.OPARequest{
-		Input: opa.Input{
+	return opa.OPARequest[underwriting.Input]{
+		Input: underwriting.Input{
 			Operation:   req.Operation,
 			Commodities: req.Commodities,
-			Drivers: []opa.Driver{
+			Drivers: []underwriting.Driver{
 				{
 					ID:         "123345",
 					Age:        23,
@@ -114,17 +115,17 @@ func opaValidate(data []byte) (opa.OPARequest, error) {
 
 }
 
-func opaValidateDecision(data []byte) (opa.OPARequest, error) {
+func opaValidateDecision(data []byte) (opa.OPARequest[underwriting.Input], error) {
 	var req Request
 
 	if err := json.Unmarshal(data, &req); err != nil {
-		return opa.OPARequest{}, err
+		return opa.OPARequest[underwriting.Input]{}, err
 	}
 
-	var vehicles []opa.Vehicle
+	var vehicles []underwriting.Vehicle
 
 	for _, v := range req.Vehicles {
-		vehicles = append(vehicles, opa.Vehicle{
+		vehicles = append(vehicles, underwriting.Vehicle{
 			ID:       v.VIN,
 			BodyType: v.BodyType,
 			Class:    v.Class,
@@ -132,11 +133,11 @@ func opaValidateDecision(data []byte) (opa.OPARequest, error) {
 		})
 	}
 
-	return opa.OPARequest{
-		Input: opa.Input{
+	return opa.OPARequest[underwriting.Input]{
+		Input: underwriting.Input{
 			Operation:   req.Operation,
 			Commodities: req.Commodities,
-			Drivers: []opa.Driver{
+			Drivers: []underwriting.Driver{
 				{
 					ID:         "123345",
 					Age:        23,
@@ -8,6 +8,7 @@ require (
 	github.com/CoverWhale/gupdate v0.0.2
 	github.com/CoverWhale/logr v0.0.0-20240513164108-a4fd5504b303
 	github.com/briandowns/spinner v1.23.0
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/invopop/jsonschema v0.12.0
 	github.com/nats-io/nats.go v1.33.0
 	github.com/newrelic/go-agent/v3 v3.20.3
@@ -22,6 +23,7 @@ require (
 	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.16.0
 	go.opentelemetry.io/otel/sdk v1.16.0
 	go.opentelemetry.io/otel/trace v1.16.0
+	golang.org/x/net v0.21.0
 )
 
 require (
@@ -37,7 +39,6 @@ require (
 	github.com/emicklei/proto v1.6.15 // indirect
 	github.com/fatih/color v1.17.0 // indirect
 	github.com/felixge/httpsnoop v1.0.3 // indirect
-	github.com/fsnotify/fsnotify v1.7.0 // indirect
 	github.com/go-logr/logr v1.2.4 // indirect
 	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/golang/glog v1.1.2 // indirect
@@ -79,7 +80,6 @@ require (
 	go.uber.org/multierr v1.11.0 // indirect
 	golang.org/x/crypto v0.23.0 // indirect
 	golang.org/x/exp v0.0.0-20240506185415-9bf2ced13842 // indirect
-	golang.org/x/net v0.21.0 // indirect
 	golang.org/x/sys v0.20.0 // indirect
 	golang.org/x/term v0.20.0 // indirect
 	golang.org/x/text v0.15.0 // indirect
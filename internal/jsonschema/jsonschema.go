@@ -0,0 +1,435 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jsonschema validates JSON payloads against the schemas services publish in their endpoint metadata
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+var ErrInvalidPayload = fmt.Errorf("payload does not match schema")
+
+// Schema is a parsed JSON schema. It supports the keywords generated by invopop/jsonschema: local $ref, type,
+// properties, required, additionalProperties, items, enum, const, the numeric, string, and array limits,
+// pattern, and allOf, anyOf, and oneOf. Other keywords are ignored. A Schema is safe for concurrent use.
+type Schema struct {
+	root any
+
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}
+
+// Compile parses a JSON schema
+func Compile(schema []byte) (*Schema, error) {
+	root, err := decode(schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	return &Schema{root: root, patterns: make(map[string]*regexp.Regexp)}, nil
+}
+
+// Validate checks a JSON payload against the schema
+func (s *Schema) Validate(payload []byte) error {
+	doc, err := decode(payload)
+	if err != nil {
+		return fmt.Errorf("%w: invalid JSON: %v", ErrInvalidPayload, err)
+	}
+
+	v := validator{schema: s, refs: make(map[string]bool)}
+	v.validate(s.root, doc, "$")
+	if len(v.errors) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidPayload, strings.Join(v.errors, "; "))
+	}
+
+	return nil
+}
+
+// Validate checks a JSON payload against a JSON schema
+func Validate(schema, payload []byte) error {
+	s, err := Compile(schema)
+	if err != nil {
+		return err
+	}
+
+	return s.Validate(payload)
+}
+
+// decode keeps numbers as json.Number in both the schema and the payload so they compare exactly
+func decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// pattern returns the compiled regular expression, compiling each pattern once
+func (s *Schema) pattern(p string) (*regexp.Regexp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if re, ok := s.patterns[p]; ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return nil, err
+	}
+	s.patterns[p] = re
+
+	return re, nil
+}
+
+type validator struct {
+	schema *Schema
+	// refs are the references being followed for each location in the payload, so a reference that
+	// leads back to itself without going deeper into the payload is reported instead of recursing forever
+	refs   map[string]bool
+	errors []string
+}
+
+func (v *validator) errorf(path, format string, args ...any) {
+	v.errors = append(v.errors, fmt.Sprintf("%s: %s", path, fmt.Sprintf(format, args...)))
+}
+
+// valid reports whether the value matches the schema without recording errors
+func (v *validator) valid(schema any, value any, path string) bool {
+	sub := validator{schema: v.schema, refs: v.refs}
+	sub.validate(schema, value, path)
+	return len(sub.errors) == 0
+}
+
+func (v *validator) validate(schema any, value any, path string) {
+	s, ok := schema.(map[string]any)
+	if !ok {
+		if b, ok := schema.(bool); ok && !b {
+			v.errorf(path, "no value is allowed")
+		}
+		return
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		key := ref + " " + path
+		if v.refs[key] {
+			v.errorf(path, "circular reference %s", ref)
+			return
+		}
+
+		resolved, err := v.resolve(ref)
+		if err != nil {
+			v.errorf(path, "%v", err)
+			return
+		}
+
+		v.refs[key] = true
+		v.validate(resolved, value, path)
+		delete(v.refs, key)
+	}
+
+	if t, ok := s["type"]; ok && !matchesType(t, value) {
+		v.errorf(path, "expected %v but got %s", t, jsonType(value))
+		return
+	}
+
+	if enum, ok := s["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.errorf(path, "must be one of %v", enum)
+		}
+	}
+
+	if c, ok := s["const"]; ok && !jsonEqual(c, value) {
+		v.errorf(path, "must be %v", c)
+	}
+
+	for _, sub := range schemaList(s["allOf"]) {
+		v.validate(sub, value, path)
+	}
+
+	if anyOf := schemaList(s["anyOf"]); len(anyOf) > 0 {
+		matched := false
+		for _, sub := range anyOf {
+			if v.valid(sub, value, path) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.errorf(path, "must match at least one schema in anyOf")
+		}
+	}
+
+	if oneOf := schemaList(s["oneOf"]); len(oneOf) > 0 {
+		matched := 0
+		for _, sub := range oneOf {
+			if v.valid(sub, value, path) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			v.errorf(path, "must match exactly one schema in oneOf but matched %d", matched)
+		}
+	}
+
+	switch val := value.(type) {
+	case map[string]any:
+		v.validateObject(s, val, path)
+	case []any:
+		v.validateArray(s, val, path)
+	case string:
+		v.validateString(s, val, path)
+	case json.Number:
+		v.validateNumber(s, val, path)
+	}
+}
+
+func (v *validator) validateObject(s map[string]any, obj map[string]any, path string) {
+	for _, r := range schemaList(s["required"]) {
+		name, _ := r.(string)
+		if _, ok := obj[name]; !ok {
+			v.errorf(path, "missing required property %q", name)
+		}
+	}
+
+	props, _ := s["properties"].(map[string]any)
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		propPath := fmt.Sprintf("%s.%s", path, k)
+		if prop, ok := props[k]; ok {
+			v.validate(prop, obj[k], propPath)
+			continue
+		}
+
+		switch additional := s["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.errorf(path, "unknown property %q", k)
+			}
+		case map[string]any:
+			v.validate(additional, obj[k], propPath)
+		}
+	}
+}
+
+func (v *validator) validateArray(s map[string]any, arr []any, path string) {
+	if min, ok := number(s["minItems"]); ok && float64(len(arr)) < min {
+		v.errorf(path, "must have at least %v items", min)
+	}
+	if max, ok := number(s["maxItems"]); ok && float64(len(arr)) > max {
+		v.errorf(path, "must have at most %v items", max)
+	}
+
+	if items, ok := s["items"]; ok {
+		for i, item := range arr {
+			v.validate(items, item, fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
+
+func (v *validator) validateString(s map[string]any, str string, path string) {
+	length := float64(utf8.RuneCountInString(str))
+	if min, ok := number(s["minLength"]); ok && length < min {
+		v.errorf(path, "must be at least %v characters", min)
+	}
+	if max, ok := number(s["maxLength"]); ok && length > max {
+		v.errorf(path, "must be at most %v characters", max)
+	}
+
+	if pattern, ok := s["pattern"].(string); ok {
+		re, err := v.schema.pattern(pattern)
+		if err != nil {
+			v.errorf(path, "invalid pattern %q", pattern)
+			return
+		}
+		if !re.MatchString(str) {
+			v.errorf(path, "must match %q", pattern)
+		}
+	}
+}
+
+func (v *validator) validateNumber(s map[string]any, n json.Number, path string) {
+	f, err := n.Float64()
+	if err != nil {
+		v.errorf(path, "invalid number %s", n)
+		return
+	}
+
+	if min, ok := number(s["minimum"]); ok && f < min {
+		v.errorf(path, "must be >= %v", min)
+	}
+	if max, ok := number(s["maximum"]); ok && f > max {
+		v.errorf(path, "must be <= %v", max)
+	}
+	if min, ok := number(s["exclusiveMinimum"]); ok && f <= min {
+		v.errorf(path, "must be > %v", min)
+	}
+	if max, ok := number(s["exclusiveMaximum"]); ok && f >= max {
+		v.errorf(path, "must be < %v", max)
+	}
+}
+
+// resolve follows a local JSON pointer such as #/$defs/MathRequest
+func (v *validator) resolve(ref string) (any, error) {
+	pointer, ok := strings.CutPrefix(ref, "#")
+	if !ok {
+		return nil, fmt.Errorf("only local references are supported: %s", ref)
+	}
+
+	var current any = v.schema.root
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unresolved reference %s", ref)
+		}
+		if current, ok = m[token]; !ok {
+			return nil, fmt.Errorf("unresolved reference %s", ref)
+		}
+	}
+
+	return current, nil
+}
+
+func schemaList(v any) []any {
+	list, _ := v.([]any)
+	return list
+}
+
+func number(v any) (float64, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+func matchesType(t any, value any) bool {
+	switch types := t.(type) {
+	case string:
+		return matchesSingleType(types, value)
+	case []any:
+		for _, v := range types {
+			if s, ok := v.(string); ok && matchesSingleType(s, value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+func matchesSingleType(t string, value any) bool {
+	actual := jsonType(value)
+	if t == "number" && actual == "integer" {
+		return true
+	}
+
+	return t == actual
+}
+
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	}
+
+	return fmt.Sprintf("%T", value)
+}
+
+// jsonEqual compares JSON values. Numbers are equal if they have the same value, so 1 and 1.0 match.
+func jsonEqual(a, b any) bool {
+	switch a := a.(type) {
+	case json.Number:
+		n, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, okX := new(big.Rat).SetString(a.String())
+		y, okY := new(big.Rat).SetString(n.String())
+		return okX && okY && x.Cmp(y) == 0
+	case map[string]any:
+		m, ok := b.(map[string]any)
+		if !ok || len(a) != len(m) {
+			return false
+		}
+		for k, v := range a {
+			other, ok := m[k]
+			if !ok || !jsonEqual(v, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		l, ok := b.([]any)
+		if !ok || len(a) != len(l) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], l[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonschema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	// the format generated by jsonschema.Reflect for the example MathRequest
+	schema := `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$ref": "#/$defs/MathRequest",
+		"$defs": {
+			"MathRequest": {
+				"properties": {
+					"a": {"type": "integer", "minimum": 0},
+					"b": {"type": "integer"},
+					"op": {"type": "string", "enum": ["add", "subtract"]},
+					"tags": {"type": "array", "items": {"type": "string", "pattern": "^[a-z]+$"}, "maxItems": 2},
+					"note": {"anyOf": [{"type": "string", "maxLength": 5}, {"type": "null"}]},
+					"scale": {"enum": [1, 2.5, 10]},
+					"origin": {"const": {"x": 0, "y": [1, 2]}},
+					"tree": {"$ref": "#/$defs/Tree"}
+				},
+				"additionalProperties": false,
+				"type": "object",
+				"required": ["a", "b"]
+			},
+			"Tree": {
+				"type": "object",
+				"properties": {
+					"children": {"type": "array", "items": {"$ref": "#/$defs/Tree"}}
+				}
+			}
+		}
+	}`
+
+	tt := []struct {
+		name    string
+		payload string
+		valid   bool
+	}{
+		{name: "valid", payload: `{"a": 1, "b": 2, "op": "add", "tags": ["x"], "note": null}`, valid: true},
+		{name: "missing required", payload: `{"a": 1}`},
+		{name: "wrong type", payload: `{"a": "1", "b": 2}`},
+		{name: "not an integer", payload: `{"a": 1.5, "b": 2}`},
+		{name: "below minimum", payload: `{"a": -1, "b": 2}`},
+		{name: "enum", payload: `{"a": 1, "b": 2, "op": "divide"}`},
+		{name: "additional property", payload: `{"a": 1, "b": 2, "c": 3}`},
+		{name: "array items", payload: `{"a": 1, "b": 2, "tags": ["X"]}`},
+		{name: "max items", payload: `{"a": 1, "b": 2, "tags": ["a", "b", "c"]}`},
+		{name: "anyOf", payload: `{"a": 1, "b": 2, "note": "too long"}`},
+		{name: "invalid json", payload: `{"a": 1,`},
+		{name: "numeric enum", payload: `{"a": 1, "b": 2, "scale": 2.50}`, valid: true},
+		{name: "numeric enum mismatch", payload: `{"a": 1, "b": 2, "scale": 3}`},
+		{name: "nested const", payload: `{"a": 1, "b": 2, "origin": {"x": 0.0, "y": [1, 2]}}`, valid: true},
+		{name: "nested const mismatch", payload: `{"a": 1, "b": 2, "origin": {"x": 0, "y": [2, 1]}}`},
+		{name: "recursive reference", payload: `{"a": 1, "b": 2, "tree": {"children": [{"children": [{}]}]}}`, valid: true},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			err := Validate([]byte(schema), []byte(v.payload))
+			if v.valid && err != nil {
+				t.Errorf("expected valid payload but got %v", err)
+			}
+			if !v.valid && !errors.Is(err, ErrInvalidPayload) {
+				t.Errorf("expected ErrInvalidPayload but got %v", err)
+			}
+		})
+	}
+}
+
+func TestCircularReference(t *testing.T) {
+	schema := `{"$ref": "#/$defs/A", "$defs": {"A": {"$ref": "#/$defs/B"}, "B": {"$ref": "#/$defs/A"}}}`
+
+	err := Validate([]byte(schema), []byte(`{}`))
+	if !errors.Is(err, ErrInvalidPayload) || !strings.Contains(err.Error(), "circular reference") {
+		t.Errorf("expected circular reference error but got %v", err)
+	}
+}
+
+func TestPatternCache(t *testing.T) {
+	s, err := Compile([]byte(`{"type": "array", "items": {"type": "string", "pattern": "^[a-z]+$"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Validate([]byte(`["a", "b", "c"]`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.patterns) != 1 {
+		t.Errorf("expected 1 compiled pattern but got %d", len(s.patterns))
+	}
+}
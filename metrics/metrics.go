@@ -16,6 +16,7 @@ package metrics
 
 import (
 	"context"
+	"slices"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"go.opentelemetry.io/otel"
@@ -37,6 +38,15 @@ func NewExporter() *Exporter {
 	return &Exporter{}
 }
 
+// Add adds collectors that aren't already in the exporter, so shared collectors are only registered once
+func (e *Exporter) Add(collectors ...prometheus.Collector) {
+	for _, c := range collectors {
+		if !slices.Contains(e.Metrics, c) {
+			e.Metrics = append(e.Metrics, c)
+		}
+	}
+}
+
 func NewCounterVec(name, help string, labels []string) *prometheus.CounterVec {
 	return prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -48,6 +58,17 @@ func NewCounterVec(name, help string, labels []string) *prometheus.CounterVec {
 	)
 }
 
+func NewGaugeVec(name, help string, labels []string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        name,
+			Help:        help,
+			ConstLabels: nil,
+		},
+		labels,
+	)
+}
+
 func NewHistogramVec(name, help string, labels []string) *prometheus.HistogramVec {
 	return prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -0,0 +1,91 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opa
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// decisionCache is an LRU cache of OPA results keyed by the package and input hash
+type decisionCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	items map[string]*list.Element
+	order *list.List
+}
+
+type cacheEntry struct {
+	key     string
+	result  json.RawMessage
+	expires time.Time
+}
+
+func newDecisionCache(size int, ttl time.Duration) *decisionCache {
+	return &decisionCache{
+		size:  size,
+		ttl:   ttl,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+func (d *decisionCache) get(key string) (json.RawMessage, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	elem, ok := d.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if d.ttl > 0 && time.Now().After(entry.expires) {
+		d.order.Remove(elem)
+		delete(d.items, key)
+		return nil, false
+	}
+
+	d.order.MoveToFront(elem)
+	return entry.result, true
+}
+
+func (d *decisionCache) set(key string, result json.RawMessage) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if elem, ok := d.items[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.result = result
+		entry.expires = time.Now().Add(d.ttl)
+		d.order.MoveToFront(elem)
+		return
+	}
+
+	d.items[key] = d.order.PushFront(&cacheEntry{
+		key:     key,
+		result:  result,
+		expires: time.Now().Add(d.ttl),
+	})
+
+	if d.order.Len() > d.size {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.items, oldest.Value.(*cacheEntry).key)
+	}
+}
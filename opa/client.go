@@ -0,0 +1,417 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opa
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUndefined   = fmt.Errorf("policy decision is undefined")
+	ErrCircuitOpen = fmt.Errorf("circuit breaker is open")
+)
+
+// StatusError is returned when OPA responds with a non 200 status code
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+// Error fulfills the error interface
+func (s *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status from OPA %d: %s", s.StatusCode, s.Body)
+}
+
+// DecisionLog describes a single policy decision and is passed to every DecisionHook
+type DecisionLog struct {
+	Package   string
+	InputHash string
+	Result    json.RawMessage
+	Duration  time.Duration
+	Cached    bool
+	Err       error
+	Timestamp time.Time
+}
+
+// DecisionHook is called after every decision, including cached decisions and errors
+type DecisionHook func(context.Context, DecisionLog)
+
+// ClientOption is a functional option to modify the client
+type ClientOption func(*Client)
+
+// Client queries OPA for policy decisions. It reuses connections, retries transient failures, and can
+// cache decisions. When an Evaluator is set, policies are evaluated in process instead of over HTTP.
+type Client struct {
+	url        OPAURL
+	httpClient *http.Client
+	timeout    time.Duration
+	retries    int
+	backoff    time.Duration
+	cache      *decisionCache
+	last       *decisionCache
+	breaker    *circuitBreaker
+	evaluator  Evaluator
+	hooks      []DecisionHook
+}
+
+// NewClient returns a client for the sidecar OPA by default
+func NewClient(opts ...ClientOption) *Client {
+	c := &Client{
+		url: SideCarOPA,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{
+					Timeout:   2 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				MaxIdleConns:        100,
+				MaxIdleConnsPerHost: 100,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+		timeout: 2 * time.Second,
+		retries: 2,
+		backoff: 50 * time.Millisecond,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// SetURL sets the OPA server URL
+func SetURL(u OPAURL) ClientOption {
+	return func(c *Client) {
+		c.url = OPAURL(strings.TrimSuffix(string(u), "/"))
+	}
+}
+
+// SetTimeout sets the timeout for each attempt
+func SetTimeout(t time.Duration) ClientOption {
+	return func(c *Client) {
+		c.timeout = t
+	}
+}
+
+// SetRetries sets how many times a failed request is retried. Only connection errors and 5xx responses are retried.
+func SetRetries(r int) ClientOption {
+	return func(c *Client) {
+		c.retries = r
+	}
+}
+
+// SetRetryBackoff sets the wait before the first retry. The wait doubles for each retry after that.
+func SetRetryBackoff(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.backoff = d
+	}
+}
+
+// SetHTTPClient replaces the HTTP client used to call OPA
+func SetHTTPClient(h *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = h
+	}
+}
+
+// SetCache enables an LRU cache of decisions keyed by package and input hash. Decisions older than ttl
+// are evaluated again. A ttl of 0 keeps decisions until they are evicted.
+func SetCache(size int, ttl time.Duration) ClientOption {
+	return func(c *Client) {
+		if size <= 0 {
+			c.cache = nil
+			return
+		}
+		c.cache = newDecisionCache(size, ttl)
+	}
+}
+
+// SetLastDecisions keeps the last successful decision for up to size inputs so callers can fall back to it
+// with LastDecision when OPA is unavailable
+func SetLastDecisions(size int) ClientOption {
+	return func(c *Client) {
+		if size <= 0 {
+			c.last = nil
+			return
+		}
+		c.last = newDecisionCache(size, 0)
+	}
+}
+
+// SetCircuitBreaker opens the circuit after threshold consecutive failures to reach OPA. Only connection errors
+// and 5xx responses are failures; calls canceled by the caller aren't counted. While open, Decide returns
+// ErrCircuitOpen without calling OPA. After the cooldown a single probe is let through to check if OPA has
+// recovered.
+func SetCircuitBreaker(threshold int, cooldown time.Duration) ClientOption {
+	return func(c *Client) {
+		if threshold <= 0 {
+			c.breaker = nil
+			return
+		}
+		c.breaker = newCircuitBreaker(threshold, cooldown)
+	}
+}
+
+// SetEvaluator evaluates policies in process with the Evaluator instead of calling the OPA server
+func SetEvaluator(e Evaluator) ClientOption {
+	return func(c *Client) {
+		c.evaluator = e
+	}
+}
+
+// SetDecisionHooks adds hooks that are called after every decision
+func SetDecisionHooks(hooks ...DecisionHook) ClientOption {
+	return func(c *Client) {
+		c.hooks = append(c.hooks, hooks...)
+	}
+}
+
+// Decide evaluates the package, such as cw/underwriting, with the input and returns the raw result document.
+// ErrUndefined is returned when the package has no result for the input.
+func (c *Client) Decide(ctx context.Context, pkg string, input any) (json.RawMessage, error) {
+	pkg = strings.Trim(pkg, "/")
+	start := time.Now()
+
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := InputHash(pkg, data)
+	log := DecisionLog{
+		Package:   pkg,
+		InputHash: hash,
+		Timestamp: start,
+	}
+
+	if c.cache != nil {
+		if result, ok := c.cache.get(hash); ok {
+			log.Result = result
+			log.Cached = true
+			log.Duration = time.Since(start)
+			c.runHooks(ctx, log)
+			return result, nil
+		}
+	}
+
+	if c.breaker != nil && !c.breaker.allow() {
+		log.Err = ErrCircuitOpen
+		log.Duration = time.Since(start)
+		c.runHooks(ctx, log)
+		return nil, ErrCircuitOpen
+	}
+
+	result, err := c.evaluate(ctx, pkg, data)
+	if c.breaker != nil {
+		switch {
+		case err != nil && ctx.Err() != nil:
+			// the caller gave up, which says nothing about OPA
+			c.breaker.release()
+		case c.evaluator == nil && unavailable(err):
+			c.breaker.failure()
+		default:
+			c.breaker.success()
+		}
+	}
+
+	log.Result = result
+	log.Err = err
+	log.Duration = time.Since(start)
+	c.runHooks(ctx, log)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if c.cache != nil {
+		c.cache.set(hash, result)
+	}
+
+	if c.last != nil {
+		c.last.set(hash, result)
+	}
+
+	return result, nil
+}
+
+// LastDecision returns the last successful decision for the package and input. SetLastDecisions must be
+// used to keep decisions.
+func (c *Client) LastDecision(pkg string, input any) (json.RawMessage, bool) {
+	if c.last == nil {
+		return nil, false
+	}
+
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, false
+	}
+
+	return c.last.get(InputHash(strings.Trim(pkg, "/"), data))
+}
+
+// CircuitState returns the state of the circuit breaker. It is always closed if SetCircuitBreaker isn't used.
+func (c *Client) CircuitState() CircuitState {
+	if c.breaker == nil {
+		return CircuitClosed
+	}
+
+	return c.breaker.current()
+}
+
+func (c *Client) evaluate(ctx context.Context, pkg string, input json.RawMessage) (json.RawMessage, error) {
+	if c.evaluator != nil {
+		result, err := c.evaluator.Evaluate(ctx, pkg, input)
+		if err != nil {
+			return nil, err
+		}
+		if len(result) == 0 || string(result) == "null" {
+			return nil, ErrUndefined
+		}
+		return result, nil
+	}
+
+	body, err := json.Marshal(OPARequest[json.RawMessage]{Input: input})
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/v1/data/%s", c.url, pkg)
+	backoff := c.backoff
+
+	for attempt := 0; ; attempt++ {
+		result, err := c.post(ctx, url, body)
+		if err == nil || attempt >= c.retries || !retryable(err) {
+			return result, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) post(ctx context.Context, url string, body []byte) (json.RawMessage, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(data)}
+	}
+
+	var or OPAResponse[json.RawMessage]
+	if err := json.Unmarshal(data, &or); err != nil {
+		return nil, fmt.Errorf("error decoding response from OPA: %w", err)
+	}
+
+	if len(or.Result) == 0 {
+		return nil, ErrUndefined
+	}
+
+	return or.Result, nil
+}
+
+func (c *Client) runHooks(ctx context.Context, log DecisionLog) {
+	for _, hook := range c.hooks {
+		hook(ctx, log)
+	}
+}
+
+// retryable reports whether the error is a connection problem or a server error from OPA
+func retryable(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.StatusCode >= http.StatusInternalServerError
+	}
+
+	return !errors.Is(err, ErrUndefined) && !errors.Is(err, context.Canceled)
+}
+
+// unavailable reports whether the error means OPA couldn't be reached or failed with a server error
+func unavailable(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.StatusCode >= http.StatusInternalServerError
+	}
+
+	var ue *url.Error
+	var ne net.Error
+	return errors.As(err, &ue) || errors.As(err, &ne)
+}
+
+// Query evaluates the package with a typed input and decodes the result document into R. For example:
+//
+//	decision, err := opa.Query[underwriting.Decision](ctx, client, "cw/underwriting/decision", input)
+func Query[R any, T any](ctx context.Context, c *Client, pkg string, input T) (R, error) {
+	var result R
+
+	data, err := c.Decide(ctx, pkg, input)
+	if err != nil {
+		return result, err
+	}
+
+	if err := json.Unmarshal(data, &result); err != nil {
+		return result, fmt.Errorf("error decoding result for %s: %w", pkg, err)
+	}
+
+	return result, nil
+}
+
+// InputHash returns the hash used to identify a decision for a package and encoded input
+func InputHash(pkg string, input []byte) string {
+	h := sha256.New()
+	h.Write([]byte(pkg))
+	h.Write([]byte{0})
+	h.Write(input)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,284 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CoverWhale/coverwhale-go/opa/underwriting"
+)
+
+func TestClientDecide(t *testing.T) {
+	tt := []struct {
+		name      string
+		responses []int
+		body      string
+		opts      []ClientOption
+		calls     int32
+		want      string
+		err       error
+	}{
+		{name: "allowed", responses: []int{200}, body: `{"result": {"allow": true}}`, calls: 1, want: `{"allow": true}`},
+		{name: "retry server error", responses: []int{500, 503, 200}, body: `{"result": {"allow": true}}`, calls: 3, want: `{"allow": true}`},
+		{name: "retries exhausted", responses: []int{500, 500}, opts: []ClientOption{SetRetries(1)}, calls: 2, err: &StatusError{}},
+		{name: "client error not retried", responses: []int{400}, calls: 1, err: &StatusError{}},
+		{name: "undefined", responses: []int{200}, body: `{}`, calls: 1, err: ErrUndefined},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			var calls int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/data/cw/underwriting" {
+					t.Errorf("expected path /v1/data/cw/underwriting but got %s", r.URL.Path)
+				}
+				call := atomic.AddInt32(&calls, 1)
+				w.WriteHeader(v.responses[call-1])
+				w.Write([]byte(v.body))
+			}))
+			defer srv.Close()
+
+			opts := append([]ClientOption{SetURL(OPAURL(srv.URL)), SetRetryBackoff(time.Millisecond)}, v.opts...)
+			c := NewClient(opts...)
+
+			result, err := c.Decide(context.Background(), "cw/underwriting", map[string]string{"state": "NY"})
+			if v.err != nil {
+				var se *StatusError
+				if !errors.Is(err, v.err) && !(errors.As(v.err, &se) && errors.As(err, &se)) {
+					t.Errorf("expected error %v but got %v", v.err, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if v.want != "" && !jsonEqual(t, result, v.want) {
+				t.Errorf("expected result %s but got %s", v.want, result)
+			}
+
+			if calls != v.calls {
+				t.Errorf("expected %d calls to OPA but got %d", v.calls, calls)
+			}
+		})
+	}
+}
+
+func TestClientCache(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte(`{"result": {"allow": true}}`))
+	}))
+	defer srv.Close()
+
+	var logs []DecisionLog
+	c := NewClient(
+		SetURL(OPAURL(srv.URL)),
+		SetCache(1, time.Minute),
+		SetDecisionHooks(func(ctx context.Context, l DecisionLog) {
+			logs = append(logs, l)
+		}),
+	)
+
+	inputs := []string{"a", "a", "b", "a"}
+	for _, v := range inputs {
+		if _, err := c.Decide(context.Background(), "cw", v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the cache only holds one decision so b evicts a
+	if calls != 3 {
+		t.Errorf("expected 3 calls to OPA but got %d", calls)
+	}
+
+	if len(logs) != len(inputs) || !logs[1].Cached || logs[2].Cached {
+		t.Errorf("expected second decision to be cached and hooks for every decision but got %+v", logs)
+	}
+}
+
+func TestClientEvaluator(t *testing.T) {
+	policies := Policies{
+		"cw/underwriting": func(ctx context.Context, input json.RawMessage) (any, error) {
+			var in struct {
+				State string `json:"state"`
+			}
+			if err := json.Unmarshal(input, &in); err != nil {
+				return nil, err
+			}
+			return Result{Allow: in.State != "NY"}, nil
+		},
+	}
+
+	c := NewClient(SetEvaluator(policies))
+
+	result, err := c.Decide(context.Background(), "cw/underwriting", map[string]string{"state": "NY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !jsonEqual(t, result, `{"allow": false}`) {
+		t.Errorf("expected deny but got %s", result)
+	}
+
+	if _, err := c.Decide(context.Background(), "cw/other", nil); !errors.Is(err, ErrUnknownPackage) {
+		t.Errorf("expected error %v but got %v", ErrUnknownPackage, err)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	c := NewClient(SetEvaluator(Policies{
+		"cw/underwriting/decision": func(ctx context.Context, input json.RawMessage) (any, error) {
+			return map[string]any{"allowed": true, "carriers": []string{"carrier-a"}}, nil
+		},
+	}))
+
+	input := underwriting.Input{State: "NJ", Commodities: []string{"produce"}}
+	decision, err := Query[underwriting.Decision](context.Background(), c, "cw/underwriting/decision", input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !decision.IsAllowed() || len(decision.Carriers) != 1 || decision.Carriers[0] != "carrier-a" {
+		t.Errorf("expected allowed decision with carrier-a but got %+v", decision)
+	}
+}
+
+func jsonEqual(t *testing.T, got json.RawMessage, want string) bool {
+	t.Helper()
+
+	var g, w any
+	if err := json.Unmarshal(got, &g); err != nil {
+		return false
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatal(err)
+	}
+
+	gb, _ := json.Marshal(g)
+	wb, _ := json.Marshal(w)
+
+	return string(gb) == string(wb)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var calls int32
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"result":{"allow":true}}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(SetURL(OPAURL(srv.URL)), SetRetries(0), SetCircuitBreaker(2, 50*time.Millisecond), SetLastDecisions(10))
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Decide(context.Background(), "cw", i); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	if c.CircuitState() != CircuitOpen {
+		t.Fatalf("expected open circuit but got %s", c.CircuitState())
+	}
+
+	if _, err := c.Decide(context.Background(), "cw", 1); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen but got %v", err)
+	}
+
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("expected 2 calls to OPA but got %d", calls)
+	}
+
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+
+	if _, err := c.Decide(context.Background(), "cw", 1); err != nil {
+		t.Fatalf("expected probe to succeed but got %v", err)
+	}
+
+	if c.CircuitState() != CircuitClosed {
+		t.Errorf("expected closed circuit but got %s", c.CircuitState())
+	}
+
+	if _, ok := c.LastDecision("cw", 1); !ok {
+		t.Error("expected last decision")
+	}
+}
+
+func TestCircuitBreakerIgnores(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.Write([]byte(`{"result":{"allow":true}}`))
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c := NewClient(SetURL(OPAURL(srv.URL)), SetRetries(0), SetCircuitBreaker(1, time.Minute))
+
+	tt := []struct {
+		name string
+		ctx  func() (context.Context, context.CancelFunc)
+	}{
+		{name: "canceled", ctx: func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return ctx, cancel
+		}},
+		{name: "deadline", ctx: func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 10*time.Millisecond)
+		}},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			ctx, cancel := v.ctx()
+			defer cancel()
+
+			if _, err := c.Decide(ctx, "cw", v.name); err == nil {
+				t.Fatal("expected error")
+			}
+
+			if c.CircuitState() != CircuitClosed {
+				t.Errorf("expected closed circuit but got %s", c.CircuitState())
+			}
+		})
+	}
+
+	t.Run("evaluator error", func(t *testing.T) {
+		c := NewClient(SetEvaluator(Policies{}), SetCircuitBreaker(1, time.Minute))
+		if _, err := c.Decide(context.Background(), "cw/other", nil); !errors.Is(err, ErrUnknownPackage) {
+			t.Fatalf("expected error %v but got %v", ErrUnknownPackage, err)
+		}
+
+		if c.CircuitState() != CircuitClosed {
+			t.Errorf("expected closed circuit but got %s", c.CircuitState())
+		}
+	})
+}
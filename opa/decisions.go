@@ -0,0 +1,176 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opa
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/CoverWhale/coverwhale-go/metrics"
+	"github.com/CoverWhale/logr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DecisionRecord is the structured log of an enforced or shadowed decision made by a middleware
+type DecisionRecord struct {
+	Timestamp time.Time       `json:"timestamp"`
+	RequestID string          `json:"request_id,omitempty"`
+	Package   string          `json:"package"`
+	InputHash string          `json:"input_hash"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Allowed   bool            `json:"allowed"`
+	Shadow    bool            `json:"shadow"`
+	Latency   time.Duration   `json:"latency_ns"`
+	Error     string          `json:"error,omitempty"`
+	// Source is where the decision came from, SourceOPA or SourceLastDecision
+	Source string `json:"source,omitempty"`
+}
+
+const (
+	// SourceOPA is a decision made by OPA
+	SourceOPA = "opa"
+	// SourceLastDecision is the last decision for the input used when OPA couldn't be reached
+	SourceLastDecision = "last_decision"
+)
+
+// Outcome returns allow, deny, or error for the record
+func (d DecisionRecord) Outcome() string {
+	switch {
+	case d.Error != "":
+		return "error"
+	case d.Allowed:
+		return "allow"
+	default:
+		return "deny"
+	}
+}
+
+// DecisionSink receives decision records
+type DecisionSink interface {
+	WriteDecision(DecisionRecord) error
+}
+
+// DecisionSinkFunc is a function that fulfills the DecisionSink interface
+type DecisionSinkFunc func(DecisionRecord) error
+
+// WriteDecision fulfills the DecisionSink interface
+func (d DecisionSinkFunc) WriteDecision(r DecisionRecord) error {
+	return d(r)
+}
+
+// LoggerSink writes decision records to the logger
+func LoggerSink(l *logr.Logger) DecisionSink {
+	return DecisionSinkFunc(func(r DecisionRecord) error {
+		l.WithContext(map[string]string{
+			"request_id": r.RequestID,
+			"package":    r.Package,
+			"input_hash": r.InputHash,
+			"decision":   r.Outcome(),
+			"shadow":     strconv.FormatBool(r.Shadow),
+		}).Infof("policy decision result: %s latency: %s error: %s", r.Result, r.Latency, r.Error)
+
+		return nil
+	})
+}
+
+// WriterSink writes each decision record as a line of JSON. A NatsLogger can be used to publish records
+// to a NATS subject.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink returns a sink that writes to w
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// NewFileSink returns a sink that appends to the file, creating it if needed
+func NewFileSink(path string) (*WriterSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening decision log: %w", err)
+	}
+
+	return NewWriterSink(f), nil
+}
+
+// WriteDecision fulfills the DecisionSink interface
+func (s *WriterSink) WriteDecision(r DecisionRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the underlying writer if it is an io.Closer
+func (s *WriterSink) Close() error {
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+// DecisionMetrics counts decisions by package, outcome, mode, and source. Share one DecisionMetrics between
+// middlewares since the counter can only be registered once.
+type DecisionMetrics struct {
+	decisions *prometheus.CounterVec
+}
+
+// NewDecisionMetrics creates the decision counter and adds it to the exporter if it isn't nil
+func NewDecisionMetrics(e *metrics.Exporter) *DecisionMetrics {
+	m := &DecisionMetrics{
+		decisions: metrics.NewCounterVec("opa_decisions_total", "Total policy decisions by package and outcome", []string{"package", "decision", "mode", "source"}),
+	}
+
+	if e != nil {
+		e.Metrics = append(e.Metrics, m.decisions)
+	}
+
+	return m
+}
+
+// Collectors returns the metrics so they can be registered manually
+func (m *DecisionMetrics) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.decisions}
+}
+
+// WriteDecision fulfills the DecisionSink interface so the metrics can be used as a sink
+func (m *DecisionMetrics) WriteDecision(r DecisionRecord) error {
+	mode := "enforce"
+	if r.Shadow {
+		mode = "shadow"
+	}
+
+	source := r.Source
+	if source == "" {
+		source = SourceOPA
+	}
+
+	m.decisions.WithLabelValues(r.Package, r.Outcome(), mode, source).Inc()
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+var ErrUnknownPackage = fmt.Errorf("no policy for package")
+
+// Evaluator evaluates a policy package in process instead of calling an OPA server. The input is the JSON
+// encoded input document and the returned value is the JSON encoded result document. A Rego bundle can be
+// evaluated without a sidecar by wrapping a prepared query from github.com/open-policy-agent/opa/rego:
+//
+//	query, _ := rego.New(rego.Query("data.cw.underwriting"), rego.LoadBundle("./bundle")).PrepareForEval(ctx)
+//
+//	evaluator := opa.EvaluatorFunc(func(ctx context.Context, pkg string, input json.RawMessage) (json.RawMessage, error) {
+//		var in any
+//		if err := json.Unmarshal(input, &in); err != nil {
+//			return nil, err
+//		}
+//		rs, err := query.Eval(ctx, rego.EvalInput(in))
+//		if err != nil || len(rs) == 0 {
+//			return nil, err
+//		}
+//		return json.Marshal(rs[0].Expressions[0].Value)
+//	})
+type Evaluator interface {
+	Evaluate(ctx context.Context, pkg string, input json.RawMessage) (json.RawMessage, error)
+}
+
+// EvaluatorFunc allows a plain function to be used as an Evaluator
+type EvaluatorFunc func(ctx context.Context, pkg string, input json.RawMessage) (json.RawMessage, error)
+
+// Evaluate satisfies the Evaluator interface
+func (e EvaluatorFunc) Evaluate(ctx context.Context, pkg string, input json.RawMessage) (json.RawMessage, error) {
+	return e(ctx, pkg, input)
+}
+
+// PolicyFunc is a policy written in Go. It receives the input document and returns the result document.
+type PolicyFunc func(ctx context.Context, input json.RawMessage) (any, error)
+
+// Policies is an Evaluator that maps package names, such as cw/underwriting, to Go policies. It is useful
+// for tests and for simple rules that don't need Rego.
+type Policies map[string]PolicyFunc
+
+// Evaluate runs the policy registered for the package
+func (p Policies) Evaluate(ctx context.Context, pkg string, input json.RawMessage) (json.RawMessage, error) {
+	policy, ok := p[pkg]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPackage, pkg)
+	}
+
+	result, err := policy(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(result)
+}
@@ -21,52 +21,28 @@ const (
 
 type OPAURL string
 
-type OPAResponse struct {
-	Result Result `json:"result"`
-}
-type OPARequest struct {
-	Input Input `json:"input"`
-}
-
-type Result struct {
-	Allow bool     `json:"allow"`
-	Deny  []string `json:"deny,omitempty"`
+// OPARequest is the request document sent to OPA. T is the input document for the policy package.
+type OPARequest[T any] struct {
+	Input T `json:"input"`
 }
 
-// Decision should be called at a /decision endpoint.
-type Decision struct {
-	Allowed  bool     `json:"allowed"`
-	Denials  []string `json:"denials,omitempty"`
-	Carriers []string `json:"carriers,omitempty"`
+// OPAResponse is the response document from OPA. R is the result document of the policy package.
+type OPAResponse[R any] struct {
+	Result R `json:"result"`
 }
 
-type Input struct {
-	State       string    `json:"state"`
-	Operation   string    `json:"operation"`
-	Commodities []string  `json:"commodities"`
-	Drivers     []Driver  `json:"drivers"`
-	Vehicles    []Vehicle `json:"vehicles"`
-	Trailers    []Trailer `json:"trailers"`
+// Decider is implemented by result documents that can be enforced by the middlewares
+type Decider interface {
+	IsAllowed() bool
 }
 
-type Driver struct {
-	ID         string   `json:"id"`
-	Experience int      `json:"experience"`
-	Age        int      `json:"age"`
-	AVDs       []string `json:"avds"`
-}
-
-type Vehicle struct {
-	ID        string `json:"id"`
-	BodyType  string `json:"body_type"`
-	Class     int    `json:"class"`
-	ModelYear int    `json:"model_year"`
-	Amount    int    `json:"amount"`
+// Result is the default result document with an allow rule and a set of deny messages
+type Result struct {
+	Allow bool     `json:"allow"`
+	Deny  []string `json:"deny,omitempty"`
 }
 
-type Trailer struct {
-	ID          string `json:"id"`
-	TrailerType string `json:"trailer_type"`
-	ModelYear   int    `json:"model_year"`
-	Amount      int    `json:"amount"`
+// IsAllowed satisfies the Decider interface
+func (r Result) IsAllowed() bool {
+	return r.Allow
 }
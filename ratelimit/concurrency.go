@@ -0,0 +1,233 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	cwerrors "github.com/CoverWhale/coverwhale-go/errors"
+	"github.com/CoverWhale/coverwhale-go/transports/http/middleware"
+	"github.com/CoverWhale/logr"
+	"github.com/nats-io/nats.go/micro"
+)
+
+// ConcurrencyOption is a functional option to modify the adaptive concurrency limit
+type ConcurrencyOption func(*ConcurrencyLimiter)
+
+// ConcurrencyLimiter limits the requests in flight. The limit adapts to latency: it grows by one for each
+// limit's worth of fast requests and is cut when the smoothed latency rises above the tolerance times the
+// lowest latency seen, or when requests fail. Using the smoothed latency means jitter and the odd slow request
+// don't cut the limit.
+type ConcurrencyLimiter struct {
+	mu        sync.Mutex
+	limit     float64
+	min       int
+	max       int
+	inflight  int
+	tolerance float64
+	backoff   float64
+	smoothing float64
+	window    int
+	samples   int
+	sinceCut  int
+	rtt       time.Duration
+	minRTT    time.Duration
+	nextMin   time.Duration
+	retry     time.Duration
+}
+
+// SetLimits sets the initial, minimum, and maximum concurrency limits. The defaults are 20, 1, and 1000.
+func SetLimits(initial, min, max int) ConcurrencyOption {
+	return func(c *ConcurrencyLimiter) {
+		c.limit = float64(initial)
+		c.min = min
+		c.max = max
+	}
+}
+
+// SetLatencyTolerance sets how much slower than the lowest latency the smoothed latency can be before the
+// limit is cut. The default is 2.
+func SetLatencyTolerance(t float64) ConcurrencyOption {
+	return func(c *ConcurrencyLimiter) {
+		c.tolerance = t
+	}
+}
+
+// SetBackoff sets the factor the limit is multiplied by when it is cut. The default is 0.9.
+func SetBackoff(b float64) ConcurrencyOption {
+	return func(c *ConcurrencyLimiter) {
+		c.backoff = b
+	}
+}
+
+// SetSmoothing sets the weight of each request's latency in the smoothed latency, between 0 and 1. Lower
+// values ride out more jitter but react to overload more slowly. The default is 0.05.
+func SetSmoothing(s float64) ConcurrencyOption {
+	return func(c *ConcurrencyLimiter) {
+		c.smoothing = s
+	}
+}
+
+// SetRetryAfter sets the Retry-After sent with rejected requests. The default is 1 second.
+func SetRetryAfter(d time.Duration) ConcurrencyOption {
+	return func(c *ConcurrencyLimiter) {
+		c.retry = d
+	}
+}
+
+// NewConcurrencyLimiter returns an adaptive concurrency limiter. Use one limiter per route or endpoint.
+func NewConcurrencyLimiter(opts ...ConcurrencyOption) *ConcurrencyLimiter {
+	c := &ConcurrencyLimiter{
+		limit:     20,
+		min:       1,
+		max:       1000,
+		tolerance: 2,
+		backoff:   0.9,
+		smoothing: 0.05,
+		window:    500,
+		retry:     time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Limit returns the current limit
+func (c *ConcurrencyLimiter) Limit() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return int(c.limit)
+}
+
+// Acquire reserves a slot and returns the func to release it with the request's outcome, or a RateLimited
+// client error if the limit is reached
+func (c *ConcurrencyLimiter) Acquire() (func(failed bool), error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.inflight >= int(c.limit) {
+		return nil, cwerrors.RateLimited(c.retry)
+	}
+
+	c.inflight++
+	start := time.Now()
+
+	return func(failed bool) {
+		c.release(time.Since(start), failed)
+	}, nil
+}
+
+func (c *ConcurrencyLimiter) release(rtt time.Duration, failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.inflight--
+	c.sinceCut++
+
+	if c.rtt == 0 {
+		c.rtt = rtt
+	} else {
+		c.rtt = time.Duration(float64(c.rtt)*(1-c.smoothing) + float64(rtt)*c.smoothing)
+	}
+
+	// track the lowest latency over a window so the baseline follows changes in the service
+	if c.nextMin == 0 || rtt < c.nextMin {
+		c.nextMin = rtt
+	}
+	if c.minRTT == 0 || rtt < c.minRTT {
+		c.minRTT = rtt
+	}
+	c.samples++
+	if c.samples >= c.window {
+		c.minRTT = c.nextMin
+		c.nextMin = 0
+		c.samples = 0
+	}
+
+	if failed {
+		c.cut(c.backoff)
+		return
+	}
+
+	// the gradient is below 1 when the smoothed latency is over the tolerance and the limit is cut by at least
+	// the backoff and at most half. The smoothed latency takes a while to come down, so the limit is only cut
+	// once per limit's worth of requests.
+	gradient := float64(c.minRTT) * c.tolerance / float64(c.rtt)
+	if gradient < 1 {
+		if c.sinceCut >= int(c.limit) {
+			c.cut(math.Max(0.5, math.Min(c.backoff, gradient)))
+		}
+		return
+	}
+
+	c.limit = math.Min(float64(c.max), c.limit+1/c.limit)
+}
+
+func (c *ConcurrencyLimiter) cut(factor float64) {
+	c.limit = math.Max(float64(c.min), c.limit*factor)
+	c.sinceCut = 0
+}
+
+// Adaptive returns a middleware that limits the requests in flight. A 5xx response counts as a failure. Each call
+// of the returned func gets its own limit, so wrap route handlers for per route limits.
+func Adaptive(opts ...ConcurrencyOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		c := NewConcurrencyLimiter(opts...)
+		return c.Middleware(h)
+	}
+}
+
+// Middleware limits the requests in flight for the handler. A 5xx response counts as a failure.
+func (c *ConcurrencyLimiter) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		done, err := c.Acquire()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		rec := &middleware.StatusRec{ResponseWriter: w, Status: http.StatusOK}
+		defer func() {
+			done(rec.Status >= http.StatusInternalServerError)
+		}()
+
+		h.ServeHTTP(rec, r)
+	})
+}
+
+// NATSHandler limits the requests in flight for a NATS micro endpoint. Errors that aren't client errors count
+// as failures. The handler has the same signature as a HandlerWithErrors.
+func (c *ConcurrencyLimiter) NATSHandler(h func(*logr.Logger, micro.Request) error) func(*logr.Logger, micro.Request) error {
+	return func(logger *logr.Logger, r micro.Request) error {
+		done, err := c.Acquire()
+		if err != nil {
+			return err
+		}
+
+		err = h(logger, r)
+		var ce cwerrors.ClientError
+		done(err != nil && !errors.As(err, &ce))
+
+		return err
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// KVStore keeps token buckets in a JetStream KV bucket so every replica of a service shares the same limits.
+// Updates use the entry revision so concurrent replicas don't overwrite each other. Set a TTL on the KV bucket
+// to remove idle buckets.
+type KVStore struct {
+	kv      nats.KeyValue
+	retries int
+	now     func() time.Time
+}
+
+// NewKVStore returns a store for the KV bucket
+func NewKVStore(kv nats.KeyValue) *KVStore {
+	return &KVStore{
+		kv:      kv,
+		retries: 5,
+		now:     time.Now,
+	}
+}
+
+// Take fulfills the Store interface
+func (k *KVStore) Take(ctx context.Context, key string, rate Rate) (bool, time.Duration, error) {
+	kvKey := kvKey(key)
+
+	for attempt := 0; attempt <= k.retries; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return false, 0, err
+		}
+
+		var b Bucket
+		var revision uint64
+
+		entry, err := k.kv.Get(kvKey)
+		switch {
+		case errors.Is(err, nats.ErrKeyNotFound):
+		case err != nil:
+			return false, 0, err
+		default:
+			revision = entry.Revision()
+			if err := json.Unmarshal(entry.Value(), &b); err != nil {
+				return false, 0, fmt.Errorf("error decoding bucket %s: %w", key, err)
+			}
+		}
+
+		allowed, retryAfter := b.take(rate, k.now())
+
+		data, err := json.Marshal(b)
+		if err != nil {
+			return false, 0, err
+		}
+
+		if revision == 0 {
+			_, err = k.kv.Create(kvKey, data)
+		} else {
+			_, err = k.kv.Update(kvKey, data, revision)
+		}
+
+		// another replica updated the bucket first
+		if errors.Is(err, nats.ErrKeyExists) {
+			continue
+		}
+		if err != nil {
+			return false, 0, err
+		}
+
+		return allowed, retryAfter, nil
+	}
+
+	return false, 0, fmt.Errorf("too many conflicts updating bucket %s", key)
+}
+
+// kvKey hashes the key since KV keys only allow a limited set of characters
+func kvKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:16])
+}
@@ -0,0 +1,71 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps token buckets in memory. Buckets that haven't been used for an hour are removed.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*Bucket
+	idle    time.Duration
+	swept   time.Time
+	now     func() time.Time
+}
+
+// NewMemoryStore returns an empty in memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*Bucket),
+		idle:    time.Hour,
+		now:     time.Now,
+	}
+}
+
+// Take fulfills the Store interface
+func (m *MemoryStore) Take(ctx context.Context, key string, rate Rate) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &Bucket{}
+		m.buckets[key] = b
+	}
+
+	allowed, retryAfter := b.take(rate, now)
+	return allowed, retryAfter, nil
+}
+
+// sweep removes idle buckets at most once per idle period
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.swept) < m.idle {
+		return
+	}
+	m.swept = now
+
+	for k, v := range m.buckets {
+		if now.Sub(v.Last) > m.idle {
+			delete(m.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimit sheds load with token bucket rate limits and adaptive concurrency limits for HTTP
+// handlers and NATS micro endpoints.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/CoverWhale/coverwhale-go/auth"
+	cwerrors "github.com/CoverWhale/coverwhale-go/errors"
+	cwnats "github.com/CoverWhale/coverwhale-go/transports/nats"
+	"github.com/CoverWhale/logr"
+	"github.com/nats-io/nats.go/micro"
+)
+
+// Rate is a token bucket that refills Requests tokens every Per and holds at most Burst tokens. Burst
+// defaults to Requests.
+type Rate struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// PerSecond returns a rate of n requests per second
+func PerSecond(n int) Rate {
+	return Rate{Requests: n, Per: time.Second}
+}
+
+// PerMinute returns a rate of n requests per minute
+func PerMinute(n int) Rate {
+	return Rate{Requests: n, Per: time.Minute}
+}
+
+func (r Rate) burst() float64 {
+	if r.Burst > 0 {
+		return float64(r.Burst)
+	}
+
+	return float64(r.Requests)
+}
+
+// perToken is the time it takes to refill one token
+func (r Rate) perToken() time.Duration {
+	if r.Requests <= 0 {
+		return r.Per
+	}
+
+	return r.Per / time.Duration(r.Requests)
+}
+
+// Bucket is the state of a token bucket
+type Bucket struct {
+	Tokens float64   `json:"tokens"`
+	Last   time.Time `json:"last"`
+}
+
+// take refills the bucket for the time since it was last used and takes a token. If there isn't a token
+// the time until one is available is returned.
+func (b *Bucket) take(rate Rate, now time.Time) (bool, time.Duration) {
+	if b.Last.IsZero() {
+		b.Tokens = rate.burst()
+	} else if elapsed := now.Sub(b.Last); elapsed > 0 {
+		b.Tokens = math.Min(rate.burst(), b.Tokens+elapsed.Seconds()/rate.perToken().Seconds())
+	}
+	b.Last = now
+
+	if b.Tokens >= 1 {
+		b.Tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - b.Tokens) * float64(rate.perToken()))
+}
+
+// Store keeps token buckets by key
+type Store interface {
+	// Take takes a token from the bucket for the key. If the request isn't allowed the time until a token
+	// is available is returned.
+	Take(ctx context.Context, key string, rate Rate) (bool, time.Duration, error)
+}
+
+// KeyFunc returns the key an HTTP request is limited by
+type KeyFunc func(*http.Request) string
+
+// NATSKeyFunc returns the key a NATS micro request is limited by
+type NATSKeyFunc func(micro.Request) string
+
+// KeyByIP limits requests by the client IP. X-Forwarded-For is only used when the request comes from one of
+// the trusted proxies, and then the client is the rightmost address that isn't a trusted proxy since the
+// entries to its left can be set by the client. Without trusted proxies the remote address is used.
+func KeyByIP(trusted ...netip.Prefix) KeyFunc {
+	isTrusted := func(addr netip.Addr) bool {
+		for _, p := range trusted {
+			if p.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(r *http.Request) string {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+
+		remote, err := netip.ParseAddr(host)
+		if err != nil || !isTrusted(remote) {
+			return "ip:" + host
+		}
+
+		hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop == "" {
+				continue
+			}
+
+			addr, err := netip.ParseAddr(hop)
+			if err != nil || !isTrusted(addr) {
+				return "ip:" + hop
+			}
+			host = hop
+		}
+
+		// every hop is a trusted proxy so the leftmost one is the closest to the client
+		return "ip:" + host
+	}
+}
+
+// KeyByHeader limits requests by the value of a header
+func KeyByHeader(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return "header:" + r.Header.Get(name)
+	}
+}
+
+// KeyByPrincipal limits requests by the principal stored by auth.Middleware. Anonymous requests are
+// limited by the fallback.
+func KeyByPrincipal(fallback KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+			return "principal:" + p.Subject
+		}
+
+		return fallback(r)
+	}
+}
+
+// NATSKeyByHeader limits NATS requests by the value of a header
+func NATSKeyByHeader(name string) NATSKeyFunc {
+	return func(r micro.Request) string {
+		return "header:" + r.Headers().Get(name)
+	}
+}
+
+// NATSKeyByPrincipal limits NATS requests by the principal from auth.NATSHandler. Anonymous requests are
+// limited by the fallback.
+func NATSKeyByPrincipal(fallback NATSKeyFunc) NATSKeyFunc {
+	return func(r micro.Request) string {
+		if p, ok := auth.NATSPrincipal(r); ok {
+			return "principal:" + p.Subject
+		}
+
+		return fallback(r)
+	}
+}
+
+// LimiterOption is a functional option to modify the Limiter
+type LimiterOption func(*Limiter)
+
+// Limiter rate limits requests with a token bucket per key
+type Limiter struct {
+	store   Store
+	rate    Rate
+	key     KeyFunc
+	natsKey NATSKeyFunc
+	prefix  string
+}
+
+// SetKeyFunc sets how HTTP requests are keyed. The default is the principal, then the client IP.
+func SetKeyFunc(k KeyFunc) LimiterOption {
+	return func(l *Limiter) {
+		l.key = k
+	}
+}
+
+// SetNATSKeyFunc sets how NATS requests are keyed. The default is the principal, then the subject.
+func SetNATSKeyFunc(k NATSKeyFunc) LimiterOption {
+	return func(l *Limiter) {
+		l.natsKey = k
+	}
+}
+
+// SetPrefix prefixes every key so limiters with different rates can share a store
+func SetPrefix(p string) LimiterOption {
+	return func(l *Limiter) {
+		l.prefix = p
+	}
+}
+
+// NewLimiter returns a limiter for the rate with its state in the store
+func NewLimiter(store Store, rate Rate, opts ...LimiterOption) *Limiter {
+	l := &Limiter{
+		store:   store,
+		rate:    rate,
+		key:     KeyByPrincipal(KeyByIP()),
+		natsKey: NATSKeyByPrincipal(func(r micro.Request) string { return "subject:" + r.Subject() }),
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+// Allow takes a token for the key and returns a RateLimited client error if there isn't one. If the store
+// fails the request is allowed so a store outage doesn't take down the service.
+func (l *Limiter) Allow(ctx context.Context, key string) error {
+	ok, retryAfter, err := l.store.Take(ctx, l.prefix+key, l.rate)
+	if err != nil {
+		logr.Errorf("error checking rate limit: %v", err)
+		return nil
+	}
+
+	if !ok {
+		return cwerrors.RateLimited(retryAfter)
+	}
+
+	return nil
+}
+
+// Middleware rate limits HTTP requests. It can be passed to RegisterSubRouter.
+func (l *Limiter) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := l.Allow(r.Context(), l.key(r)); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// NATSHandler rate limits a NATS micro endpoint. The store is called with the trace context from the request
+// headers. The handler has the same signature as a HandlerWithErrors.
+func (l *Limiter) NATSHandler(h func(*logr.Logger, micro.Request) error) func(*logr.Logger, micro.Request) error {
+	return func(logger *logr.Logger, r micro.Request) error {
+		if err := l.Allow(cwnats.HeaderContext(context.Background(), r.Headers()), l.natsKey(r)); err != nil {
+			return err
+		}
+
+		return h(logger, r)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	ce, ok := err.(cwerrors.ClientError)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	for k, v := range ce.ResponseHeaders() {
+		w.Header().Set(k, v)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(ce.Code())
+	w.Write(ce.Body())
+}
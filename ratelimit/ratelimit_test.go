@@ -0,0 +1,280 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+type kvEntry struct {
+	nats.KeyValueEntry
+	value    []byte
+	revision uint64
+}
+
+func (k kvEntry) Value() []byte    { return k.value }
+func (k kvEntry) Revision() uint64 { return k.revision }
+
+// testKV is the part of a KV bucket used by the store
+type testKV struct {
+	nats.KeyValue
+	mu       sync.Mutex
+	entries  map[string]kvEntry
+	revision uint64
+}
+
+func (t *testKV) Get(key string) (nats.KeyValueEntry, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.entries[key]
+	if !ok {
+		return nil, nats.ErrKeyNotFound
+	}
+	return e, nil
+}
+
+func (t *testKV) Create(key string, value []byte) (uint64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.entries[key]; ok {
+		return 0, nats.ErrKeyExists
+	}
+	t.revision++
+	t.entries[key] = kvEntry{value: value, revision: t.revision}
+	return t.revision, nil
+}
+
+func (t *testKV) Update(key string, value []byte, last uint64) (uint64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.entries[key].revision != last {
+		return 0, nats.ErrKeyExists
+	}
+	t.revision++
+	t.entries[key] = kvEntry{value: value, revision: t.revision}
+	return t.revision, nil
+}
+
+func TestStores(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	memory := NewMemoryStore()
+	memory.now = clock
+	kv := NewKVStore(&testKV{entries: make(map[string]kvEntry)})
+	kv.now = clock
+
+	stores := map[string]Store{"memory": memory, "kv": kv}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			rate := Rate{Requests: 2, Per: time.Second}
+
+			for i := 0; i < 2; i++ {
+				ok, _, err := store.Take(context.Background(), "key", rate)
+				if err != nil || !ok {
+					t.Fatalf("expected request %d to be allowed: %v", i, err)
+				}
+			}
+
+			ok, retryAfter, err := store.Take(context.Background(), "key", rate)
+			if err != nil || ok {
+				t.Fatalf("expected request to be limited: %v", err)
+			}
+			if retryAfter != 500*time.Millisecond {
+				t.Errorf("expected retry after 500ms but got %s", retryAfter)
+			}
+
+			ok, _, _ = store.Take(context.Background(), "other", rate)
+			if !ok {
+				t.Error("expected other key to be allowed")
+			}
+
+			now = now.Add(500 * time.Millisecond)
+			ok, _, _ = store.Take(context.Background(), "key", rate)
+			if !ok {
+				t.Error("expected refilled token to be allowed")
+			}
+		})
+	}
+}
+
+func TestLimiterMiddleware(t *testing.T) {
+	l := NewLimiter(NewMemoryStore(), Rate{Requests: 1, Per: time.Minute}, SetKeyFunc(KeyByHeader("X-Client")))
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tt := []struct {
+		name       string
+		client     string
+		status     int
+		retryAfter string
+	}{
+		{name: "first request", client: "a", status: http.StatusOK},
+		{name: "limited", client: "a", status: http.StatusTooManyRequests, retryAfter: "60"},
+		{name: "other client", client: "b", status: http.StatusOK},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Client", v.client)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != v.status {
+				t.Errorf("expected status %d but got %d", v.status, w.Code)
+			}
+			if w.Header().Get("Retry-After") != v.retryAfter {
+				t.Errorf("expected Retry-After %q but got %q", v.retryAfter, w.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestKeyByIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tt := []struct {
+		name      string
+		trusted   []netip.Prefix
+		remote    string
+		forwarded []string
+		expected  string
+	}{
+		{name: "no proxy", remote: "192.0.2.1:1234", expected: "ip:192.0.2.1"},
+		{name: "untrusted forwarded", remote: "192.0.2.1:1234", forwarded: []string{"198.51.100.1"}, expected: "ip:192.0.2.1"},
+		{name: "untrusted remote", trusted: trusted, remote: "192.0.2.1:1234", forwarded: []string{"198.51.100.1"}, expected: "ip:192.0.2.1"},
+		{name: "trusted proxy", trusted: trusted, remote: "10.0.0.1:1234", forwarded: []string{"198.51.100.1"}, expected: "ip:198.51.100.1"},
+		{name: "spoofed hop", trusted: trusted, remote: "10.0.0.1:1234", forwarded: []string{"203.0.113.9, 198.51.100.1"}, expected: "ip:198.51.100.1"},
+		{name: "trusted hops", trusted: trusted, remote: "10.0.0.1:1234", forwarded: []string{"203.0.113.9, 198.51.100.1", "10.0.0.2"}, expected: "ip:198.51.100.1"},
+		{name: "all trusted", trusted: trusted, remote: "10.0.0.1:1234", forwarded: []string{"10.0.0.3, 10.0.0.2"}, expected: "ip:10.0.0.3"},
+		{name: "no forwarded", trusted: trusted, remote: "10.0.0.1:1234", expected: "ip:10.0.0.1"},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = v.remote
+			for _, f := range v.forwarded {
+				req.Header.Add("X-Forwarded-For", f)
+			}
+
+			if key := KeyByIP(v.trusted...)(req); key != v.expected {
+				t.Errorf("expected key %s but got %s", v.expected, key)
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	c := NewConcurrencyLimiter(SetLimits(2, 1, 10))
+
+	first, err := c.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Acquire(); err == nil {
+		t.Fatal("expected limit to be reached")
+	}
+
+	first(true)
+	second(true)
+	c.minRTT = time.Millisecond
+
+	if c.Limit() != 1 {
+		t.Errorf("expected failures to cut the limit to 1 but got %d", c.Limit())
+	}
+
+	// use a fixed latency so the limit only depends on the outcomes
+	for i := 0; i < 10; i++ {
+		if _, err := c.Acquire(); err != nil {
+			t.Fatal(err)
+		}
+		c.release(time.Millisecond, false)
+	}
+
+	if c.Limit() < 2 {
+		t.Errorf("expected successes to raise the limit but got %d", c.Limit())
+	}
+}
+
+func TestConcurrencyLimiterLatency(t *testing.T) {
+	tt := []struct {
+		name     string
+		latency  func(r *rand.Rand, i int) time.Duration
+		requests int
+		check    func(limit int) bool
+	}{
+		{
+			// between 1x and 2.5x the lowest latency with the odd request at 5x
+			name: "jitter",
+			latency: func(r *rand.Rand, i int) time.Duration {
+				if i%100 == 0 {
+					return 5 * time.Millisecond
+				}
+				return time.Millisecond + time.Duration(r.Int63n(int64(1500*time.Microsecond)))
+			},
+			requests: 2000,
+			check:    func(limit int) bool { return limit >= 20 },
+		},
+		{
+			name: "overload",
+			latency: func(r *rand.Rand, i int) time.Duration {
+				if i < 100 {
+					return time.Millisecond
+				}
+				return 4*time.Millisecond + time.Duration(r.Int63n(int64(time.Millisecond)))
+			},
+			// stay within the window the lowest latency is kept for
+			requests: 400,
+			check:    func(limit int) bool { return limit < 5 },
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			c := NewConcurrencyLimiter(SetLimits(20, 1, 100))
+			r := rand.New(rand.NewSource(1))
+
+			for i := 0; i < v.requests; i++ {
+				if _, err := c.Acquire(); err != nil {
+					t.Fatal(err)
+				}
+				c.release(v.latency(r, i), false)
+			}
+
+			if !v.check(c.Limit()) {
+				t.Errorf("unexpected limit %d", c.Limit())
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package correlation carries the correlation ID and trace context between services in NATS headers
+package correlation
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Header is the header the correlation ID is sent in
+const Header = "X-Correlation-Id"
+
+type idKey struct{}
+
+// WithID adds a correlation ID to the context
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idKey{}, id)
+}
+
+// FromContext returns the correlation ID added by WithID or Extract
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(idKey{}).(string)
+	return id, ok && id != ""
+}
+
+// Extract returns a context with the trace context and correlation ID from headers
+func Extract(ctx context.Context, headers map[string][]string) context.Context {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(headers))
+
+	if id := nats.Header(headers).Get(Header); id != "" {
+		ctx = WithID(ctx, id)
+	}
+
+	return ctx
+}
+
+// Inject adds the trace context and correlation ID from the context to headers
+func Inject(ctx context.Context, headers map[string][]string) {
+	if id, ok := FromContext(ctx); ok {
+		nats.Header(headers).Set(Header, id)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(headers))
+}
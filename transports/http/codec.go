@@ -0,0 +1,140 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Codec encodes responses and decodes request bodies for a content type
+type Codec interface {
+	ContentType() string
+	Encode(w io.Writer, v any) error
+	Decode(r io.Reader, v any) error
+}
+
+// JSONCodec is the default codec
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string {
+	return "application/json"
+}
+
+func (JSONCodec) Encode(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (JSONCodec) Decode(r io.Reader, v any) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+// codecs are in preference order. The first codec is used when the client accepts anything.
+type codecs []Codec
+
+var defaultCodecs = codecs{JSONCodec{}}
+
+// with returns the codecs with c added. A codec for a content type that is already there replaces it.
+func (cs codecs) with(c Codec) codecs {
+	added := append(codecs(nil), cs...)
+	for i, v := range added {
+		if v.ContentType() == c.ContentType() {
+			added[i] = c
+			return added
+		}
+	}
+
+	return append(added, c)
+}
+
+// forContentType returns the codec for a request Content-Type. An empty content type uses the default codec.
+func (cs codecs) forContentType(contentType string) (Codec, bool) {
+	if contentType == "" {
+		return cs[0], true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+
+	for _, v := range cs {
+		if v.ContentType() == mediaType {
+			return v, true
+		}
+	}
+
+	return nil, false
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// negotiate returns the codec for the Accept header. Ranges are tried in order of quality and the default
+// codec is used when the header is empty.
+func (cs codecs) negotiate(accept string) (Codec, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return cs[0], true
+	}
+
+	var ranges []acceptRange
+	for _, v := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if val, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(val, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	for _, r := range ranges {
+		for _, c := range cs {
+			if mediaTypeMatches(r.mediaType, c.ContentType()) {
+				return c, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func mediaTypeMatches(pattern, mediaType string) bool {
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+
+	prefix, ok := strings.CutSuffix(pattern, "/*")
+	return ok && strings.HasPrefix(mediaType, prefix+"/")
+}
@@ -0,0 +1,395 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/executor"
+	cwmiddleware "github.com/CoverWhale/coverwhale-go/transports/http/middleware"
+	"github.com/CoverWhale/logr"
+	"golang.org/x/net/websocket"
+)
+
+// GraphQLWSProtocol is the websocket subprotocol of the graphql-ws library
+const GraphQLWSProtocol = "graphql-transport-ws"
+
+// graphql-transport-ws message types
+const (
+	wsConnectionInit = "connection_init"
+	wsConnectionAck  = "connection_ack"
+	wsPing           = "ping"
+	wsPong           = "pong"
+	wsSubscribe      = "subscribe"
+	wsNext           = "next"
+	wsError          = "error"
+	wsComplete       = "complete"
+)
+
+// graphql-transport-ws close codes
+const (
+	wsCloseNormal          = 1000
+	wsCloseInvalidMessage  = 4400
+	wsCloseUnauthorized    = 4401
+	wsCloseForbidden       = 4403
+	wsCloseInitTimeout     = 4408
+	wsCloseDuplicateID     = 4409
+	wsCloseTooManyInitReqs = 4429
+)
+
+var errInvalidMessage = fmt.Errorf("invalid graphql-transport-ws message")
+
+// DefaultConnectionInitTimeout is how long a client has to send connection_init
+const DefaultConnectionInitTimeout = 3 * time.Second
+
+// GraphQLWSOption is a functional option to modify a handler created by GraphQLWebSocket
+type GraphQLWSOption func(*graphQLWS)
+
+// ConnectionInitFunc checks the connection_init payload and returns the context operations run with. An
+// error closes the connection as forbidden.
+type ConnectionInitFunc func(ctx context.Context, payload map[string]any) (context.Context, error)
+
+type graphQLWS struct {
+	exec        *executor.Executor
+	extensions  []graphql.HandlerExtension
+	initTimeout time.Duration
+	init        ConnectionInitFunc
+	origins     cwmiddleware.CORSPolicy
+	logger      *logr.Logger
+}
+
+// WithConnectionInitTimeout sets how long a client has to send connection_init before the connection is
+// closed
+func WithConnectionInitTimeout(d time.Duration) GraphQLWSOption {
+	return func(g *graphQLWS) {
+		g.initTimeout = d
+	}
+}
+
+// WithConnectionInit sets a function to authorize connections with the connection_init payload
+func WithConnectionInit(f ConnectionInitFunc) GraphQLWSOption {
+	return func(g *graphQLWS) {
+		g.init = f
+	}
+}
+
+// WithAllowedOrigins allows browsers on other origins to connect. Origins are matched like the CORS
+// middleware's AllowedOrigins, so "https://*.coverwhale.com" allows any subdomain.
+func WithAllowedOrigins(origins ...string) GraphQLWSOption {
+	return func(g *graphQLWS) {
+		g.origins.AllowedOrigins = append(g.origins.AllowedOrigins, origins...)
+	}
+}
+
+// WithGraphQLWSExtensions adds gqlgen extensions, such as extension.AutomaticPersistedQuery or
+// extension.FixedComplexityLimit, to the executor. Use the same extensions as the HTTP handler so operations
+// over websockets get the same limits and tracing.
+func WithGraphQLWSExtensions(exts ...graphql.HandlerExtension) GraphQLWSOption {
+	return func(g *graphQLWS) {
+		g.extensions = append(g.extensions, exts...)
+	}
+}
+
+// WithGraphQLWSLogger sets the logger used for connection errors
+func WithGraphQLWSLogger(l *logr.Logger) GraphQLWSOption {
+	return func(g *graphQLWS) {
+		g.logger = l
+	}
+}
+
+// GraphQLWebSocket serves GraphQL operations, including subscriptions, over websockets with the
+// graphql-transport-ws protocol. Connections without the protocol are rejected during the handshake, as are
+// browsers on other origins unless they are allowed with WithAllowedOrigins. Clients that don't send an Origin
+// header, which browsers always do, can connect.
+func GraphQLWebSocket(es graphql.ExecutableSchema, opts ...GraphQLWSOption) http.Handler {
+	g := &graphQLWS{
+		exec:        executor.New(es),
+		initTimeout: DefaultConnectionInitTimeout,
+		logger:      logr.NewLogger(),
+	}
+
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	for _, v := range g.extensions {
+		g.exec.Use(v)
+	}
+
+	return websocket.Server{
+		Handshake: func(c *websocket.Config, r *http.Request) error {
+			if err := g.checkOrigin(r); err != nil {
+				return err
+			}
+
+			for _, v := range c.Protocol {
+				if v == GraphQLWSProtocol {
+					c.Protocol = []string{GraphQLWSProtocol}
+					return nil
+				}
+			}
+			return fmt.Errorf("unsupported websocket protocol")
+		},
+		Handler: g.serve,
+	}
+}
+
+// checkOrigin stops other sites from opening connections with the user's cookies
+func (g *graphQLWS) checkOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return nil
+	}
+
+	if g.origins.AllowsOrigin(origin) {
+		return nil
+	}
+
+	return fmt.Errorf("origin %s is not allowed", origin)
+}
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type wsConn struct {
+	ws     *websocket.Conn
+	mu     sync.Mutex
+	closed bool
+	logger *logr.Logger
+}
+
+func (c *wsConn) send(msg wsMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+
+	if err := websocket.JSON.Send(c.ws, msg); err != nil {
+		c.logger.Errorf("error writing websocket message: %v", err)
+	}
+}
+
+func (c *wsConn) sendPayload(id, typ string, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		c.logger.Errorf("error encoding websocket message: %v", err)
+		return
+	}
+
+	c.send(wsMessage{ID: id, Type: typ, Payload: data})
+}
+
+// close sends a close frame with a graphql-transport-ws close code. ws.Close isn't used since it sends its own
+// close frame; websocket.Server closes the connection when serve returns.
+func (c *wsConn) close(code int, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.closed = true
+
+	frame := binary.BigEndian.AppendUint16(nil, uint16(code))
+	c.ws.PayloadType = websocket.CloseFrame
+	if _, err := c.ws.Write(append(frame, reason...)); err != nil {
+		c.logger.Debugf("error writing websocket close frame: %v", err)
+	}
+}
+
+func (g *graphQLWS) serve(ws *websocket.Conn) {
+	conn := &wsConn{ws: ws, logger: g.logger}
+	defer conn.close(wsCloseNormal, "")
+
+	ctx, cancel := context.WithCancel(ws.Request().Context())
+	defer cancel()
+
+	// the server's read and write timeouts still apply to the hijacked connection
+	ws.SetDeadline(time.Time{})
+	ws.SetReadDeadline(time.Now().Add(g.initTimeout))
+	msg, err := receive(ws)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			conn.close(wsCloseInitTimeout, "Connection initialisation timeout")
+			return
+		}
+		if errors.Is(err, errInvalidMessage) {
+			conn.close(wsCloseInvalidMessage, "invalid message")
+		}
+		return
+	}
+
+	switch msg.Type {
+	case wsConnectionInit:
+	case wsSubscribe:
+		conn.close(wsCloseUnauthorized, "Unauthorized")
+		return
+	default:
+		conn.close(wsCloseInvalidMessage, fmt.Sprintf("unexpected message %s", msg.Type))
+		return
+	}
+
+	if g.init != nil {
+		var payload map[string]any
+		if len(msg.Payload) > 0 {
+			if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+				conn.close(wsCloseInvalidMessage, "invalid connection_init payload")
+				return
+			}
+		}
+
+		ctx, err = g.init(ctx, payload)
+		if err != nil {
+			conn.close(wsCloseForbidden, "Forbidden")
+			return
+		}
+	}
+
+	ws.SetReadDeadline(time.Time{})
+	conn.send(wsMessage{Type: wsConnectionAck})
+
+	var mu sync.Mutex
+	ops := make(map[string]context.CancelFunc)
+	defer func() {
+		mu.Lock()
+		for _, v := range ops {
+			v()
+		}
+		mu.Unlock()
+	}()
+
+	for {
+		msg, err := receive(ws)
+		if err != nil {
+			if errors.Is(err, errInvalidMessage) {
+				conn.close(wsCloseInvalidMessage, "invalid message")
+			}
+			return
+		}
+
+		switch msg.Type {
+		case wsPing:
+			conn.send(wsMessage{Type: wsPong})
+		case wsPong:
+		case wsConnectionInit:
+			conn.close(wsCloseTooManyInitReqs, "Too many initialisation requests")
+			return
+		case wsSubscribe:
+			var params graphql.RawParams
+			if msg.ID == "" || json.Unmarshal(msg.Payload, &params) != nil {
+				conn.close(wsCloseInvalidMessage, "invalid subscribe message")
+				return
+			}
+
+			mu.Lock()
+			if _, ok := ops[msg.ID]; ok {
+				mu.Unlock()
+				conn.close(wsCloseDuplicateID, fmt.Sprintf("Subscriber for %s already exists", msg.ID))
+				return
+			}
+			opCtx, opCancel := context.WithCancel(ctx)
+			ops[msg.ID] = opCancel
+			mu.Unlock()
+
+			go func(id string) {
+				g.operate(opCtx, conn, id, &params)
+
+				mu.Lock()
+				delete(ops, id)
+				mu.Unlock()
+				opCancel()
+			}(msg.ID)
+		case wsComplete:
+			mu.Lock()
+			if cancel, ok := ops[msg.ID]; ok {
+				cancel()
+				delete(ops, msg.ID)
+			}
+			mu.Unlock()
+		default:
+			conn.close(wsCloseInvalidMessage, fmt.Sprintf("unexpected message %s", msg.Type))
+			return
+		}
+	}
+}
+
+// operate runs an operation and sends its responses until it ends or the client completes it
+func (g *graphQLWS) operate(ctx context.Context, conn *wsConn, id string, params *graphql.RawParams) {
+	ctx = graphql.StartOperationTrace(ctx)
+	params.ReadTime = graphql.TraceTiming{
+		Start: graphql.Now(),
+		End:   graphql.Now(),
+	}
+
+	rc, errs := g.exec.CreateOperationContext(ctx, params)
+	if errs != nil {
+		conn.sendPayload(id, wsError, errs)
+		return
+	}
+
+	responses, ctx := g.exec.DispatchOperation(ctx, rc)
+	for {
+		resp := responses(ctx)
+		if resp == nil {
+			break
+		}
+
+		// the client has already completed the operation
+		if ctx.Err() != nil {
+			return
+		}
+
+		conn.sendPayload(id, wsNext, resp)
+	}
+
+	if ctx.Err() == nil {
+		conn.send(wsMessage{ID: id, Type: wsComplete})
+	}
+}
+
+func receive(ws *websocket.Conn) (wsMessage, error) {
+	var data []byte
+	if err := websocket.Message.Receive(ws, &data); err != nil {
+		return wsMessage{}, err
+	}
+
+	var msg wsMessage
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Type == "" {
+		return wsMessage{}, errInvalidMessage
+	}
+
+	return msg, nil
+}
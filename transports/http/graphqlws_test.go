@@ -0,0 +1,325 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/validator"
+	"golang.org/x/net/websocket"
+)
+
+// testSchema resolves hello and streams count three times
+type testSchema struct {
+	schema *ast.Schema
+}
+
+func newTestSchema(t *testing.T) testSchema {
+	s, err := validator.LoadSchema(validator.Prelude, &ast.Source{Input: `
+		type Query { hello: String }
+		type Subscription { count: Int }
+	`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testSchema{schema: s}
+}
+
+func (t testSchema) Schema() *ast.Schema { return t.schema }
+
+func (t testSchema) Complexity(typeName, fieldName string, childComplexity int, args map[string]interface{}) (int, bool) {
+	return 0, false
+}
+
+func (t testSchema) Exec(ctx context.Context) graphql.ResponseHandler {
+	rc := graphql.GetOperationContext(ctx)
+	if rc.Operation.Operation != ast.Subscription {
+		done := false
+		return func(ctx context.Context) *graphql.Response {
+			if done {
+				return nil
+			}
+			done = true
+			return &graphql.Response{Data: json.RawMessage(`{"hello":"world"}`)}
+		}
+	}
+
+	count := 0
+	return func(ctx context.Context) *graphql.Response {
+		if count == 3 || ctx.Err() != nil {
+			return nil
+		}
+		count++
+		return &graphql.Response{Data: json.RawMessage(fmt.Sprintf(`{"count":%d}`, count))}
+	}
+}
+
+func dialGraphQLWS(t *testing.T, url string, protocol ...string) (*websocket.Conn, error) {
+	return dialGraphQLWSFrom(t, url, url, protocol...)
+}
+
+func dialGraphQLWSFrom(t *testing.T, url, origin string, protocol ...string) (*websocket.Conn, error) {
+	cfg, err := websocket.NewConfig(strings.Replace(url, "http", "ws", 1), origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Protocol = protocol
+
+	ws, err := websocket.DialConfig(cfg)
+	if err == nil {
+		ws.SetDeadline(time.Now().Add(5 * time.Second))
+	}
+
+	return ws, err
+}
+
+func TestGraphQLWebSocket(t *testing.T) {
+	tt := []struct {
+		name   string
+		send   []wsMessage
+		expect []wsMessage
+		closed bool
+	}{
+		{
+			name: "subscription",
+			send: []wsMessage{
+				{Type: wsConnectionInit},
+				{ID: "1", Type: wsSubscribe, Payload: json.RawMessage(`{"query":"subscription { count }"}`)},
+			},
+			expect: []wsMessage{
+				{Type: wsConnectionAck},
+				{ID: "1", Type: wsNext, Payload: json.RawMessage(`{"data":{"count":1}}`)},
+				{ID: "1", Type: wsNext, Payload: json.RawMessage(`{"data":{"count":2}}`)},
+				{ID: "1", Type: wsNext, Payload: json.RawMessage(`{"data":{"count":3}}`)},
+				{ID: "1", Type: wsComplete},
+			},
+		},
+		{
+			name: "query",
+			send: []wsMessage{
+				{Type: wsConnectionInit},
+				{ID: "1", Type: wsSubscribe, Payload: json.RawMessage(`{"query":"{ hello }"}`)},
+			},
+			expect: []wsMessage{
+				{Type: wsConnectionAck},
+				{ID: "1", Type: wsNext, Payload: json.RawMessage(`{"data":{"hello":"world"}}`)},
+				{ID: "1", Type: wsComplete},
+			},
+		},
+		{
+			name: "invalid operation",
+			send: []wsMessage{
+				{Type: wsConnectionInit},
+				{ID: "1", Type: wsSubscribe, Payload: json.RawMessage(`{"query":"{ hello"}`)},
+			},
+			expect: []wsMessage{
+				{Type: wsConnectionAck},
+				{ID: "1", Type: wsError, Payload: json.RawMessage(`[{"message":"Expected Name, found \u003cEOF\u003e","locations":[{"line":1,"column":8}],"extensions":{"code":"GRAPHQL_PARSE_FAILED"}}]`)},
+			},
+		},
+		{
+			name: "ping",
+			send: []wsMessage{
+				{Type: wsConnectionInit},
+				{Type: wsPing},
+			},
+			expect: []wsMessage{
+				{Type: wsConnectionAck},
+				{Type: wsPong},
+			},
+		},
+		{
+			name: "subscribe before init",
+			send: []wsMessage{
+				{ID: "1", Type: wsSubscribe, Payload: json.RawMessage(`{"query":"{ hello }"}`)},
+			},
+			closed: true,
+		},
+		{
+			name: "forbidden",
+			send: []wsMessage{
+				{Type: wsConnectionInit, Payload: json.RawMessage(`{"token":"bad"}`)},
+			},
+			closed: true,
+		},
+		{
+			name: "duplicate init",
+			send: []wsMessage{
+				{Type: wsConnectionInit},
+				{Type: wsConnectionInit},
+			},
+			expect: []wsMessage{
+				{Type: wsConnectionAck},
+			},
+			closed: true,
+		},
+	}
+
+	init := func(ctx context.Context, payload map[string]any) (context.Context, error) {
+		if payload["token"] == "bad" {
+			return ctx, fmt.Errorf("invalid token")
+		}
+		return ctx, nil
+	}
+
+	srv := httptest.NewServer(GraphQLWebSocket(newTestSchema(t), WithConnectionInit(init)))
+	defer srv.Close()
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			ws, err := dialGraphQLWS(t, srv.URL, GraphQLWSProtocol)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ws.Close()
+
+			for _, msg := range v.send {
+				if err := websocket.JSON.Send(ws, msg); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, expected := range v.expect {
+				var msg wsMessage
+				if err := websocket.JSON.Receive(ws, &msg); err != nil {
+					t.Fatal(err)
+				}
+
+				if msg.ID != expected.ID || msg.Type != expected.Type || string(msg.Payload) != string(expected.Payload) {
+					t.Errorf("expected %s %s %s but got %s %s %s", expected.ID, expected.Type, expected.Payload, msg.ID, msg.Type, msg.Payload)
+				}
+			}
+
+			if v.closed {
+				var msg wsMessage
+				if err := websocket.JSON.Receive(ws, &msg); err == nil {
+					t.Errorf("expected connection to be closed but got %s", msg.Type)
+				}
+			}
+		})
+	}
+}
+
+// tracing adds an extension to every response like a tracing extension would
+type tracing struct{}
+
+func (tracing) ExtensionName() string { return "tracing" }
+
+func (tracing) Validate(graphql.ExecutableSchema) error { return nil }
+
+func (tracing) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	resp := next(ctx)
+	if resp != nil {
+		resp.Extensions = map[string]any{"traced": true}
+	}
+	return resp
+}
+
+func TestGraphQLWebSocketExtensions(t *testing.T) {
+	srv := httptest.NewServer(GraphQLWebSocket(newTestSchema(t), WithGraphQLWSExtensions(tracing{})))
+	defer srv.Close()
+
+	ws, err := dialGraphQLWS(t, srv.URL, GraphQLWSProtocol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	for _, msg := range []wsMessage{{Type: wsConnectionInit}, {ID: "1", Type: wsSubscribe, Payload: json.RawMessage(`{"query":"{ hello }"}`)}} {
+		if err := websocket.JSON.Send(ws, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var msg wsMessage
+	for msg.Type != wsNext {
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := `{"data":{"hello":"world"},"extensions":{"traced":true}}`
+	if string(msg.Payload) != expected {
+		t.Errorf("expected %s but got %s", expected, msg.Payload)
+	}
+}
+
+func TestGraphQLWebSocketProtocol(t *testing.T) {
+	srv := httptest.NewServer(GraphQLWebSocket(newTestSchema(t)))
+	defer srv.Close()
+
+	if _, err := dialGraphQLWS(t, srv.URL, "graphql-ws"); err == nil {
+		t.Error("expected handshake to fail without the graphql-transport-ws protocol")
+	}
+}
+
+func TestGraphQLWebSocketInitTimeout(t *testing.T) {
+	srv := httptest.NewServer(GraphQLWebSocket(newTestSchema(t), WithConnectionInitTimeout(50*time.Millisecond)))
+	defer srv.Close()
+
+	ws, err := dialGraphQLWS(t, srv.URL, GraphQLWSProtocol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	var msg wsMessage
+	if err := websocket.JSON.Receive(ws, &msg); err == nil {
+		t.Errorf("expected connection to be closed but got %s", msg.Type)
+	}
+}
+
+func TestGraphQLWebSocketOrigin(t *testing.T) {
+	tt := []struct {
+		name   string
+		origin string
+		opts   []GraphQLWSOption
+		err    bool
+	}{
+		{name: "same origin"},
+		{name: "other origin", origin: "https://evil.example.com", err: true},
+		{name: "allowed origin", origin: "https://app.coverwhale.com", opts: []GraphQLWSOption{WithAllowedOrigins("https://*.coverwhale.com")}},
+		{name: "not allowed origin", origin: "https://evil.example.com", opts: []GraphQLWSOption{WithAllowedOrigins("https://*.coverwhale.com")}, err: true},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			srv := httptest.NewServer(GraphQLWebSocket(newTestSchema(t), v.opts...))
+			defer srv.Close()
+
+			origin := v.origin
+			if origin == "" {
+				origin = srv.URL
+			}
+
+			ws, err := dialGraphQLWSFrom(t, srv.URL, origin, GraphQLWSProtocol)
+			if (err != nil) != v.err {
+				t.Fatalf("expected error %t but got %v", v.err, err)
+			}
+			if err == nil {
+				ws.Close()
+			}
+		})
+	}
+}
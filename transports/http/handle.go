@@ -0,0 +1,327 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	cwerrors "github.com/CoverWhale/coverwhale-go/errors"
+	cwmiddleware "github.com/CoverWhale/coverwhale-go/transports/http/middleware"
+	"github.com/CoverWhale/logr"
+)
+
+var (
+	ErrUnsupportedMediaType = fmt.Errorf("unsupported media type")
+	ErrNotAcceptable        = fmt.Errorf("no acceptable content type")
+	ErrBodyTooLarge         = fmt.Errorf("request body too large")
+)
+
+// Validator is implemented by request types that validate themselves after binding. Errors that aren't
+// client errors are returned to the caller as a 422.
+type Validator interface {
+	Validate() error
+}
+
+// HandleOption is a functional option to modify a handler created by Handle
+type HandleOption func(*handleConfig)
+
+type handleConfig struct {
+	status int
+	logger *logr.Logger
+	codecs codecs
+}
+
+// WithStatus sets the success status code. A 204 doesn't write the response.
+func WithStatus(code int) HandleOption {
+	return func(c *handleConfig) {
+		c.status = code
+	}
+}
+
+// WithHandlerLogger sets the logger used for server errors
+func WithHandlerLogger(l *logr.Logger) HandleOption {
+	return func(c *handleConfig) {
+		c.logger = l
+	}
+}
+
+// WithCodecs adds codecs for content negotiation, such as CBOR or msgpack. A codec for a content type that is
+// already used replaces it. JSON is always available and is the default.
+func WithCodecs(c ...Codec) HandleOption {
+	return func(cfg *handleConfig) {
+		for _, v := range c {
+			cfg.codecs = cfg.codecs.with(v)
+		}
+	}
+}
+
+// Handle adapts a typed function to an http.Handler. The request is bound into Req with Bind and validated
+// when Req implements Validator. Resp is encoded with the codec negotiated from the Accept header. Errors
+// are written by ErrHandler.
+func Handle[Req, Resp any](h func(context.Context, Req) (Resp, error), opts ...HandleOption) http.Handler {
+	cfg := handleConfig{
+		status: http.StatusOK,
+		logger: logr.NewLogger(),
+		codecs: defaultCodecs,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &ErrHandler{
+		Logger: cfg.logger,
+		Handler: func(w http.ResponseWriter, r *http.Request) error {
+			codec, ok := cfg.codecs.negotiate(r.Header.Get("Accept"))
+			if !ok {
+				return cwerrors.NewClientError(ErrNotAcceptable, http.StatusNotAcceptable)
+			}
+
+			var req Req
+			if err := bind(r, &req, cfg.codecs); err != nil {
+				return err
+			}
+
+			if err := validate(req, &req); err != nil {
+				return err
+			}
+
+			resp, err := h(r.Context(), req)
+			if err != nil {
+				return err
+			}
+
+			if cfg.status == http.StatusNoContent {
+				w.WriteHeader(http.StatusNoContent)
+				return nil
+			}
+
+			w.Header().Set("Content-Type", codec.ContentType())
+			w.WriteHeader(cfg.status)
+			if err := codec.Encode(w, resp); err != nil {
+				// the status is already written so the error can only be logged
+				cfg.logger.Errorf("error encoding response: %v", err)
+			}
+
+			return nil
+		},
+	}
+}
+
+// validate checks the request value and then a pointer to it so Validate can have either receiver
+func validate(req, ptr any) error {
+	v, ok := req.(Validator)
+	if !ok {
+		if v, ok = ptr.(Validator); !ok {
+			return nil
+		}
+	}
+
+	err := v.Validate()
+	if err == nil {
+		return nil
+	}
+
+	var ce *ClientError
+	var coded interface{ Code() int }
+	if errors.As(err, &ce) || errors.As(err, &coded) {
+		return err
+	}
+
+	return cwerrors.NewClientError(err, http.StatusUnprocessableEntity)
+}
+
+// Bind decodes the request body into v with the codec for the Content-Type and then sets the struct fields
+// tagged with path, query, or header. Tagged fields can be strings, bools, numbers, durations, types
+// implementing encoding.TextUnmarshaler, and slices or pointers of those. v must be a pointer. Bad requests
+// are returned as client errors from the errors package.
+func Bind(r *http.Request, v any) error {
+	return bind(r, v, defaultCodecs)
+}
+
+func bind(r *http.Request, v any, cs codecs) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("bind requires a non-nil pointer but got %T", v)
+	}
+
+	if err := bindBody(r, v, cs); err != nil {
+		return err
+	}
+
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	if err := bindParams(r, rv); err != nil {
+		return cwerrors.NewClientError(err, http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+func bindBody(r *http.Request, v any, cs codecs) error {
+	body := r.Body
+	if b, ok := cwmiddleware.BodyFromContext(r.Context()); ok {
+		body = b.Reader()
+	}
+
+	if body == nil || body == http.NoBody || r.ContentLength == 0 {
+		return nil
+	}
+
+	codec, ok := cs.forContentType(r.Header.Get("Content-Type"))
+	if !ok {
+		return cwerrors.NewClientError(ErrUnsupportedMediaType, http.StatusUnsupportedMediaType)
+	}
+
+	if err := codec.Decode(body, v); err != nil && !errors.Is(err, io.EOF) {
+		if cwmiddleware.IsMaxBytesError(err) {
+			return cwerrors.NewClientError(ErrBodyTooLarge, http.StatusRequestEntityTooLarge)
+		}
+
+		return cwerrors.NewClientError(fmt.Errorf("invalid request body: %w", err), http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+func bindParams(r *http.Request, v reflect.Value) error {
+	query := r.URL.Query()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		var source, name string
+		var values []string
+		if tag, ok := f.Tag.Lookup("path"); ok {
+			source, name = "path", tag
+			if val := r.PathValue(tag); val != "" {
+				values = []string{val}
+			}
+		} else if tag, ok := f.Tag.Lookup("query"); ok {
+			source, name = "query", tag
+			values = query[tag]
+		} else if tag, ok := f.Tag.Lookup("header"); ok {
+			source, name = "header", tag
+			values = r.Header.Values(tag)
+		} else {
+			if f.Anonymous && f.Type.Kind() == reflect.Struct {
+				if err := bindParams(r, v.Field(i)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if len(values) == 0 {
+			continue
+		}
+
+		if err := setValue(v.Field(i), values); err != nil {
+			return fmt.Errorf("invalid %s param %q: %w", source, name, err)
+		}
+	}
+
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setValue(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setValue(v.Elem(), values)
+	}
+
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(values[0]))
+	}
+
+	if v.Kind() == reflect.Slice {
+		s := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, val := range values {
+			if err := setValue(s.Index(i), []string{val}); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+
+	val := values[0]
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == durationType {
+			d, err := time.ParseDuration(val)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+
+		i, err := strconv.ParseInt(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
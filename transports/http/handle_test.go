@@ -0,0 +1,150 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cwerrors "github.com/CoverWhale/coverwhale-go/errors"
+)
+
+type testRequest struct {
+	ID      string        `path:"id"`
+	Limit   int           `query:"limit"`
+	Tags    []string      `query:"tag"`
+	Since   *time.Time    `query:"since"`
+	Timeout time.Duration `query:"timeout"`
+	Tenant  string        `header:"X-Tenant"`
+	Name    string        `json:"name"`
+}
+
+func (t *testRequest) Validate() error {
+	if t.Name == "invalid" {
+		return fmt.Errorf("name is invalid")
+	}
+	if t.Name == "limited" {
+		return cwerrors.RateLimited(time.Second)
+	}
+
+	return nil
+}
+
+type textCodec struct{}
+
+func (textCodec) ContentType() string { return "text/plain" }
+
+func (textCodec) Encode(w io.Writer, v any) error {
+	_, err := fmt.Fprintf(w, "%v", v)
+	return err
+}
+
+func (textCodec) Decode(r io.Reader, v any) error {
+	return fmt.Errorf("not supported")
+}
+
+func TestHandle(t *testing.T) {
+	var bound testRequest
+	h := Handle(func(ctx context.Context, req testRequest) (map[string]string, error) {
+		bound = req
+		if req.ID == "missing" {
+			return nil, cwerrors.NewClientError(fmt.Errorf("product not found"), http.StatusNotFound)
+		}
+		return map[string]string{"id": req.ID}, nil
+	}, WithStatus(http.StatusCreated), WithCodecs(textCodec{}))
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /products/{id}", h)
+
+	tt := []struct {
+		name        string
+		path        string
+		body        string
+		headers     map[string]string
+		status      int
+		contentType string
+		respBody    string
+	}{
+		{name: "bind", path: "/products/1?limit=10&tag=a&tag=b&since=2024-01-02T00:00:00Z&timeout=2s", body: `{"name": "truck"}`, headers: map[string]string{"X-Tenant": "cw"}, status: http.StatusCreated, contentType: "application/json", respBody: `{"id":"1"}`},
+		{name: "no body", path: "/products/1", status: http.StatusCreated, contentType: "application/json"},
+		{name: "negotiate", path: "/products/1", headers: map[string]string{"Accept": "application/xml, text/*;q=0.5"}, status: http.StatusCreated, contentType: "text/plain", respBody: "map[id:1]"},
+		{name: "not acceptable", path: "/products/1", headers: map[string]string{"Accept": "application/xml"}, status: http.StatusNotAcceptable},
+		{name: "unsupported media type", path: "/products/1", body: `<name/>`, headers: map[string]string{"Content-Type": "application/xml"}, status: http.StatusUnsupportedMediaType},
+		{name: "invalid body", path: "/products/1", body: `{"name":`, status: http.StatusBadRequest},
+		{name: "invalid param", path: "/products/1?limit=%22ten%22", status: http.StatusBadRequest},
+		{name: "validation", path: "/products/1", body: `{"name": "invalid"}`, status: http.StatusUnprocessableEntity},
+		{name: "validation client error", path: "/products/1", body: `{"name": "limited"}`, status: http.StatusTooManyRequests},
+		{name: "handler error", path: "/products/missing", status: http.StatusNotFound},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, v.path, strings.NewReader(v.body))
+			for k, val := range v.headers {
+				req.Header.Set(k, val)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != v.status {
+				t.Fatalf("expected status %d but got %d: %s", v.status, w.Code, w.Body.String())
+			}
+			if v.contentType != "" && w.Header().Get("Content-Type") != v.contentType {
+				t.Errorf("expected content type %s but got %s", v.contentType, w.Header().Get("Content-Type"))
+			}
+			if v.respBody != "" && strings.TrimSpace(w.Body.String()) != v.respBody {
+				t.Errorf("expected body %s but got %s", v.respBody, w.Body.String())
+			}
+
+			if w.Code >= http.StatusBadRequest {
+				if w.Header().Get("Content-Type") != "application/json" {
+					t.Errorf("expected JSON error but got %s", w.Header().Get("Content-Type"))
+				}
+
+				var body struct {
+					Errors []cwerrors.ErrorWithMetadata `json:"errors"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatalf("error decoding error body %s: %v", w.Body.String(), err)
+				}
+				if len(body.Errors) != 1 || body.Errors[0].Message == "" {
+					t.Errorf("expected an error message but got %s", w.Body.String())
+				}
+			}
+		})
+	}
+
+	since := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	expected := testRequest{ID: "1", Limit: 10, Tags: []string{"a", "b"}, Since: &since, Timeout: 2 * time.Second, Tenant: "cw", Name: "truck"}
+
+	t.Run("bound values", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/products/1?limit=10&tag=a&tag=b&since=2024-01-02T00:00:00Z&timeout=2s", strings.NewReader(`{"name": "truck"}`))
+		req.Header.Set("X-Tenant", "cw")
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+
+		got, _ := json.Marshal(bound)
+		want, _ := json.Marshal(expected)
+		if string(got) != string(want) {
+			t.Errorf("expected %s but got %s", want, got)
+		}
+	})
+}
@@ -0,0 +1,288 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/CoverWhale/coverwhale-go/auth"
+	"github.com/CoverWhale/coverwhale-go/opa"
+	"github.com/CoverWhale/logr"
+)
+
+type routeKey struct{}
+
+type principalKey struct{}
+
+type pathKey struct{}
+
+// AuthzInput is the input document the Authz middleware sends to OPA. Path is the full request path, before
+// a sub router prefix is stripped, so it matches Route.
+type AuthzInput struct {
+	Principal  any               `json:"principal,omitempty"`
+	Method     string            `json:"method"`
+	Path       string            `json:"path"`
+	Route      string            `json:"route,omitempty"`
+	PathParams map[string]string `json:"path_params,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+}
+
+// PrincipalFunc returns the authenticated principal for the request and false if the request is anonymous. The
+// default is the auth.Principal stored by auth.Middleware, or the principal stored with ContextWithPrincipal.
+type PrincipalFunc func(*http.Request) (any, bool)
+
+// AuthzOption is a functional option to modify the Authz middleware
+type AuthzOption func(*authorizer)
+
+type authorizer struct {
+	client    *opa.Client
+	pkg       string
+	principal PrincipalFunc
+	headers   []string
+	public    []string
+	// failure handles OPA failures the same way as the validation middlewares
+	failure *validator
+}
+
+// WithPrincipal sets how the authenticated principal is found for a request
+func WithPrincipal(p PrincipalFunc) AuthzOption {
+	return func(a *authorizer) {
+		a.principal = p
+	}
+}
+
+// WithFailureMode sets how OPA failures are handled with the validator options WithFailOpen and
+// WithLastDecision. Other validator options are ignored. Without it Authz fails closed with a 503.
+func WithFailureMode(opts ...ValidatorOption) AuthzOption {
+	return func(a *authorizer) {
+		for _, opt := range opts {
+			opt(a.failure)
+		}
+	}
+}
+
+// WithHeaders adds the named request headers to the OPA input
+func WithHeaders(headers ...string) AuthzOption {
+	return func(a *authorizer) {
+		a.headers = append(a.headers, headers...)
+	}
+}
+
+// WithPublicRoutes skips OPA for public routes. Routes are either a route pattern such as "GET /products/{id}",
+// or a path with an optional method. Paths ending in a slash match everything under them.
+func WithPublicRoutes(routes ...string) AuthzOption {
+	return func(a *authorizer) {
+		a.public = append(a.public, routes...)
+	}
+}
+
+// WithRoute stores the route pattern, such as "GET /api/v1/products/{id}", in the request context.
+// RegisterSubRouter does this for every route.
+func WithRoute(pattern string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), routeKey{}, pattern)
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// WithOriginalPath stores the request path in the context before a prefix is stripped. RegisterSubRouter does
+// this for every sub router.
+func WithOriginalPath(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), pathKey{}, r.URL.Path)
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// OriginalPath returns the request path stored by WithOriginalPath, or the current path if there isn't one
+func OriginalPath(r *http.Request) string {
+	if path, ok := r.Context().Value(pathKey{}).(string); ok {
+		return path
+	}
+
+	return r.URL.Path
+}
+
+// RouteFromContext returns the route pattern that matched the request
+func RouteFromContext(ctx context.Context) string {
+	route, _ := ctx.Value(routeKey{}).(string)
+	return route
+}
+
+// ContextWithPrincipal stores the authenticated principal for Authz. Authentication middleware runs before Authz
+// and calls it once the request is authenticated.
+func ContextWithPrincipal(ctx context.Context, principal any) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal stored with ContextWithPrincipal and false if there isn't one
+func PrincipalFromContext(ctx context.Context) (any, bool) {
+	principal := ctx.Value(principalKey{})
+	return principal, principal != nil
+}
+
+// Authz authorizes requests with the OPA package using the principal, method, route pattern, path params, and
+// selected headers. Anonymous requests that are denied get a 401 and authenticated requests that are denied get
+// a 403. When OPA can't be reached the request gets a 503 unless WithFailureMode lets it through or uses the last
+// decision. Since path params are only known after routing, Authz should wrap route handlers rather than a sub router.
+func Authz(client *opa.Client, pkg string, opts ...AuthzOption) func(http.Handler) http.Handler {
+	a := &authorizer{
+		client: client,
+		pkg:    pkg,
+		principal: func(r *http.Request) (any, bool) {
+			if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+				return p, true
+			}
+			return PrincipalFromContext(r.Context())
+		},
+		failure: &validator{client: client, pkg: pkg},
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := RouteFromContext(r.Context())
+			if a.isPublic(r, route) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			input, authenticated := a.input(r, route)
+
+			var result opa.Result
+			data, err := a.client.Decide(r.Context(), a.pkg, input)
+			if err != nil && !errors.Is(err, opa.ErrUndefined) {
+				logr.Errorf("error querying OPA for %s: %v", a.pkg, err)
+				last, ok := a.failure.last(input)
+				if !ok {
+					if a.failure.fail(w) {
+						h.ServeHTTP(w, r)
+					}
+					return
+				}
+				data, err = last, nil
+			}
+
+			// an undefined decision is never an allow
+			if err == nil {
+				if err := json.Unmarshal(data, &result); err != nil {
+					logr.Errorf("error decoding response from OPA: %v", err)
+					if a.failure.fail(w) {
+						h.ServeHTTP(w, r)
+					}
+					return
+				}
+			}
+
+			if result.IsAllowed() {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			status := http.StatusForbidden
+			if !authenticated {
+				status = http.StatusUnauthorized
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			if err := json.NewEncoder(w).Encode(result); err != nil {
+				logr.Errorf("error encoding OPA denied response: %v", err)
+			}
+		})
+	}
+}
+
+func (a *authorizer) input(r *http.Request, route string) (AuthzInput, bool) {
+	principal, authenticated := a.principal(r)
+
+	input := AuthzInput{
+		Principal: principal,
+		Method:    r.Method,
+		Path:      OriginalPath(r),
+		Route:     route,
+	}
+
+	for _, name := range PathParamNames(route) {
+		if input.PathParams == nil {
+			input.PathParams = make(map[string]string)
+		}
+		input.PathParams[name] = r.PathValue(name)
+	}
+
+	for _, v := range a.headers {
+		if val := r.Header.Get(v); val != "" {
+			if input.Headers == nil {
+				input.Headers = make(map[string]string)
+			}
+			input.Headers[http.CanonicalHeaderKey(v)] = val
+		}
+	}
+
+	return input, authenticated
+}
+
+func (a *authorizer) isPublic(r *http.Request, route string) bool {
+	requestPath := OriginalPath(r)
+	for _, v := range a.public {
+		if v == route {
+			return true
+		}
+
+		method, path, ok := strings.Cut(v, " ")
+		if !ok {
+			path = method
+			method = ""
+		}
+
+		if method != "" && method != r.Method {
+			continue
+		}
+
+		if path == requestPath || (strings.HasSuffix(path, "/") && strings.HasPrefix(requestPath, path)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PathParamNames returns the names of the wildcards in a route pattern such as "GET /products/{id}/{rest...}"
+func PathParamNames(pattern string) []string {
+	var names []string
+	for {
+		start := strings.Index(pattern, "{")
+		if start == -1 {
+			return names
+		}
+		end := strings.Index(pattern[start:], "}")
+		if end == -1 {
+			return names
+		}
+
+		name := strings.TrimSuffix(pattern[start+1:start+end], "...")
+		if name != "$" && name != "" {
+			names = append(names, name)
+		}
+		pattern = pattern[start+end+1:]
+	}
+}
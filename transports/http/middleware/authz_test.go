@@ -0,0 +1,245 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CoverWhale/coverwhale-go/opa"
+)
+
+func TestAuthz(t *testing.T) {
+	client := opa.NewClient(opa.SetEvaluator(opa.Policies{
+		"cw/authz": func(ctx context.Context, data json.RawMessage) (any, error) {
+			var input AuthzInput
+			if err := json.Unmarshal(data, &input); err != nil {
+				return nil, err
+			}
+
+			if input.Principal == "admin" && input.PathParams["id"] == "1" {
+				return opa.Result{Allow: true}, nil
+			}
+
+			return opa.Result{Deny: []string{"not allowed"}}, nil
+		},
+	}))
+
+	principal := func(r *http.Request) (any, bool) {
+		user := r.Header.Get("X-User")
+		return user, user != ""
+	}
+
+	tt := []struct {
+		name   string
+		path   string
+		user   string
+		status int
+	}{
+		{name: "allowed", path: "/products/1", user: "admin", status: http.StatusOK},
+		{name: "forbidden", path: "/products/2", user: "admin", status: http.StatusForbidden},
+		{name: "unauthorized", path: "/products/1", status: http.StatusUnauthorized},
+		{name: "public", path: "/health", status: http.StatusOK},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			authz := Authz(client, "cw/authz", WithPrincipal(principal), WithPublicRoutes("GET /health"))
+			ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+			mux := http.NewServeMux()
+			mux.Handle("GET /products/{id}", WithRoute("GET /products/{id}", authz(ok)))
+			mux.Handle("GET /health", WithRoute("GET /health", authz(ok)))
+
+			req := httptest.NewRequest(http.MethodGet, v.path, nil)
+			if v.user != "" {
+				req.Header.Set("X-User", v.user)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != v.status {
+				t.Errorf("expected status %d but got %d", v.status, w.Code)
+			}
+		})
+	}
+}
+
+func TestAuthzFailureModes(t *testing.T) {
+	var healthy bool
+	client := opa.NewClient(opa.SetLastDecisions(10), opa.SetEvaluator(opa.EvaluatorFunc(func(ctx context.Context, pkg string, input json.RawMessage) (json.RawMessage, error) {
+		if !healthy {
+			return nil, &opa.StatusError{StatusCode: http.StatusBadGateway}
+		}
+		return json.RawMessage(`{"allow":true}`), nil
+	})))
+
+	tt := []struct {
+		name    string
+		path    string
+		opts    []ValidatorOption
+		healthy bool
+		status  int
+	}{
+		{name: "fail closed", path: "/products/1", status: http.StatusServiceUnavailable},
+		{name: "fail open", path: "/products/1", opts: []ValidatorOption{WithFailOpen()}, status: http.StatusOK},
+		{name: "fail open unlisted package", path: "/products/1", opts: []ValidatorOption{WithFailOpen("cw/underwriting")}, status: http.StatusServiceUnavailable},
+		{name: "store last decision", path: "/products/2", healthy: true, status: http.StatusOK},
+		{name: "last decision", path: "/products/2", opts: []ValidatorOption{WithLastDecision()}, status: http.StatusOK},
+		{name: "no last decision", path: "/products/3", opts: []ValidatorOption{WithLastDecision()}, status: http.StatusServiceUnavailable},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			healthy = v.healthy
+			authz := Authz(client, "cw/authz", WithFailureMode(v.opts...))
+			ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+			mux := http.NewServeMux()
+			mux.Handle("GET /products/{id}", WithRoute("GET /products/{id}", authz(ok)))
+
+			req := httptest.NewRequest(http.MethodGet, v.path, nil)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != v.status {
+				t.Errorf("expected status %d but got %d", v.status, w.Code)
+			}
+		})
+	}
+}
+
+func TestAuthzPrincipalFromContext(t *testing.T) {
+	client := opa.NewClient(opa.SetEvaluator(opa.Policies{
+		"cw/authz": func(ctx context.Context, data json.RawMessage) (any, error) {
+			var input AuthzInput
+			if err := json.Unmarshal(data, &input); err != nil {
+				return nil, err
+			}
+
+			return opa.Result{Allow: input.Principal == "admin"}, nil
+		},
+	}))
+
+	tt := []struct {
+		name   string
+		user   string
+		status int
+	}{
+		{name: "authenticated", user: "admin", status: http.StatusOK},
+		{name: "anonymous", status: http.StatusUnauthorized},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			authz := Authz(client, "cw/authz")
+			authenticate := func(h http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if v.user != "" {
+						r = r.WithContext(ContextWithPrincipal(r.Context(), v.user))
+					}
+					h.ServeHTTP(w, r)
+				})
+			}
+
+			w := httptest.NewRecorder()
+			authenticate(authz(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products", nil))
+
+			if w.Code != v.status {
+				t.Errorf("expected status %d but got %d", v.status, w.Code)
+			}
+		})
+	}
+}
+
+func TestAuthzOriginalPath(t *testing.T) {
+	var paths []string
+	client := opa.NewClient(opa.SetEvaluator(opa.Policies{
+		"cw/authz": func(ctx context.Context, data json.RawMessage) (any, error) {
+			var input AuthzInput
+			if err := json.Unmarshal(data, &input); err != nil {
+				return nil, err
+			}
+			paths = append(paths, input.Path)
+
+			return opa.Result{Allow: input.Route == "GET /api/products/{id}"}, nil
+		},
+	}))
+
+	tt := []struct {
+		name   string
+		path   string
+		status int
+		input  string
+	}{
+		{name: "full path in input", path: "/api/products/1", status: http.StatusOK, input: "/api/products/1"},
+		{name: "public full path", path: "/api/health", status: http.StatusOK},
+		{name: "stripped path is not public", path: "/api/status", status: http.StatusUnauthorized, input: "/api/status"},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			paths = nil
+			authz := Authz(client, "cw/authz", WithPrincipal(func(r *http.Request) (any, bool) { return nil, false }), WithPublicRoutes("GET /api/health", "/status"))
+			ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+			sub := http.NewServeMux()
+			sub.Handle("GET /products/{id}", WithRoute("GET /api/products/{id}", authz(ok)))
+			sub.Handle("GET /health", WithRoute("GET /api/health", authz(ok)))
+			sub.Handle("GET /status", WithRoute("GET /api/status", authz(ok)))
+			mux := http.NewServeMux()
+			mux.Handle("/api/", WithOriginalPath(http.StripPrefix("/api", sub)))
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, v.path, nil))
+
+			if w.Code != v.status {
+				t.Errorf("expected status %d but got %d", v.status, w.Code)
+			}
+			if v.input != "" && (len(paths) != 1 || paths[0] != v.input) {
+				t.Errorf("expected input path %s but got %v", v.input, paths)
+			}
+		})
+	}
+}
+
+func TestPathParamNames(t *testing.T) {
+	tt := []struct {
+		pattern  string
+		expected []string
+	}{
+		{pattern: "GET /products", expected: nil},
+		{pattern: "GET /products/{id}", expected: []string{"id"}},
+		{pattern: "/files/{dir}/{rest...}", expected: []string{"dir", "rest"}},
+		{pattern: "/{$}", expected: nil},
+	}
+
+	for _, v := range tt {
+		t.Run(v.pattern, func(t *testing.T) {
+			names := PathParamNames(v.pattern)
+			if len(names) != len(v.expected) {
+				t.Fatalf("expected %v but got %v", v.expected, names)
+			}
+			for i := range names {
+				if names[i] != v.expected[i] {
+					t.Errorf("expected %v but got %v", v.expected, names)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"sync"
+
+	"github.com/CoverWhale/logr"
+)
+
+// DefaultMaxBodySize is the max request body size used by the validation middlewares when the body
+// hasn't already been buffered by BufferBody
+const DefaultMaxBodySize int64 = 10 << 20
+
+type bodyKey struct{}
+
+// Body is a request body read once by BufferBody and shared by every middleware after it
+type Body struct {
+	data []byte
+
+	mu      sync.Mutex
+	decoded map[reflect.Type]any
+}
+
+// Bytes returns the buffered body. It must not be modified.
+func (b *Body) Bytes() []byte {
+	return b.data
+}
+
+// Reader returns a new reader over the buffered body without copying it
+func (b *Body) Reader() io.ReadCloser {
+	return io.NopCloser(bytes.NewReader(b.data))
+}
+
+// BodyFromContext returns the body buffered by BufferBody
+func BodyFromContext(ctx context.Context) (*Body, bool) {
+	b, ok := ctx.Value(bodyKey{}).(*Body)
+	return b, ok
+}
+
+// BodyJSON decodes the buffered body into T. The decoded value is cached so later calls for the same
+// type, for example from another middleware, don't decode the body again. Callers must not modify it.
+func BodyJSON[T any](b *Body) (T, error) {
+	var v T
+	t := reflect.TypeOf(&v).Elem()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if cached, ok := b.decoded[t]; ok {
+		return cached.(T), nil
+	}
+
+	if err := json.Unmarshal(b.data, &v); err != nil {
+		return v, err
+	}
+
+	if b.decoded == nil {
+		b.decoded = make(map[reflect.Type]any)
+	}
+	b.decoded[t] = v
+
+	return v, nil
+}
+
+// BufferBody reads the request body once, up to max bytes, and stores it in the request context for
+// the middlewares and handler after it. Bodies over max get a 413.
+func BufferBody(max int64) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, _, ok := bufferBody(w, r, max)
+			if !ok {
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bufferBody returns the request with the body buffered in its context. If the body was already
+// buffered it is reused. The response is written if the body can't be read.
+func bufferBody(w http.ResponseWriter, r *http.Request, max int64) (*http.Request, *Body, bool) {
+	if b, ok := BodyFromContext(r.Context()); ok {
+		r.Body = b.Reader()
+		return r, b, true
+	}
+
+	if max > 0 && r.ContentLength > max {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return r, nil, false
+	}
+
+	var buf bytes.Buffer
+	if r.ContentLength > 0 {
+		buf.Grow(int(r.ContentLength))
+	}
+
+	body := r.Body
+	if body == nil {
+		body = http.NoBody
+	}
+	if max > 0 {
+		body = http.MaxBytesReader(w, body, max)
+	}
+	defer body.Close()
+
+	if _, err := buf.ReadFrom(body); err != nil {
+		if IsMaxBytesError(err) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return r, nil, false
+		}
+
+		logr.Errorf("error reading request body: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return r, nil, false
+	}
+
+	b := &Body{data: buf.Bytes()}
+	r = r.WithContext(context.WithValue(r.Context(), bodyKey{}, b))
+	r.Body = b.Reader()
+
+	return r, b, true
+}
@@ -0,0 +1,71 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBufferBody(t *testing.T) {
+	type payload struct {
+		Name string `json:"name"`
+	}
+
+	tt := []struct {
+		name   string
+		body   string
+		max    int64
+		status int
+	}{
+		{name: "under max", body: `{"name":"test"}`, max: 100, status: http.StatusOK},
+		{name: "over max", body: `{"name":"test"}`, max: 5, status: http.StatusRequestEntityTooLarge},
+		{name: "no max", body: `{"name":"test"}`, status: http.StatusOK},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			first := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, ok := BodyFromContext(r.Context())
+				if !ok {
+					t.Fatal("expected buffered body")
+				}
+
+				p, err := BodyJSON[payload](body)
+				if err != nil || p.Name != "test" {
+					t.Fatalf("unexpected decoded body %+v: %v", p, err)
+				}
+
+				// a second middleware reading the body again
+				data, err := io.ReadAll(r.Body)
+				if err != nil || string(data) != v.body {
+					t.Errorf("expected body %s but got %s: %v", v.body, data, err)
+				}
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(v.body))
+			req.ContentLength = -1
+			w := httptest.NewRecorder()
+			BufferBody(v.max)(first).ServeHTTP(w, req)
+
+			if w.Code != v.status {
+				t.Errorf("expected status %d but got %d", v.status, w.Code)
+			}
+		})
+	}
+}
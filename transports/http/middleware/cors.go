@@ -0,0 +1,147 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrCORSCredentialsWildcard is returned for a policy that allows credentials from any origin
+var ErrCORSCredentialsWildcard = fmt.Errorf(`AllowCredentials can't be used with the "*" origin`)
+
+// CORSPolicy is the cross origin resource sharing policy for the CORS middleware
+type CORSPolicy struct {
+	// AllowedOrigins are the origins allowed to make requests. "*" allows any origin and a wildcard
+	// subdomain such as "https://*.coverwhale.com" allows any subdomain.
+	AllowedOrigins []string
+	// AllowedMethods defaults to GET, POST, and HEAD
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed in preflight requests. The default is Content-Type and
+	// Authorization.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers the browser can read
+	ExposedHeaders []string
+	// AllowCredentials allows cookies and authorization headers. It can't be used with the "*" origin.
+	AllowCredentials bool
+	// MaxAge is how long browsers can cache preflight responses
+	MaxAge time.Duration
+}
+
+// Validate checks that the policy doesn't allow credentials from any origin
+func (c CORSPolicy) Validate() error {
+	if c.AllowCredentials && c.allowsAnyOrigin() {
+		return ErrCORSCredentialsWildcard
+	}
+
+	return nil
+}
+
+// AllowsOrigin reports whether the origin matches one of the allowed origins
+func (c CORSPolicy) AllowsOrigin(origin string) bool {
+	for _, v := range c.AllowedOrigins {
+		if v == "*" || v == origin {
+			return true
+		}
+
+		if prefix, suffix, ok := strings.Cut(v, "*"); ok {
+			if strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) && len(origin) > len(prefix)+len(suffix) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (c CORSPolicy) allowsAnyOrigin() bool {
+	for _, v := range c.AllowedOrigins {
+		if v == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CORS handles preflight requests and adds CORS headers for allowed origins. An invalid policy returns the
+// error from CORSPolicy.Validate.
+func CORS(policy CORSPolicy) (func(http.Handler) http.Handler, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(policy.AllowedMethods) == 0 {
+		policy.AllowedMethods = []string{http.MethodGet, http.MethodPost, http.MethodHead}
+	}
+	if len(policy.AllowedHeaders) == 0 {
+		policy.AllowedHeaders = []string{"Content-Type", "Authorization"}
+	}
+
+	methods := strings.Join(policy.AllowedMethods, ", ")
+	headers := strings.Join(policy.AllowedHeaders, ", ")
+	exposed := strings.Join(policy.ExposedHeaders, ", ")
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			w.Header().Add("Vary", "Origin")
+
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			if origin == "" || !policy.AllowsOrigin(origin) {
+				if preflight {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			if policy.allowsAnyOrigin() {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+
+			if policy.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if exposed != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposed)
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+
+			if policy.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}, nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCORSPolicyValidate(t *testing.T) {
+	tt := []struct {
+		name   string
+		policy CORSPolicy
+		err    error
+	}{
+		{name: "any origin", policy: CORSPolicy{AllowedOrigins: []string{"*"}}},
+		{name: "credentials", policy: CORSPolicy{AllowedOrigins: []string{"https://app.coverwhale.com"}, AllowCredentials: true}},
+		{name: "credentials from any origin", policy: CORSPolicy{AllowedOrigins: []string{"https://app.coverwhale.com", "*"}, AllowCredentials: true}, err: ErrCORSCredentialsWildcard},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			if err := v.policy.Validate(); !errors.Is(err, v.err) {
+				t.Errorf("expected error %v but got %v", v.err, err)
+			}
+		})
+	}
+}
+
+func TestCORSInvalidPolicy(t *testing.T) {
+	if _, err := CORS(CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}); !errors.Is(err, ErrCORSCredentialsWildcard) {
+		t.Errorf("expected error %v but got %v", ErrCORSCredentialsWildcard, err)
+	}
+}
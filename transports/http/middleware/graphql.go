@@ -0,0 +1,113 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+var (
+	ErrOperationNotFound = fmt.Errorf("graphql operation not found")
+)
+
+// GraphQLRequest is the body of a GraphQL request
+type GraphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// GraphQLOperation describes the operation that will be executed by a GraphQL request
+type GraphQLOperation struct {
+	// Type is query, mutation, or subscription
+	Type   string   `json:"operation"`
+	Name   string   `json:"name,omitempty"`
+	Fields []string `json:"fields"`
+}
+
+// GraphQLInput is the OPA input document sent by the GraphQL validation middlewares. Data is the input
+// from the custom validation func.
+type GraphQLInput[T any] struct {
+	GraphQLOperation
+	Variables map[string]any `json:"variables,omitempty"`
+	Data      T              `json:"data"`
+}
+
+// ParseGraphQLOperation parses the query and returns the operation to be executed. The operation name
+// can be empty if the document only has one operation.
+func ParseGraphQLOperation(query, operationName string) (GraphQLOperation, error) {
+	doc, err := parser.ParseQuery(&ast.Source{Input: query})
+	if err != nil {
+		return GraphQLOperation{}, err
+	}
+
+	op := doc.Operations.ForName(operationName)
+	if op == nil {
+		return GraphQLOperation{}, fmt.Errorf("%w: %q", ErrOperationNotFound, operationName)
+	}
+
+	operation := GraphQLOperation{
+		Type: string(op.Operation),
+		Name: op.Name,
+	}
+
+	seen := make(map[string]bool)
+	visited := make(map[string]bool)
+	var collect func(ast.SelectionSet)
+	collect = func(set ast.SelectionSet) {
+		for _, s := range set {
+			switch sel := s.(type) {
+			case *ast.Field:
+				if !seen[sel.Name] {
+					seen[sel.Name] = true
+					operation.Fields = append(operation.Fields, sel.Name)
+				}
+			case *ast.InlineFragment:
+				collect(sel.SelectionSet)
+			case *ast.FragmentSpread:
+				if visited[sel.Name] {
+					continue
+				}
+				visited[sel.Name] = true
+				if f := doc.Fragments.ForName(sel.Name); f != nil {
+					collect(f.SelectionSet)
+				}
+			}
+		}
+	}
+	collect(op.SelectionSet)
+
+	return operation, nil
+}
+
+// IsIntrospection reports whether the operation is a query that only selects introspection fields such
+// as __schema and __type
+func (g GraphQLOperation) IsIntrospection() bool {
+	if g.Type != string(ast.Query) || len(g.Fields) == 0 {
+		return false
+	}
+
+	for _, v := range g.Fields {
+		if !strings.HasPrefix(v, "__") {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,138 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/CoverWhale/coverwhale-go/opa"
+)
+
+func TestParseGraphQLOperation(t *testing.T) {
+	tt := []struct {
+		name          string
+		query         string
+		operationName string
+		expected      GraphQLOperation
+		introspection bool
+		err           error
+	}{
+		{
+			name:     "anonymous query",
+			query:    `{ quotes { id } }`,
+			expected: GraphQLOperation{Type: "query", Fields: []string{"quotes"}},
+		},
+		{
+			name:          "named operation",
+			query:         `query Quotes { quotes { id } } mutation CreateQuote { createQuote(id: 1) { id } policy { id } }`,
+			operationName: "CreateQuote",
+			expected:      GraphQLOperation{Type: "mutation", Name: "CreateQuote", Fields: []string{"createQuote", "policy"}},
+		},
+		{
+			name:     "fragments",
+			query:    `query { ...QuoteFields ... on Query { policy { id } } } fragment QuoteFields on Query { quotes { id } }`,
+			expected: GraphQLOperation{Type: "query", Fields: []string{"quotes", "policy"}},
+		},
+		{
+			name:          "renamed introspection",
+			query:         `query Schema { __schema { types { name } } }`,
+			expected:      GraphQLOperation{Type: "query", Name: "Schema", Fields: []string{"__schema"}},
+			introspection: true,
+		},
+		{
+			name:     "named IntrospectionQuery with data",
+			query:    `query IntrospectionQuery { __schema { types { name } } quotes { id } }`,
+			expected: GraphQLOperation{Type: "query", Name: "IntrospectionQuery", Fields: []string{"__schema", "quotes"}},
+		},
+		{
+			name:          "missing operation",
+			query:         `query Quotes { quotes { id } }`,
+			operationName: "Other",
+			err:           ErrOperationNotFound,
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			op, err := ParseGraphQLOperation(v.query, v.operationName)
+			if v.err != nil {
+				if !errors.Is(err, v.err) {
+					t.Fatalf("expected error %v but got %v", v.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(op, v.expected) {
+				t.Errorf("expected %+v but got %+v", v.expected, op)
+			}
+
+			if op.IsIntrospection() != v.introspection {
+				t.Errorf("expected introspection %t", v.introspection)
+			}
+		})
+	}
+}
+
+func TestGraphQLCustomValidator(t *testing.T) {
+	client := opa.NewClient(opa.SetEvaluator(opa.Policies{
+		"cw/graphql": func(ctx context.Context, data json.RawMessage) (any, error) {
+			var input GraphQLInput[json.RawMessage]
+			if err := json.Unmarshal(data, &input); err != nil {
+				return nil, err
+			}
+
+			return opa.Result{Allow: input.Type == "query"}, nil
+		},
+	}))
+
+	tt := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "query allowed", body: `{"query":"query { quotes { id } }","variables":{"data":{"id":1}}}`, status: http.StatusOK},
+		{name: "mutation denied", body: `{"query":"mutation { createQuote { id } }","variables":{"data":{"id":1}}}`, status: http.StatusUnauthorized},
+		{name: "introspection skipped", body: `{"query":"query Schema { __schema { description } }"}`, status: http.StatusOK},
+		{name: "typename mutation validated", body: `{"query":"mutation { __typename }"}`, status: http.StatusUnauthorized},
+		{name: "invalid query", body: `{"query":"query {"}`, status: http.StatusBadRequest},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			validation := func(data []byte) (opa.OPARequest[json.RawMessage], error) {
+				return opa.OPARequest[json.RawMessage]{Input: data}, nil
+			}
+			h := GraphQLCustomValidator(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), validation, opa.SideCarOPA, "cw/graphql", WithClient(client))
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(v.body))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != v.status {
+				t.Errorf("expected status %d but got %d", v.status, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+
+	"github.com/CoverWhale/coverwhale-go/auth"
+)
+
+type identityKey struct{}
+
+// Identity is the verified identity of a client certificate
+type Identity struct {
+	// Subject is the first URI SAN, such as a SPIFFE ID, or the common name
+	Subject     string
+	Certificate *x509.Certificate
+}
+
+// ClientIdentity stores the identity of a verified client certificate in the request context. The server
+// adds it to every sub router when client certificates are verified.
+func ClientIdentity(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		cert := r.TLS.VerifiedChains[0][0]
+		id := &Identity{
+			Subject:     auth.CertIdentity(cert),
+			Certificate: cert,
+		}
+
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, id)))
+	})
+}
+
+// IdentityFromContext returns the verified client identity
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
@@ -15,7 +15,9 @@
 package middleware
 
 import (
+	"bufio"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
@@ -64,6 +66,22 @@ func (r *StatusRec) WriteHeader(status int) {
 	r.ResponseWriter.WriteHeader(status)
 }
 
+// Flush sends buffered data to the client for streaming handlers
+func (r *StatusRec) Flush() {
+	http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+// Hijack lets websocket handlers take over the connection
+func (r *StatusRec) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.Status = http.StatusSwitchingProtocols
+	return http.NewResponseController(r.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the wrapped http.ResponseWriter for http.ResponseController
+func (r *StatusRec) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 // CodesStats is a middleware that captures the status code and method of the request for metrics collection with Prometheus
 func CodeStats(h http.Handler, vec *prometheus.CounterVec, hist *prometheus.HistogramVec) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
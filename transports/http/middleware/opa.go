@@ -15,21 +15,27 @@
 package middleware
 
 import (
-	"bytes"
 	"encoding/json"
-	"fmt"
-	"io"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/CoverWhale/coverwhale-go/opa"
 	"github.com/CoverWhale/logr"
 )
 
+// Query is the legacy GraphQL request body.
+//
+// Deprecated: use GraphQLRequest
 type Query struct {
 	OperationName string    `json:"operationName,omitempty"`
 	Variables     Variables `json:"variables"`
 }
 
+// Variables are the variables of the legacy GraphQL request body.
+//
+// Deprecated: use GraphQLRequest
 type Variables struct {
 	Data any `json:"data"`
 }
@@ -37,35 +43,115 @@ type Variables struct {
 // ValidationFunc is used to map the data in the incoming request to an OPA request.
 // It's on the caller of the service to define the data in the OPA request and
 // what package is called in OPA.
-type ValidationFunc func([]byte) (opa.OPARequest, error)
+type ValidationFunc[T any] func([]byte) (opa.OPARequest[T], error)
+
+// ValidatorOption is a functional option to modify the OPA validation middlewares
+type ValidatorOption func(*validator)
+
+type validator struct {
+	client *opa.Client
+	pkg    string
+	shadow bool
+	sinks  []opa.DecisionSink
+
+	failOpen     bool
+	openPackages []string
+	lastDecision bool
+
+	maxBodySize int64
+}
+
+// WithClient sets the OPA client used by the middleware instead of creating one for the URL. This allows
+// for sharing a client, enabling the decision cache, or evaluating policies in process.
+func WithClient(c *opa.Client) ValidatorOption {
+	return func(v *validator) {
+		v.client = c
+	}
+}
+
+// WithShadowMode evaluates and records decisions but always lets the request through. This is useful for
+// seeing what new rules would deny before enforcing them.
+func WithShadowMode() ValidatorOption {
+	return func(v *validator) {
+		v.shadow = true
+	}
+}
+
+// WithDecisionSinks sends a record of every decision to the sinks, for example opa.LoggerSink, an
+// opa.WriterSink, or opa.DecisionMetrics for allow and deny counters
+func WithDecisionSinks(sinks ...opa.DecisionSink) ValidatorOption {
+	return func(v *validator) {
+		v.sinks = append(v.sinks, sinks...)
+	}
+}
+
+// WithFailOpen lets requests through when OPA can't be reached or the client's circuit breaker is open.
+// If packages are given, only middlewares for those packages or their sub packages fail open. Without this
+// option the middleware fails closed with a 503.
+func WithFailOpen(packages ...string) ValidatorOption {
+	return func(v *validator) {
+		v.failOpen = true
+		v.openPackages = append(v.openPackages, packages...)
+	}
+}
+
+// WithLastDecision uses the last successful decision for the same input when OPA can't be reached. The
+// client must keep decisions with opa.SetLastDecisions. If there is no decision the middleware falls back
+// to WithFailOpen or fails closed.
+func WithLastDecision() ValidatorOption {
+	return func(v *validator) {
+		v.lastDecision = true
+	}
+}
+
+// WithMaxBodySize sets the max request body size. Larger bodies get a 413. This has no effect if the
+// body was already buffered by BufferBody.
+func WithMaxBodySize(n int64) ValidatorOption {
+	return func(v *validator) {
+		v.maxBodySize = n
+	}
+}
+
+func newValidator(url opa.OPAURL, pkg string, opts ...ValidatorOption) *validator {
+	v := &validator{
+		pkg:         pkg,
+		maxBodySize: DefaultMaxBodySize,
+	}
+
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	if v.client == nil {
+		v.client = opa.NewClient(opa.SetURL(url))
+	}
+
+	return v
+}
 
 // StandardValidator calls the central OPA server with the full cw validation pacakge
-func StandardValidator(h http.Handler) http.Handler {
-	url := fmt.Sprintf("%s/v1/data/cw", opa.CentralOPA)
+func StandardValidator(h http.Handler, opts ...ValidatorOption) http.Handler {
+	v := newValidator(opa.CentralOPA, "cw", opts...)
 
 	fn := func(w http.ResponseWriter, r *http.Request) {
+		r, body, ok := bufferBody(w, r, v.maxBodySize)
+		if !ok {
+			return
+		}
 
-		buf, err := io.ReadAll(r.Body)
+		// the request body is already an OPA request
+		opaRequest, err := BodyJSON[opa.OPARequest[json.RawMessage]](body)
 		if err != nil {
-			logr.Errorf("error reading request body: %v", err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 			return
 		}
-		defer r.Body.Close()
-
-		// create two copies of request body since reading the body drains the reader
-		opaBody := io.NopCloser(bytes.NewBuffer(buf))
-		dataBody := io.NopCloser(bytes.NewBuffer(buf))
 
-		if !validate(w, opaBody, url) {
+		if !validate[opa.Result](v, w, r, opaRequest.Input) {
 			return
 		}
 
-		// reset the request body to the copied reader
-		r.Body = dataBody
-
+		r.Body = body.Reader()
 		h.ServeHTTP(w, r)
-
 	}
 
 	return http.HandlerFunc(fn)
@@ -74,91 +160,81 @@ func StandardValidator(h http.Handler) http.Handler {
 // CustomValidtor allows for calling a specific OPA instance and defining the package name
 // For example, to call a sidecar instead of the central OPA server and to only call
 // the cw/underwriting package instead of the full cw package.
-func CustomValidator(h http.Handler, customValidator ValidationFunc, url opa.OPAURL, pkg string) http.Handler {
-	endpoint := fmt.Sprintf("%s/v1/data/%s", url, pkg)
+func CustomValidator[T any](h http.Handler, customValidator ValidationFunc[T], url opa.OPAURL, pkg string, opts ...ValidatorOption) http.Handler {
+	return CustomResultValidator[T, opa.Result](h, customValidator, url, pkg, opts...)
+}
 
-	fn := func(w http.ResponseWriter, r *http.Request) {
+// CustomResultValidator is like CustomValidator but decodes the OPA result into R instead of opa.Result. This allows
+// for packages with other result documents, for example underwriting.Decision with its carriers.
+func CustomResultValidator[T any, R opa.Decider](h http.Handler, customValidator ValidationFunc[T], url opa.OPAURL, pkg string, opts ...ValidatorOption) http.Handler {
+	v := newValidator(url, pkg, opts...)
 
-		buf, err := io.ReadAll(r.Body)
-		if err != nil {
-			logr.Errorf("error reading request body: %v", err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		r, body, ok := bufferBody(w, r, v.maxBodySize)
+		if !ok {
 			return
 		}
-		defer r.Body.Close()
-
-		// create two copies of request body since reading the body drains the reader
-		dataBody := io.NopCloser(bytes.NewBuffer(buf))
 
-		opaRequest, err := customValidator(buf)
+		opaRequest, err := customValidator(body.Bytes())
 		if err != nil {
 			logr.Errorf("error from custom validation func: %v", err)
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		requestData, err := json.Marshal(opaRequest)
-		if err != nil {
-			logr.Errorf("error marshaling input data: %v", err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		}
-
-		if !validate(w, bytes.NewReader(requestData), endpoint) {
+		if !validate[R](v, w, r, opaRequest.Input) {
 			return
 		}
 
-		// reset the request body to the copied reader
-		r.Body = dataBody
-
+		r.Body = body.Reader()
 		h.ServeHTTP(w, r)
-
 	}
 
 	return http.HandlerFunc(fn)
 }
 
-// GraphQLCustomValidator is like the other CustomValidator function but for GraphQL requests. It passes through data if the
-// query type is an introspection so that schema requests aren't validated by OPA
-func GraphQLCustomValidator(handler http.Handler, customValidator ValidationFunc, url opa.OPAURL, pkg string) http.Handler {
-	endpoint := fmt.Sprintf("%s/v1/data/%s", url, pkg)
+// GraphQLCustomValidator is like the other CustomValidator function but for GraphQL requests. The query is parsed
+// and introspection queries are passed through so that schema requests aren't validated by OPA. The OPA input is a
+// GraphQLInput with the operation type, name, top level fields, and variables, and the custom validator's input
+// for variables.data as data.
+func GraphQLCustomValidator[T any](handler http.Handler, customValidator ValidationFunc[T], url opa.OPAURL, pkg string, opts ...ValidatorOption) http.Handler {
+	return GraphQLCustomResultValidator[T, opa.Result](handler, customValidator, url, pkg, opts...)
+}
+
+// GraphQLCustomResultValidator is like GraphQLCustomValidator but decodes the OPA result into R instead of opa.Result
+func GraphQLCustomResultValidator[T any, R opa.Decider](handler http.Handler, customValidator ValidationFunc[T], url opa.OPAURL, pkg string, opts ...ValidatorOption) http.Handler {
+	v := newValidator(url, pkg, opts...)
 
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		buf, err := io.ReadAll(r.Body)
-		if err != nil {
-			logr.Errorf("error reading request body: %v", err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		r, body, ok := bufferBody(w, r, v.maxBodySize)
+		if !ok {
 			return
 		}
-		defer r.Body.Close()
-
-		// create two copies of request body since reading the body drains the reader
-		queryBody := io.NopCloser(bytes.NewBuffer(buf))
-		dataBody := io.NopCloser(bytes.NewBuffer(buf))
 
-		data, err := io.ReadAll(queryBody)
+		q, err := BodyJSON[GraphQLRequest](body)
 		if err != nil {
+			logr.Errorf("error unmarshaling query data: %v", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 			return
 		}
-		defer queryBody.Close()
-
-		var q Query
 
-		if err := json.Unmarshal(data, &q); err != nil {
-			logr.Errorf("error unmarshaling query data: %v", err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		operation, err := ParseGraphQLOperation(q.Query, q.OperationName)
+		if err != nil {
+			logr.Errorf("error parsing graphql query: %v", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 			return
 		}
 
 		// return introspection queries directly for schema lookups.
-		if q.OperationName == "IntrospectionQuery" {
-			r.Body = dataBody
+		if operation.IsIntrospection() {
 			handler.ServeHTTP(w, r)
 			return
 		}
 
-		opaData, err := json.Marshal(q.Variables.Data)
+		opaData, err := json.Marshal(q.Variables["data"])
 		if err != nil {
+			logr.Errorf("error encoding query variables: %v", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 			return
 		}
 
@@ -169,63 +245,139 @@ func GraphQLCustomValidator(handler http.Handler, customValidator ValidationFunc
 			return
 		}
 
-		requestData, err := json.Marshal(opaRequest)
-		if err != nil {
-			logr.Errorf("error marshaling input data: %v", err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
+		input := GraphQLInput[T]{
+			GraphQLOperation: operation,
+			Variables:        q.Variables,
+			Data:             opaRequest.Input,
 		}
 
-		if !validate(w, bytes.NewReader(requestData), endpoint) {
+		if !validate[R](v, w, r, input) {
 			return
 		}
 
-		// reset the request body to the copied reader
-		r.Body = dataBody
-
+		r.Body = body.Reader()
 		handler.ServeHTTP(w, r)
 	}
 
 	return http.HandlerFunc(fn)
 }
 
-func validate(w http.ResponseWriter, r io.Reader, url string) bool {
-	var or opa.OPAResponse
+// validate asks OPA for a decision on the input, decodes the result document into R, and writes the response
+// if the request isn't allowed. In shadow mode the decision is only recorded. When OPA fails the request is
+// handled by the failure mode and OPA's status is never returned to the client.
+func validate[R opa.Decider](v *validator, w http.ResponseWriter, r *http.Request, input any) bool {
+	var result R
+
+	start := time.Now()
+	data, err := v.client.Decide(r.Context(), v.pkg, input)
+	latency := time.Since(start)
+
+	source := opa.SourceOPA
+	if err != nil && !errors.Is(err, opa.ErrUndefined) {
+		logr.Errorf("error querying OPA for %s: %v", v.pkg, err)
+		last, ok := v.last(input)
+		if v.shadow || !ok {
+			v.record(r, input, nil, false, latency, source, err)
+			if v.shadow {
+				return true
+			}
+			return v.fail(w)
+		}
+		data, err, source = last, nil, opa.SourceLastDecision
+	}
 
-	data, err := io.ReadAll(r)
-	if err != nil {
-		logr.Errorf("error decoding OPA request data: %v", err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return false
+	// an undefined decision is never an allow so there is nothing to decode
+	if err == nil {
+		if err := json.Unmarshal(data, &result); err != nil {
+			logr.Errorf("error decoding response from OPA: %v", err)
+			v.record(r, input, data, false, latency, source, err)
+			if v.shadow {
+				return true
+			}
+			return v.fail(w)
+		}
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewReader(data))
-	if err != nil {
-		logr.Errorf("error building OPA request: %v", err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	allowed := result.IsAllowed()
+	v.record(r, input, data, allowed, latency, source, nil)
+
+	if !allowed && !v.shadow {
+		w.WriteHeader(http.StatusUnauthorized)
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			logr.Errorf("error encoding OPA unauthorized response: %v", err)
+			return false
+		}
 		return false
 	}
 
-	if resp.StatusCode != 200 {
-		http.Error(w, http.StatusText(resp.StatusCode), resp.StatusCode)
-		return false
+	return true
+}
+
+// last returns the last decision for the input if WithLastDecision is used
+func (v *validator) last(input any) (json.RawMessage, bool) {
+	if !v.lastDecision {
+		return nil, false
+	}
+
+	return v.client.LastDecision(v.pkg, input)
+}
+
+// fail lets the request through if the package fails open and otherwise writes a 503
+func (v *validator) fail(w http.ResponseWriter) bool {
+	if v.opensOnFailure() {
+		return true
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&or); err != nil {
-		logr.Errorf("error decoding response from OPA: %v", err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	return false
+}
+
+func (v *validator) opensOnFailure() bool {
+	if !v.failOpen {
 		return false
 	}
 
-	if !or.Result.Allow {
-		w.WriteHeader(http.StatusUnauthorized)
-		if err := json.NewEncoder(w).Encode(or.Result); err != nil {
-			logr.Errorf("error encoding OPA unauthorized response: %v", err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return false
+	if len(v.openPackages) == 0 {
+		return true
+	}
+
+	pkg := strings.Trim(v.pkg, "/")
+	for _, p := range v.openPackages {
+		p = strings.Trim(p, "/")
+		if pkg == p || strings.HasPrefix(pkg, p+"/") {
+			return true
 		}
-		return false
 	}
 
-	return true
+	return false
+}
+
+// record sends the decision to the sinks. It's called once per request, after any fallback to the last
+// decision, with the source of the decision.
+func (v *validator) record(r *http.Request, input any, result json.RawMessage, allowed bool, latency time.Duration, source string, err error) {
+	if len(v.sinks) == 0 {
+		return
+	}
+
+	data, _ := json.Marshal(input)
+	record := opa.DecisionRecord{
+		Timestamp: time.Now(),
+		RequestID: r.Header.Get("X-Request-ID"),
+		Package:   strings.Trim(v.pkg, "/"),
+		InputHash: opa.InputHash(strings.Trim(v.pkg, "/"), data),
+		Result:    result,
+		Allowed:   allowed,
+		Shadow:    v.shadow,
+		Latency:   latency,
+		Source:    source,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	for _, sink := range v.sinks {
+		if err := sink.WriteDecision(record); err != nil {
+			logr.Errorf("error writing decision record: %v", err)
+		}
+	}
 }
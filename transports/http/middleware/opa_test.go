@@ -0,0 +1,137 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CoverWhale/coverwhale-go/opa"
+)
+
+func TestShadowMode(t *testing.T) {
+	client := opa.NewClient(opa.SetEvaluator(opa.Policies{
+		"cw/test": func(ctx context.Context, input json.RawMessage) (any, error) {
+			return opa.Result{Deny: []string{"denied"}}, nil
+		},
+	}))
+
+	tt := []struct {
+		name   string
+		opts   []ValidatorOption
+		status int
+		shadow bool
+	}{
+		{name: "enforced", status: http.StatusUnauthorized},
+		{name: "shadow", opts: []ValidatorOption{WithShadowMode()}, status: http.StatusOK, shadow: true},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			opts := append(v.opts, WithClient(client), WithDecisionSinks(opa.NewWriterSink(&buf)))
+
+			validation := func(data []byte) (opa.OPARequest[json.RawMessage], error) {
+				return opa.OPARequest[json.RawMessage]{Input: data}, nil
+			}
+			h := CustomValidator(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), validation, opa.SideCarOPA, "cw/test", opts...)
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"test"}`))
+			req.Header.Set("X-Request-ID", "abc")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != v.status {
+				t.Errorf("expected status %d but got %d", v.status, w.Code)
+			}
+
+			var record opa.DecisionRecord
+			if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+				t.Fatalf("error decoding decision record: %v", err)
+			}
+
+			if record.RequestID != "abc" || record.Package != "cw/test" || record.Allowed || record.Shadow != v.shadow {
+				t.Errorf("unexpected decision record %+v", record)
+			}
+			if record.InputHash == "" {
+				t.Error("expected input hash")
+			}
+		})
+	}
+}
+
+func TestFailureModes(t *testing.T) {
+	var healthy bool
+	client := opa.NewClient(opa.SetLastDecisions(10), opa.SetEvaluator(opa.EvaluatorFunc(func(ctx context.Context, pkg string, input json.RawMessage) (json.RawMessage, error) {
+		if !healthy {
+			return nil, &opa.StatusError{StatusCode: http.StatusBadGateway}
+		}
+		return json.RawMessage(`{"allow":true}`), nil
+	})))
+
+	tt := []struct {
+		name    string
+		pkg     string
+		opts    []ValidatorOption
+		healthy bool
+		status  int
+		source  string
+	}{
+		{name: "fail closed", pkg: "cw/test", status: http.StatusServiceUnavailable, source: opa.SourceOPA},
+		{name: "fail open", pkg: "cw/test", opts: []ValidatorOption{WithFailOpen()}, status: http.StatusOK, source: opa.SourceOPA},
+		{name: "fail open listed package", pkg: "cw/underwriting/decision", opts: []ValidatorOption{WithFailOpen("cw/underwriting")}, status: http.StatusOK, source: opa.SourceOPA},
+		{name: "fail open unlisted package", pkg: "cw/test", opts: []ValidatorOption{WithFailOpen("cw/underwriting")}, status: http.StatusServiceUnavailable, source: opa.SourceOPA},
+		{name: "store last decision", pkg: "cw/last", healthy: true, status: http.StatusOK, source: opa.SourceOPA},
+		{name: "last decision", pkg: "cw/last", opts: []ValidatorOption{WithLastDecision()}, status: http.StatusOK, source: opa.SourceLastDecision},
+		{name: "no last decision", pkg: "cw/test", opts: []ValidatorOption{WithLastDecision()}, status: http.StatusServiceUnavailable, source: opa.SourceOPA},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			healthy = v.healthy
+			validation := func(data []byte) (opa.OPARequest[json.RawMessage], error) {
+				return opa.OPARequest[json.RawMessage]{Input: data}, nil
+			}
+			var records []opa.DecisionRecord
+			sink := opa.DecisionSinkFunc(func(r opa.DecisionRecord) error {
+				records = append(records, r)
+				return nil
+			})
+			opts := append(v.opts, WithClient(client), WithDecisionSinks(sink))
+			h := CustomValidator(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), validation, opa.SideCarOPA, v.pkg, opts...)
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"test"}`))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != v.status {
+				t.Errorf("expected status %d but got %d", v.status, w.Code)
+			}
+
+			if len(records) != 1 {
+				t.Fatalf("expected 1 decision record but got %d", len(records))
+			}
+
+			if records[0].Source != v.source {
+				t.Errorf("expected source %s but got %s", v.source, records[0].Source)
+			}
+		})
+	}
+}
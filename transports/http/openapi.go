@@ -0,0 +1,435 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"reflect"
+	"strings"
+
+	cwerrors "github.com/CoverWhale/coverwhale-go/errors"
+	cwmiddleware "github.com/CoverWhale/coverwhale-go/transports/http/middleware"
+	"github.com/invopop/jsonschema"
+)
+
+const (
+	OpenAPIVersion = "3.1.0"
+	OpenAPIPath    = "/openapi.json"
+
+	clientErrorSchema = "ClientError"
+)
+
+// OpenAPIUI is the documentation UI served for the OpenAPI document
+type OpenAPIUI int
+
+const (
+	SwaggerUI OpenAPIUI = iota
+	RedocUI
+)
+
+// OpenAPIInfo is the API information added to the generated document
+type OpenAPIInfo struct {
+	Title       string
+	Description string
+	Version     string
+	// Servers are the base URLs of the API
+	Servers []string
+	// SecuritySchemes are referenced by name from RouteMeta.Auth
+	SecuritySchemes map[string]SecurityScheme
+}
+
+// OpenAPIDocument is an OpenAPI 3.1 document
+type OpenAPIDocument struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       OpenAPIDocumentInfo             `json:"info"`
+	Servers    []OpenAPIServer                 `json:"servers,omitempty"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+type OpenAPIDocumentInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type OpenAPIServer struct {
+	URL string `json:"url"`
+}
+
+// Operation describes a single route
+type Operation struct {
+	OperationID string                `json:"operationId,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name     string          `json:"name"`
+	In       string          `json:"in"`
+	Required bool            `json:"required,omitempty"`
+	Schema   json.RawMessage `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema json.RawMessage `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]json.RawMessage `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme  `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme is an OpenAPI security scheme, for example {Type: "http", Scheme: "bearer"} or
+// {Type: "apiKey", In: "header", Name: "X-API-Key"}
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+}
+
+// SetOpenAPI serves the OpenAPI document for the registered routes at /openapi.json
+func SetOpenAPI(info OpenAPIInfo) ServerOption {
+	return func(s *Server) {
+		s.openapi = &info
+	}
+}
+
+// SetOpenAPIUI serves a Swagger UI or Redoc page for the OpenAPI document at the path. The page loads its
+// assets from a CDN.
+func SetOpenAPIUI(path string, ui OpenAPIUI) ServerOption {
+	return func(s *Server) {
+		s.openapiUIPath = path
+		s.openapiUI = ui
+	}
+}
+
+// OpenAPI generates an OpenAPI document from the registered routes. Routes without a method are skipped.
+func (s *Server) OpenAPI() (*OpenAPIDocument, error) {
+	var info OpenAPIInfo
+	if s.openapi != nil {
+		info = *s.openapi
+	}
+
+	g := &openAPIGenerator{
+		reflector: &jsonschema.Reflector{Anonymous: true},
+		schemas:   make(map[string]json.RawMessage),
+	}
+
+	if err := g.addClientError(); err != nil {
+		return nil, err
+	}
+
+	doc := &OpenAPIDocument{
+		OpenAPI: OpenAPIVersion,
+		Info: OpenAPIDocumentInfo{
+			Title:       info.Title,
+			Description: info.Description,
+			Version:     info.Version,
+		},
+		Paths: make(map[string]map[string]Operation),
+		Components: Components{
+			Schemas:         g.schemas,
+			SecuritySchemes: info.SecuritySchemes,
+		},
+	}
+
+	for _, v := range info.Servers {
+		doc.Servers = append(doc.Servers, OpenAPIServer{URL: v})
+	}
+
+	for _, v := range s.Routes() {
+		if v.Method == "" {
+			continue
+		}
+
+		op, err := g.operation(v)
+		if err != nil {
+			return nil, fmt.Errorf("error generating operation for %s: %w", v.Pattern(), err)
+		}
+
+		path := openAPIPath(v.Path)
+		if _, ok := doc.Paths[path]; !ok {
+			doc.Paths[path] = make(map[string]Operation)
+		}
+		doc.Paths[path][strings.ToLower(v.Method)] = op
+	}
+
+	return doc, nil
+}
+
+func (s *Server) serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	doc, err := s.OpenAPI()
+	if err != nil {
+		s.Logger.Errorf("error generating OpenAPI document: %v", err)
+		http.Error(w, ErrInternalError.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(doc); err != nil {
+		s.Logger.Errorf("error encoding OpenAPI document: %v", err)
+	}
+}
+
+func (s *Server) serveOpenAPIUI(w http.ResponseWriter, r *http.Request) {
+	page := swaggerUIPage
+	if s.openapiUI == RedocUI {
+		page = redocPage
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, page, html.EscapeString(s.openapi.Title), OpenAPIPath)
+}
+
+// registerOpenAPI adds the document and UI handlers when enabled by server options
+func (s *Server) registerOpenAPI() {
+	if s.openapi == nil {
+		return
+	}
+
+	s.handleServer(OpenAPIPath, http.HandlerFunc(s.serveOpenAPI))
+
+	if s.openapiUIPath != "" {
+		s.handleServer(s.openapiUIPath, http.HandlerFunc(s.serveOpenAPIUI))
+	}
+}
+
+type openAPIGenerator struct {
+	reflector *jsonschema.Reflector
+	schemas   map[string]json.RawMessage
+}
+
+// schema reflects the type and moves its definitions to the document components
+func (g *openAPIGenerator) schema(t reflect.Type) (json.RawMessage, error) {
+	s := g.reflector.ReflectFromType(t)
+	for k, v := range s.Definitions {
+		def, err := componentSchema(v)
+		if err != nil {
+			return nil, err
+		}
+		g.schemas[k] = def
+	}
+	s.Definitions = nil
+	s.Version = ""
+
+	return componentSchema(s)
+}
+
+// componentSchema rewrites the $defs references from the reflector to the document components
+func componentSchema(s *jsonschema.Schema) (json.RawMessage, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.ReplaceAll(data, []byte(`"#/$defs/`), []byte(`"#/components/schemas/`)), nil
+}
+
+// addClientError adds the error envelope written by errors.ClientError. Each error is either a message or an
+// error with metadata.
+func (g *openAPIGenerator) addClientError() error {
+	metadata, err := g.schema(reflect.TypeOf(cwerrors.ErrorWithMetadata{}))
+	if err != nil {
+		return err
+	}
+
+	envelope := map[string]any{
+		"type":     "object",
+		"required": []string{"errors"},
+		"properties": map[string]any{
+			"errors": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"oneOf": []any{
+						map[string]any{"type": "string"},
+						metadata,
+					},
+				},
+			},
+			"params": map[string]any{"type": "object"},
+		},
+	}
+
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	g.schemas[clientErrorSchema] = data
+
+	return nil
+}
+
+func (g *openAPIGenerator) operation(r RegisteredRoute) (Operation, error) {
+	op := Operation{
+		OperationID: r.Name,
+		Summary:     r.Meta.Summary,
+		Description: r.Meta.Description,
+		Tags:        r.Meta.Tags,
+		Responses:   make(map[string]Response),
+	}
+
+	params, err := g.parameters(r)
+	if err != nil {
+		return op, err
+	}
+	op.Parameters = params
+
+	if r.Meta.Request != nil {
+		schema, err := g.schema(reflect.TypeOf(r.Meta.Request))
+		if err != nil {
+			return op, err
+		}
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{"application/json": {Schema: schema}},
+		}
+	}
+
+	status := r.Meta.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := Response{Description: http.StatusText(status)}
+	if r.Meta.Response != nil {
+		schema, err := g.schema(reflect.TypeOf(r.Meta.Response))
+		if err != nil {
+			return op, err
+		}
+		success.Content = map[string]MediaType{"application/json": {Schema: schema}}
+	}
+	op.Responses[fmt.Sprint(status)] = success
+
+	errResponse := map[string]MediaType{
+		"application/json": {Schema: json.RawMessage(fmt.Sprintf(`{"$ref":"#/components/schemas/%s"}`, clientErrorSchema))},
+	}
+	for _, v := range r.Meta.Errors {
+		op.Responses[fmt.Sprint(v)] = Response{Description: http.StatusText(v), Content: errResponse}
+	}
+	op.Responses["default"] = Response{Description: "Error", Content: errResponse}
+
+	for _, v := range r.Meta.Auth {
+		op.Security = append(op.Security, map[string][]string{v: {}})
+	}
+
+	return op, nil
+}
+
+// parameters documents the fields of RouteMeta.Params tagged with path, query, or header. Path params
+// missing from the struct are added as strings.
+func (g *openAPIGenerator) parameters(r RegisteredRoute) ([]Parameter, error) {
+	var params []Parameter
+	documented := make(map[string]bool)
+
+	if r.Meta.Params != nil {
+		t := reflect.TypeOf(r.Meta.Params)
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("params must be a struct but got %s", t.Kind())
+		}
+
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			for _, in := range []string{"path", "query", "header"} {
+				name, ok := f.Tag.Lookup(in)
+				if !ok {
+					continue
+				}
+
+				schema, err := g.schema(f.Type)
+				if err != nil {
+					return nil, err
+				}
+
+				params = append(params, Parameter{
+					Name:     name,
+					In:       in,
+					Required: in == "path" || strings.Contains(f.Tag.Get("jsonschema"), "required"),
+					Schema:   schema,
+				})
+				if in == "path" {
+					documented[name] = true
+				}
+			}
+		}
+	}
+
+	for _, v := range cwmiddleware.PathParamNames(r.Path) {
+		if documented[v] {
+			continue
+		}
+		params = append(params, Parameter{Name: v, In: "path", Required: true, Schema: json.RawMessage(`{"type":"string"}`)})
+	}
+
+	return params, nil
+}
+
+// openAPIPath converts a ServeMux path to an OpenAPI path
+func openAPIPath(path string) string {
+	path = strings.TrimSuffix(path, "{$}")
+	return strings.ReplaceAll(path, "...}", "}")
+}
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>%s</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.onload = () => { window.ui = SwaggerUIBundle({ url: %q, dom_id: "#swagger-ui" }); };
+  </script>
+</body>
+</html>
+`
+
+const redocPage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>%s</title>
+</head>
+<body>
+  <redoc spec-url=%q></redoc>
+  <script src="https://cdn.redoc.ly/redoc/latest/bundles/redoc.standalone.js"></script>
+</body>
+</html>
+`
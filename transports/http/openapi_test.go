@@ -0,0 +1,156 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testProduct struct {
+	ID   string `json:"id"`
+	Name string `json:"name" jsonschema:"required"`
+}
+
+type testProductParams struct {
+	ID      string `path:"id"`
+	Expand  bool   `query:"expand"`
+	Tenant  string `header:"X-Tenant" jsonschema:"required"`
+	Ignored string
+}
+
+func TestOpenAPI(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	s := NewHTTPServer(
+		SetOpenAPI(OpenAPIInfo{
+			Title:   "Products",
+			Version: "1.0.0",
+			SecuritySchemes: map[string]SecurityScheme{
+				"bearer": {Type: "http", Scheme: "bearer"},
+			},
+		}),
+		SetOpenAPIUI("/docs", RedocUI),
+	)
+	if err := s.RegisterGroup(Group{
+		Prefix: "/api/v1/products",
+		Tags:   []string{"products"},
+		Routes: []Route{
+			{
+				Method:  http.MethodGet,
+				Path:    "/{id}",
+				Handler: ok,
+				Name:    "getProduct",
+				Meta: RouteMeta{
+					Summary:  "Get a product",
+					Params:   testProductParams{},
+					Response: testProduct{},
+					Errors:   []int{http.StatusNotFound},
+					Auth:     []string{"bearer"},
+				},
+			},
+			{
+				Method:  http.MethodPost,
+				Path:    "/",
+				Handler: ok,
+				Meta:    RouteMeta{Request: testProduct{}, Response: testProduct{}, Status: http.StatusCreated},
+			},
+			{
+				Method:  http.MethodGet,
+				Path:    "/{id}/files/{path...}",
+				Handler: ok,
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, OpenAPIPath, nil)
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 but got %d", w.Code)
+	}
+
+	var doc OpenAPIDocument
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("error decoding document: %v", err)
+	}
+
+	tt := []struct {
+		name  string
+		check func() bool
+	}{
+		{name: "version", check: func() bool { return doc.OpenAPI == OpenAPIVersion && doc.Info.Title == "Products" }},
+		{name: "paths", check: func() bool {
+			_, get := doc.Paths["/api/v1/products/{id}"]["get"]
+			_, post := doc.Paths["/api/v1/products/"]["post"]
+			_, files := doc.Paths["/api/v1/products/{id}/files/{path}"]["get"]
+			return get && post && files
+		}},
+		{name: "parameters", check: func() bool {
+			params := doc.Paths["/api/v1/products/{id}"]["get"].Parameters
+			if len(params) != 3 {
+				return false
+			}
+			return params[0].In == "path" && params[1].In == "query" && !params[1].Required && params[2].Name == "X-Tenant" && params[2].Required
+		}},
+		{name: "wildcard parameters", check: func() bool {
+			return len(doc.Paths["/api/v1/products/{id}/files/{path}"]["get"].Parameters) == 2
+		}},
+		{name: "request body", check: func() bool {
+			body := doc.Paths["/api/v1/products/"]["post"].RequestBody
+			return body != nil && strings.Contains(string(body.Content["application/json"].Schema), "#/components/schemas/testProduct")
+		}},
+		{name: "responses", check: func() bool {
+			op := doc.Paths["/api/v1/products/{id}"]["get"]
+			_, created := doc.Paths["/api/v1/products/"]["post"].Responses["201"]
+			notFound := strings.Contains(string(op.Responses["404"].Content["application/json"].Schema), clientErrorSchema)
+			return created && notFound && op.Responses["200"].Content != nil
+		}},
+		{name: "metadata", check: func() bool {
+			op := doc.Paths["/api/v1/products/{id}"]["get"]
+			return op.OperationID == "getProduct" && op.Tags[0] == "products" && op.Security[0]["bearer"] != nil
+		}},
+		{name: "components", check: func() bool {
+			_, product := doc.Components.Schemas["testProduct"]
+			_, clientErr := doc.Components.Schemas[clientErrorSchema]
+			_, metadata := doc.Components.Schemas["ErrorWithMetadata"]
+			return product && clientErr && metadata && doc.Components.SecuritySchemes["bearer"].Scheme == "bearer"
+		}},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			if !v.check() {
+				t.Errorf("unexpected document: %s", w.Body.String())
+			}
+		})
+	}
+
+	t.Run("ui", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/docs", nil)
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "redoc") {
+			t.Errorf("expected redoc page but got %d %s", w.Code, w.Body.String())
+		}
+	})
+}
@@ -16,6 +16,7 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net/http"
@@ -58,6 +59,23 @@ type Server struct {
 	Exporter       *metrics.Exporter
 	traceShutdown  func(context.Context) error
 	TracerProvider *trace.TracerProvider
+
+	cors            func(http.Handler) http.Handler
+	securityHeaders *cwmiddleware.SecurityHeaders
+	maxBodySize     int64
+
+	reloader   *certReloader
+	clientAuth tls.ClientAuthType
+
+	routes []RegisteredRoute
+	named  map[string]RegisteredRoute
+
+	openapi       *OpenAPIInfo
+	openapiUIPath string
+	openapiUI     OpenAPIUI
+
+	// errs are configuration errors from options, returned by Err and Serve
+	errs []error
 }
 
 // Route contains the information needed for an HTTP handler
@@ -65,6 +83,11 @@ type Route struct {
 	Method  string
 	Path    string
 	Handler http.Handler
+	// Name identifies the route for URL building
+	Name string
+	// Middleware only wraps this route
+	Middleware []func(http.Handler) http.Handler
+	Meta       RouteMeta
 }
 
 func JsonHandler(h handlerWithError) handlerWithError {
@@ -86,6 +109,7 @@ func NewHTTPServer(opts ...ServerOption) *Server {
 		Logger:   logr.NewLogger(),
 		Router:   r,
 		Exporter: metrics.NewExporter(),
+		named:    make(map[string]RegisteredRoute),
 		apiServer: &http.Server{
 			Addr:         ":8080",
 			ReadTimeout:  10 * time.Second,
@@ -99,13 +123,26 @@ func NewHTTPServer(opts ...ServerOption) *Server {
 	}
 
 	s.getHealth()
+	s.registerOpenAPI()
 	s.apiServer.Handler = r
 
-	s.Router.Handle("GET /metrics", promhttp.Handler())
+	s.handleServer("/metrics", promhttp.Handler())
 
 	return s
 }
 
+// handleServer registers a GET endpoint served by the server itself, such as /healthz. The server options
+// for sub routers, including CORS, don't apply to these endpoints.
+func (s *Server) handleServer(path string, h http.Handler) {
+	s.Router.Handle("GET "+path, h)
+}
+
+// Err returns the configuration errors from the server options and RegisterSubRouter, such as an invalid CORS
+// policy or a duplicate route name. Serve sends them to the error channel instead of starting the server.
+func (s *Server) Err() error {
+	return errors.Join(s.errs...)
+}
+
 func HandleWithContext[T any](h func(http.ResponseWriter, *http.Request, T), ctx T) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		h(w, r, ctx)
@@ -114,10 +151,10 @@ func HandleWithContext[T any](h func(http.ResponseWriter, *http.Request, T), ctx
 
 func (s *Server) getHealth() {
 	if s.TracerProvider != nil {
-		s.Router.Handle("GET /healthz", otelhttp.NewHandler(http.HandlerFunc(healthz), "healthz:GET"))
+		s.handleServer("/healthz", otelhttp.NewHandler(http.HandlerFunc(healthz), "healthz:GET"))
 		return
 	}
-	s.Router.Handle("GET /healthz", http.HandlerFunc(healthz))
+	s.handleServer("/healthz", http.HandlerFunc(healthz))
 }
 
 // SetServerPort sets the server listening port
@@ -155,6 +192,56 @@ func SetTracerProvider(t *trace.TracerProvider) ServerOption {
 	}
 }
 
+// SetCORS applies the CORS policy to every sub router. The server's own endpoints, such as /healthz, /metrics,
+// and the OpenAPI document, don't send CORS headers. An invalid policy is returned by Err and Serve.
+func SetCORS(p cwmiddleware.CORSPolicy) ServerOption {
+	return func(s *Server) {
+		cors, err := cwmiddleware.CORS(p)
+		if err != nil {
+			s.errs = append(s.errs, fmt.Errorf("invalid CORS policy: %w", err))
+			return
+		}
+		s.cors = cors
+	}
+}
+
+// SetSecurityHeaders adds the security headers to every sub router response. Use
+// cwmiddleware.DefaultSecurityHeaders for a preset.
+func SetSecurityHeaders(h cwmiddleware.SecurityHeaders) ServerOption {
+	return func(s *Server) {
+		s.securityHeaders = &h
+	}
+}
+
+// SetMaxBodySize limits request bodies for every sub router. Larger requests get a 413.
+func SetMaxBodySize(n int64) ServerOption {
+	return func(s *Server) {
+		s.maxBodySize = n
+	}
+}
+
+// serverMiddleware wraps a sub router with the middlewares set by server options. They run before the sub
+// router's own middlewares so preflight requests are answered before authentication.
+func (s *Server) serverMiddleware(h http.Handler) http.Handler {
+	if s.maxBodySize > 0 {
+		h = cwmiddleware.MaxBodySize(s.maxBodySize)(h)
+	}
+
+	if s.clientAuth != tls.NoClientCert {
+		h = cwmiddleware.ClientIdentity(h)
+	}
+
+	if s.cors != nil {
+		h = s.cors(h)
+	}
+
+	if s.securityHeaders != nil {
+		h = cwmiddleware.SecureHeaders(*s.securityHeaders)(h)
+	}
+
+	return h
+}
+
 // ServeHTTP satisfies the http.Handler interface to allow for handling of errors from handlers in one place
 func (e *ErrHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	err := e.Handler(w, r)
@@ -169,13 +256,39 @@ func (e *ErrHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// client errors from the errors package, which can also set headers such as Retry-After
+	var coded interface {
+		Code() int
+		Body() []byte
+	}
+	if errors.As(err, &coded) {
+		if h, ok := coded.(interface{ ResponseHeaders() map[string]string }); ok {
+			for k, v := range h.ResponseHeaders() {
+				w.Header().Set(k, v)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(coded.Code())
+		w.Write(coded.Body())
+		return
+	}
+
 	e.Logger.Errorf("status=%d, err=%v", http.StatusInternalServerError, err)
 	w.WriteHeader(http.StatusInternalServerError)
 	w.Write([]byte(ErrInternalError.Error()))
 }
 
-// RegisterSubRouter creates a subrouter based on a path and a slice of routes. Any middlewares passed in will be mounted to the sub router
+// RegisterSubRouter creates a subrouter based on a path and a slice of routes. Any middlewares passed in will be mounted to the sub router.
+// Registration errors, such as a duplicate route name, are returned by Err and Serve. Use RegisterGroup to get them directly.
 func (s *Server) RegisterSubRouter(prefix string, routes []Route, middleware ...func(http.Handler) http.Handler) *Server {
+	if err := s.RegisterGroup(Group{Prefix: prefix, Routes: routes, Middleware: middleware}); err != nil {
+		s.errs = append(s.errs, err)
+	}
+
+	return s
+}
+
+func (s *Server) registerRoutes(prefix string, routes []Route, middleware ...func(http.Handler) http.Handler) {
 	// HTTP Muxer requires the trailing slash for the prefix but hen we remove the slash in the strip prefix
 	var prefixWithSlash string
 	if strings.HasSuffix(prefix, "/") {
@@ -187,8 +300,11 @@ func (s *Server) RegisterSubRouter(prefix string, routes []Route, middleware ...
 
 	subRouter := http.NewServeMux()
 	// we need to register each vector with a unique name, for now its a combination of the prefix and route path
-	replacer := strings.NewReplacer("{", "", "}", "", "/", "_", "[", "_", "]", "_", "-", "_")
-	name := fmt.Sprintf("%s%s", replacer.Replace(prefix), replacer.Replace(routes[0].Path))
+	replacer := strings.NewReplacer("{", "", "}", "", "/", "_", "[", "_", "]", "_", "-", "_", ".", "_", "$", "")
+	name := replacer.Replace(prefix)
+	if len(routes) > 0 {
+		name = fmt.Sprintf("%s%s", name, replacer.Replace(routes[0].Path))
+	}
 	counter := metrics.NewCounterVec(fmt.Sprintf("http_requests%s", name), "HTTP requests by status, path, and method", []string{"code", "method", "path"})
 	hist := metrics.NewHistogramVec(fmt.Sprintf("http_request_latency%s", name), "HTTP latency by status, path, and method", []string{"code", "method", "path"})
 
@@ -198,33 +314,76 @@ func (s *Server) RegisterSubRouter(prefix string, routes []Route, middleware ...
 		reqWrapped = m(reqWrapped)
 	}
 
+	reqWrapped = s.serverMiddleware(reqWrapped)
+
 	// wrap subrouter to catch all middleware and total metrics for the subrouter
 	for _, v := range routes {
+		registered := RegisteredRoute{
+			Method: v.Method,
+			Path:   stripped + v.Path,
+			Name:   v.Name,
+			Meta:   v.Meta,
+		}
+		s.addRoute(registered)
+
+		// the full route pattern is added to the context for middlewares such as Authz
+		handler := cwmiddleware.WithRoute(registered.Pattern(), v.Handler)
 		if s.traceShutdown != nil {
 			m := fmt.Sprintf("%v:%v", v.Path, v.Method)
-			subRouter.Handle(fmt.Sprintf("%s %s", v.Method, v.Path), otelhttp.NewHandler(v.Handler, m))
+			subRouter.Handle(fmt.Sprintf("%s %s", v.Method, v.Path), otelhttp.NewHandler(handler, m))
 		} else {
-			subRouter.Handle(fmt.Sprintf("%s %s", v.Method, v.Path), v.Handler)
+			subRouter.Handle(fmt.Sprintf("%s %s", v.Method, v.Path), handler)
 		}
 	}
 
 	s.Exporter.Metrics = append(s.Exporter.Metrics, counter, hist)
 
-	s.Router.Handle(prefixWithSlash, cwmiddleware.Logging(cwmiddleware.CodeStats(http.StripPrefix(stripped, reqWrapped), counter, hist)))
+	s.Router.Handle(prefixWithSlash, cwmiddleware.Logging(cwmiddleware.CodeStats(cwmiddleware.WithOriginalPath(http.StripPrefix(stripped, reqWrapped)), counter, hist)))
 
-	return s
 }
 
 // Serve starts the http.Server
 func (s *Server) Serve(errChan chan<- error) {
+	if err := s.Err(); err != nil {
+		errChan <- err
+		return
+	}
+
 	prometheus.MustRegister(s.Exporter.Metrics...)
 
+	if s.reloader != nil {
+		s.serveTLS(errChan)
+		return
+	}
+
 	s.Logger.Infof("starting HTTP server on %s", s.apiServer.Addr)
 	if err := s.apiServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		errChan <- err
 	}
 }
 
+func (s *Server) serveTLS(errChan chan<- error) {
+	cfg, err := s.tlsConfig()
+	if err != nil {
+		errChan <- err
+		return
+	}
+	s.apiServer.TLSConfig = cfg
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.apiServer.RegisterOnShutdown(cancel)
+	go func() {
+		if err := s.reloader.watch(ctx, s.Logger); err != nil {
+			s.Logger.Errorf("error watching certificates: %v", err)
+		}
+	}()
+
+	s.Logger.Infof("starting HTTPS server on %s", s.apiServer.Addr)
+	if err := s.apiServer.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		errChan <- err
+	}
+}
+
 // AutoHandleErrors is a convenience that should be called after starting the server.
 // It will automatically safely stop the server if a signal is received. This breaks
 // the normal pattern of letting the caller handle fatal errors, which is why this is a convenience
@@ -15,13 +15,17 @@
 package http
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
+	cwmiddleware "github.com/CoverWhale/coverwhale-go/transports/http/middleware"
 	"github.com/CoverWhale/logr"
 )
 
@@ -106,6 +110,114 @@ func TestRegisterSubrouter(t *testing.T) {
 	}
 }
 
+func TestServerOptions(t *testing.T) {
+	routes := []Route{
+		{
+			Method: http.MethodPost,
+			Path:   "/test",
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, err := io.ReadAll(r.Body); err != nil {
+					w.WriteHeader(http.StatusRequestEntityTooLarge)
+				}
+			}),
+		},
+	}
+
+	s := NewHTTPServer(
+		SetCORS(cwmiddleware.CORSPolicy{AllowedOrigins: []string{"https://*.coverwhale.com"}, AllowedMethods: []string{http.MethodPost}, MaxAge: time.Hour}),
+		SetSecurityHeaders(cwmiddleware.DefaultSecurityHeaders()),
+		SetMaxBodySize(10),
+	)
+	s.RegisterSubRouter("/api", routes)
+
+	tt := []struct {
+		name    string
+		method  string
+		path    string
+		origin  string
+		body    string
+		status  int
+		headers map[string]string
+	}{
+		{
+			name:    "preflight",
+			method:  http.MethodOptions,
+			origin:  "https://app.coverwhale.com",
+			status:  http.StatusNoContent,
+			headers: map[string]string{"Access-Control-Allow-Origin": "https://app.coverwhale.com", "Access-Control-Allow-Methods": "POST", "Access-Control-Max-Age": "3600"},
+		},
+		{
+			name:   "preflight from unknown origin",
+			method: http.MethodOptions,
+			origin: "https://example.com",
+			status: http.StatusForbidden,
+		},
+		{
+			name:    "request",
+			method:  http.MethodPost,
+			origin:  "https://app.coverwhale.com",
+			body:    "{}",
+			status:  http.StatusOK,
+			headers: map[string]string{"Access-Control-Allow-Origin": "https://app.coverwhale.com", "X-Content-Type-Options": "nosniff", "X-Frame-Options": "DENY"},
+		},
+		{
+			name:   "body too large",
+			method: http.MethodPost,
+			body:   `{"name": "too large"}`,
+			status: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:    "health check",
+			method:  http.MethodGet,
+			path:    "/healthz",
+			origin:  "https://app.coverwhale.com",
+			status:  http.StatusOK,
+			headers: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			path := v.path
+			if path == "" {
+				path = "/api/test"
+			}
+			req := httptest.NewRequest(v.method, path, strings.NewReader(v.body))
+			if v.origin != "" {
+				req.Header.Set("Origin", v.origin)
+			}
+			if v.method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			w := httptest.NewRecorder()
+			s.Router.ServeHTTP(w, req)
+
+			if w.Code != v.status {
+				t.Errorf("expected status %d but got %d", v.status, w.Code)
+			}
+
+			for k, val := range v.headers {
+				if w.Header().Get(k) != val {
+					t.Errorf("expected header %s to be %q but got %q", k, val, w.Header().Get(k))
+				}
+			}
+		})
+	}
+}
+
+func TestSetCORSInvalidPolicy(t *testing.T) {
+	s := NewHTTPServer(SetCORS(cwmiddleware.CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}))
+	if err := s.Err(); !errors.Is(err, cwmiddleware.ErrCORSCredentialsWildcard) {
+		t.Fatalf("expected error %v but got %v", cwmiddleware.ErrCORSCredentialsWildcard, err)
+	}
+
+	errChan := make(chan error, 1)
+	s.Serve(errChan)
+	if err := <-errChan; !errors.Is(err, cwmiddleware.ErrCORSCredentialsWildcard) {
+		t.Errorf("expected Serve to return %v but got %v", cwmiddleware.ErrCORSCredentialsWildcard, err)
+	}
+}
+
 func TestErrHandlerServeHTTP(t *testing.T) {
 	tt := []struct {
 		name    string
@@ -0,0 +1,208 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	cwmiddleware "github.com/CoverWhale/coverwhale-go/transports/http/middleware"
+)
+
+var (
+	ErrRouteNotFound = fmt.Errorf("route not found")
+	ErrMissingParam  = fmt.Errorf("missing path param")
+	ErrDuplicateName = fmt.Errorf("route name is already registered")
+)
+
+// RouteMeta describes a route for documentation and tooling
+type RouteMeta struct {
+	Summary     string
+	Description string
+	Tags        []string
+	// Auth lists the authentication schemes or scopes the route requires. An empty list means the route
+	// is public.
+	Auth []string
+	// Request is a value of the JSON request body type, such as Product{}
+	Request any
+	// Response is a value of the JSON response body type
+	Response any
+	// Status is the success status code. It defaults to 200.
+	Status int
+	// Params is a struct whose fields are tagged with path, query, or header to document request parameters
+	Params any
+	// Errors are the client error status codes the route returns
+	Errors []int
+	// Extra holds any other metadata
+	Extra map[string]any
+}
+
+// Group is a set of routes under a prefix. Groups can be nested and each group's middleware only wraps
+// the routes in that group and the groups below it.
+type Group struct {
+	Prefix     string
+	Routes     []Route
+	Groups     []Group
+	Middleware []func(http.Handler) http.Handler
+	// Tags are added to the metadata of every route in the group
+	Tags []string
+}
+
+// RegisteredRoute is a route as it was registered on the server
+type RegisteredRoute struct {
+	Method string
+	// Path is the full path including the sub router prefix, such as /api/v1/products/{id}
+	Path string
+	Name string
+	Meta RouteMeta
+}
+
+// Pattern returns the ServeMux pattern for the route
+func (r RegisteredRoute) Pattern() string {
+	if r.Method == "" {
+		return r.Path
+	}
+
+	return fmt.Sprintf("%s %s", r.Method, r.Path)
+}
+
+// flatten returns the routes of the group and its nested groups with paths relative to the top level group.
+// Handlers are wrapped with the middleware of every nested group and the route itself.
+func (g Group) flatten(prefix string, middleware []func(http.Handler) http.Handler, tags []string) []Route {
+	var routes []Route
+
+	for _, v := range g.Routes {
+		route := v
+		route.Path = joinPath(prefix, v.Path)
+		route.Meta.Tags = append(append([]string{}, tags...), v.Meta.Tags...)
+
+		mws := append(append([]func(http.Handler) http.Handler{}, middleware...), v.Middleware...)
+		for i := len(mws) - 1; i >= 0; i-- {
+			route.Handler = mws[i](route.Handler)
+		}
+		route.Middleware = nil
+
+		routes = append(routes, route)
+	}
+
+	for _, v := range g.Groups {
+		mws := append(append([]func(http.Handler) http.Handler{}, middleware...), v.Middleware...)
+		groupTags := append(append([]string{}, tags...), v.Tags...)
+		routes = append(routes, v.flatten(joinPath(prefix, v.Prefix), mws, groupTags)...)
+	}
+
+	return routes
+}
+
+func joinPath(prefix, path string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if path == "" {
+		return prefix
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	return prefix + path
+}
+
+// RegisterGroup registers a group as a sub router. The group's middleware is mounted on the sub router, like
+// the middleware passed to RegisterSubRouter, and nested groups and routes are wrapped with their own. If a
+// route name is already used ErrDuplicateName is returned and none of the group's routes are registered.
+func (s *Server) RegisterGroup(g Group) error {
+	routes := Group{Routes: g.Routes, Groups: g.Groups}.flatten("", nil, g.Tags)
+	if err := s.checkNames(routes); err != nil {
+		return err
+	}
+
+	s.registerRoutes(g.Prefix, routes, g.Middleware...)
+	return nil
+}
+
+// Routes returns every registered route sorted by path and method
+func (s *Server) Routes() []RegisteredRoute {
+	routes := append([]RegisteredRoute{}, s.routes...)
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Path == routes[j].Path {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Path < routes[j].Path
+	})
+
+	return routes
+}
+
+// URL builds the path for a named route. Params are pairs of names and values, for example
+// s.URL("product", "id", "123"). Values are escaped except for {name...} wildcards, which can contain slashes.
+func (s *Server) URL(name string, params ...string) (string, error) {
+	route, ok := s.named[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrRouteNotFound, name)
+	}
+
+	values := make(map[string]string)
+	for i := 0; i+1 < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+
+	path := strings.TrimSuffix(route.Path, "{$}")
+	for _, v := range cwmiddleware.PathParamNames(path) {
+		val, ok := values[v]
+		if !ok {
+			return "", fmt.Errorf("%w %q for route %s", ErrMissingParam, v, name)
+		}
+
+		if strings.Contains(path, "{"+v+"...}") {
+			segments := strings.Split(val, "/")
+			for i := range segments {
+				segments[i] = url.PathEscape(segments[i])
+			}
+			path = strings.Replace(path, "{"+v+"...}", strings.Join(segments, "/"), 1)
+			continue
+		}
+
+		path = strings.Replace(path, "{"+v+"}", url.PathEscape(val), 1)
+	}
+
+	return path, nil
+}
+
+// checkNames returns an error if a route name is already registered or used twice in the routes
+func (s *Server) checkNames(routes []Route) error {
+	names := make(map[string]bool)
+	for _, v := range routes {
+		if v.Name == "" {
+			continue
+		}
+
+		if _, ok := s.named[v.Name]; ok || names[v.Name] {
+			return fmt.Errorf("%w: %q", ErrDuplicateName, v.Name)
+		}
+		names[v.Name] = true
+	}
+
+	return nil
+}
+
+func (s *Server) addRoute(r RegisteredRoute) {
+	if r.Name != "" {
+		s.named[r.Name] = r
+	}
+
+	s.routes = append(s.routes, r)
+}
@@ -0,0 +1,206 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func header(name, value string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add(name, value)
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestRegisterGroup(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	s := NewHTTPServer()
+	if err := s.RegisterGroup(Group{
+		Prefix:     "/api/v1",
+		Middleware: []func(http.Handler) http.Handler{header("X-Layer", "root")},
+		Routes: []Route{
+			{Method: http.MethodGet, Path: "/health", Handler: ok, Name: "health"},
+		},
+		Groups: []Group{
+			{
+				Prefix:     "/products",
+				Tags:       []string{"products"},
+				Middleware: []func(http.Handler) http.Handler{header("X-Layer", "products")},
+				Routes: []Route{
+					{Method: http.MethodGet, Path: "/{id}", Handler: ok, Name: "product", Meta: RouteMeta{Summary: "Get a product", Auth: []string{"bearer"}}},
+					{
+						Method:     http.MethodPost,
+						Path:       "",
+						Handler:    ok,
+						Name:       "createProduct",
+						Middleware: []func(http.Handler) http.Handler{header("X-Layer", "route")},
+					},
+				},
+				Groups: []Group{
+					{
+						Prefix: "/{id}/files",
+						Routes: []Route{
+							{Method: http.MethodGet, Path: "/{path...}", Handler: ok, Name: "file"},
+						},
+					},
+				},
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("middleware", func(t *testing.T) {
+		tt := []struct {
+			method string
+			path   string
+			layers []string
+		}{
+			{method: http.MethodGet, path: "/api/v1/health", layers: []string{"root"}},
+			{method: http.MethodGet, path: "/api/v1/products/1", layers: []string{"root", "products"}},
+			{method: http.MethodPost, path: "/api/v1/products", layers: []string{"root", "products", "route"}},
+			{method: http.MethodGet, path: "/api/v1/products/1/files/a/b.pdf", layers: []string{"root", "products"}},
+		}
+
+		for _, v := range tt {
+			req := httptest.NewRequest(v.method, v.path, nil)
+			w := httptest.NewRecorder()
+			s.Router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("%s %s: expected status 200 but got %d", v.method, v.path, w.Code)
+			}
+			if !reflect.DeepEqual(w.Header().Values("X-Layer"), v.layers) {
+				t.Errorf("%s %s: expected middleware %v but got %v", v.method, v.path, v.layers, w.Header().Values("X-Layer"))
+			}
+		}
+	})
+
+	t.Run("routes", func(t *testing.T) {
+		var patterns []string
+		for _, v := range s.Routes() {
+			patterns = append(patterns, v.Pattern())
+			if v.Name == "product" && (v.Meta.Summary != "Get a product" || !reflect.DeepEqual(v.Meta.Tags, []string{"products"})) {
+				t.Errorf("unexpected metadata %+v", v.Meta)
+			}
+		}
+
+		expected := []string{"GET /api/v1/health", "POST /api/v1/products", "GET /api/v1/products/{id}", "GET /api/v1/products/{id}/files/{path...}"}
+		if !reflect.DeepEqual(patterns, expected) {
+			t.Errorf("expected routes %v but got %v", expected, patterns)
+		}
+	})
+
+	t.Run("url", func(t *testing.T) {
+		tt := []struct {
+			name     string
+			params   []string
+			expected string
+			err      error
+		}{
+			{name: "product", params: []string{"id", "a b"}, expected: "/api/v1/products/a%20b"},
+			{name: "file", params: []string{"id", "1", "path", "docs/policy.pdf"}, expected: "/api/v1/products/1/files/docs/policy.pdf"},
+			{name: "product", err: ErrMissingParam},
+			{name: "missing", err: ErrRouteNotFound},
+		}
+
+		for _, v := range tt {
+			u, err := s.URL(v.name, v.params...)
+			if !errors.Is(err, v.err) {
+				t.Errorf("%s: expected error %v but got %v", v.name, v.err, err)
+			}
+			if u != v.expected {
+				t.Errorf("%s: expected %s but got %s", v.name, v.expected, u)
+			}
+		}
+	})
+}
+
+func TestRegisterSubRouterEmpty(t *testing.T) {
+	s := NewHTTPServer()
+	s.RegisterSubRouter("/empty", nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/empty/anything", strings.NewReader(""))
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 but got %d", w.Code)
+	}
+}
+
+func TestDuplicateRouteName(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	// a group with a duplicate name isn't registered at all
+	tt := []struct {
+		name       string
+		groups     []Group
+		registered bool
+	}{
+		{
+			name: "same group",
+			groups: []Group{
+				{Prefix: "/api", Routes: []Route{{Method: http.MethodGet, Path: "/a", Handler: ok, Name: "route"}, {Method: http.MethodGet, Path: "/b", Handler: ok, Name: "route"}}},
+			},
+		},
+		{
+			name: "other group",
+			groups: []Group{
+				{Prefix: "/api", Routes: []Route{{Method: http.MethodGet, Path: "/a", Handler: ok, Name: "route"}}},
+				{Prefix: "/other", Routes: []Route{{Method: http.MethodGet, Path: "/b", Handler: ok, Name: "route"}}},
+			},
+			registered: true,
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			s := NewHTTPServer()
+
+			var err error
+			for _, g := range v.groups {
+				err = s.RegisterGroup(g)
+			}
+			if !errors.Is(err, ErrDuplicateName) {
+				t.Fatalf("expected error %v but got %v", ErrDuplicateName, err)
+			}
+
+			u, _ := s.URL("route")
+			if registered := u == "/api/a"; registered != v.registered {
+				t.Errorf("expected registered to be %t but got URL %q", v.registered, u)
+			}
+		})
+	}
+
+	t.Run("sub router", func(t *testing.T) {
+		s := NewHTTPServer()
+		s.RegisterSubRouter("/api", []Route{{Method: http.MethodGet, Path: "/a", Handler: ok, Name: "route"}}).
+			RegisterSubRouter("/other", []Route{{Method: http.MethodGet, Path: "/b", Handler: ok, Name: "route"}})
+
+		if err := s.Err(); !errors.Is(err, ErrDuplicateName) {
+			t.Errorf("expected error %v but got %v", ErrDuplicateName, err)
+		}
+	})
+}
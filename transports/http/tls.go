@@ -0,0 +1,193 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/CoverWhale/logr"
+	"github.com/fsnotify/fsnotify"
+)
+
+// certReloader serves the certificate and client CAs from files and reloads them when the files change
+type certReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	cas  *x509.CertPool
+}
+
+// SetTLS serves HTTPS with the certificate and key files. The files are reloaded when they change, including
+// when a Kubernetes secret is updated.
+func SetTLS(certFile, keyFile string) ServerOption {
+	return func(s *Server) {
+		s.certs().certFile = certFile
+		s.certs().keyFile = keyFile
+	}
+}
+
+// SetClientCAFile verifies client certificates with the CAs in the PEM file. When required is false, clients
+// without a certificate are still accepted but any certificate they send must be valid. The file is reloaded
+// when it changes. Client certificates are checked during the TLS handshake, so a required certificate also
+// applies to /healthz and /metrics; probes and scrapers need one too.
+func SetClientCAFile(caFile string, required bool) ServerOption {
+	return func(s *Server) {
+		s.certs().caFile = caFile
+		s.setClientAuth(required)
+	}
+}
+
+// SetClientCAs verifies client certificates with the CA pool. When required is false, clients without a
+// certificate are still accepted but any certificate they send must be valid. Like SetClientCAFile, a required
+// certificate also applies to /healthz and /metrics.
+func SetClientCAs(pool *x509.CertPool, required bool) ServerOption {
+	return func(s *Server) {
+		s.certs().cas = pool
+		s.setClientAuth(required)
+	}
+}
+
+func (s *Server) certs() *certReloader {
+	if s.reloader == nil {
+		s.reloader = &certReloader{}
+	}
+
+	return s.reloader
+}
+
+func (s *Server) setClientAuth(required bool) {
+	s.clientAuth = tls.VerifyClientCertIfGiven
+	if required {
+		s.clientAuth = tls.RequireAndVerifyClientCert
+	}
+}
+
+// tlsConfig loads the certificates and returns the config for the server
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	r := s.reloader
+	if r.certFile == "" || r.keyFile == "" {
+		return nil, fmt.Errorf("a certificate and key are required for TLS")
+	}
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: s.clientAuth,
+	}
+
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+
+		cfg := base.Clone()
+		cfg.GetConfigForClient = nil
+		cfg.Certificates = []tls.Certificate{*r.cert}
+		cfg.ClientCAs = r.cas
+		return cfg, nil
+	}
+
+	return base, nil
+}
+
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading certificate: %w", err)
+	}
+
+	cas := r.cas
+	if r.caFile != "" {
+		data, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("error reading client CAs: %w", err)
+		}
+
+		cas = x509.NewCertPool()
+		if !cas.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in %s", r.caFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = &cert
+	r.cas = cas
+
+	return nil
+}
+
+// watch reloads the certificates when files in their directories change until the context is canceled. If
+// the new files are invalid the previous certificates are kept. The server's logger is passed in when the server
+// starts so a Logger set after NewHTTPServer is used.
+func (r *certReloader) watch(ctx context.Context, logger *logr.Logger) error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	dirs := make(map[string]bool)
+	for _, v := range []string{r.certFile, r.keyFile, r.caFile} {
+		if v == "" || dirs[filepath.Dir(v)] {
+			continue
+		}
+		dirs[filepath.Dir(v)] = true
+		if err := fw.Add(filepath.Dir(v)); err != nil {
+			return err
+		}
+	}
+
+	// the cert and key are usually written separately so wait for both
+	timer := time.NewTimer(time.Second)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Errorf("error watching certificates: %v", err)
+		case _, ok := <-fw.Events:
+			if !ok {
+				return nil
+			}
+			timer.Reset(time.Second)
+		case <-timer.C:
+			if err := r.reload(); err != nil {
+				logger.Errorf("error reloading certificates, keeping previous certificates: %v", err)
+				continue
+			}
+			logger.Info("reloaded TLS certificates")
+		}
+	}
+}
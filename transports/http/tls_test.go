@@ -0,0 +1,180 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cwmiddleware "github.com/CoverWhale/coverwhale-go/transports/http/middleware"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+	tls  tls.Certificate
+}
+
+func newTestCert(t *testing.T, cn string, serial int64, parent *testCert) testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testCert{cert: cert, key: key, pem: certPEM, tls: pair}
+}
+
+func writeCert(t *testing.T, dir string, c testCert) {
+	t.Helper()
+	keyDER, _ := x509.MarshalECPrivateKey(c.key)
+	if err := os.WriteFile(filepath.Join(dir, "tls.key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tls.crt"), c.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", 1, nil)
+	writeCert(t, dir, newTestCert(t, "server", 2, &ca))
+	if err := os.WriteFile(filepath.Join(dir, "ca.crt"), ca.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	client := newTestCert(t, "client", 3, &ca)
+
+	s := NewHTTPServer(
+		SetTLS(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")),
+		SetClientCAFile(filepath.Join(dir, "ca.crt"), true),
+	)
+	s.RegisterSubRouter("/api", []Route{
+		{
+			Method: http.MethodGet,
+			Path:   "/whoami",
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				id, ok := cwmiddleware.IdentityFromContext(r.Context())
+				if !ok {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.Write([]byte(id.Subject))
+			}),
+		},
+	})
+
+	cfg, err := s.tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(s.Router)
+	srv.TLS = cfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	get := func(certs ...tls.Certificate) (*http.Response, error) {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: certs}}}
+		return c.Get(srv.URL + "/api/whoami")
+	}
+
+	resp, err := get(client.tls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, 6)
+	resp.Body.Read(body)
+	resp.Body.Close()
+	if string(body) != "client" {
+		t.Errorf("expected client identity but got %q", body)
+	}
+
+	if _, err := get(); err == nil {
+		t.Error("expected request without a client certificate to fail")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.reloader.watch(ctx, s.Logger)
+	time.Sleep(50 * time.Millisecond)
+
+	writeCert(t, dir, newTestCert(t, "server", 4, &ca))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := get(client.tls)
+		if err == nil {
+			resp.Body.Close()
+			if resp.TLS.PeerCertificates[0].SerialNumber.Int64() == 4 {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected rotated certificate to be served")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nats.go/micro"
+)
+
+const AsyncAPIVersion = "3.0.0"
+
+// AsyncAPIDocument is an AsyncAPI 3.0 document describing the request and reply endpoints of a service
+type AsyncAPIDocument struct {
+	AsyncAPI           string                       `json:"asyncapi"`
+	Info               AsyncAPIInfo                 `json:"info"`
+	DefaultContentType string                       `json:"defaultContentType"`
+	Channels           map[string]AsyncAPIChannel   `json:"channels"`
+	Operations         map[string]AsyncAPIOperation `json:"operations"`
+	Components         AsyncAPIComponents           `json:"components"`
+}
+
+type AsyncAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type AsyncAPIChannel struct {
+	// Address is the subject. A nil address is a reply inbox.
+	Address    *string                      `json:"address"`
+	Messages   map[string]AsyncAPIRef       `json:"messages"`
+	Parameters map[string]AsyncAPIParameter `json:"parameters,omitempty"`
+}
+
+type AsyncAPIParameter struct {
+	Description string `json:"description,omitempty"`
+}
+
+type AsyncAPIOperation struct {
+	Action   string         `json:"action"`
+	Channel  AsyncAPIRef    `json:"channel"`
+	Summary  string         `json:"summary,omitempty"`
+	Messages []AsyncAPIRef  `json:"messages"`
+	Reply    *AsyncAPIReply `json:"reply,omitempty"`
+}
+
+type AsyncAPIReply struct {
+	Channel  AsyncAPIRef   `json:"channel"`
+	Messages []AsyncAPIRef `json:"messages"`
+}
+
+type AsyncAPIRef struct {
+	Ref string `json:"$ref"`
+}
+
+type AsyncAPIComponents struct {
+	Messages map[string]AsyncAPIMessage `json:"messages"`
+}
+
+type AsyncAPIMessage struct {
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// AsyncAPI builds an AsyncAPI document from the service info. Each endpoint is an operation the service
+// receives with a reply, using the request_schema and response_schema metadata as payloads. Wildcard tokens
+// in subjects become channel parameters.
+func AsyncAPI(info micro.Info) *AsyncAPIDocument {
+	doc := &AsyncAPIDocument{
+		AsyncAPI: AsyncAPIVersion,
+		Info: AsyncAPIInfo{
+			Title:       info.Name,
+			Version:     info.Version,
+			Description: info.Description,
+		},
+		DefaultContentType: "application/json",
+		Channels:           make(map[string]AsyncAPIChannel),
+		Operations:         make(map[string]AsyncAPIOperation),
+		Components:         AsyncAPIComponents{Messages: make(map[string]AsyncAPIMessage)},
+	}
+
+	for _, v := range info.Endpoints {
+		request := v.Name + "Request"
+		response := v.Name + "Response"
+		replyChannel := v.Name + "Reply"
+
+		address, params := asyncAPIAddress(v.Subject)
+		doc.Channels[v.Name] = AsyncAPIChannel{
+			Address:    &address,
+			Messages:   map[string]AsyncAPIRef{"request": {Ref: "#/components/messages/" + request}},
+			Parameters: params,
+		}
+		doc.Channels[replyChannel] = AsyncAPIChannel{
+			Messages: map[string]AsyncAPIRef{"response": {Ref: "#/components/messages/" + response}},
+		}
+
+		doc.Components.Messages[request] = AsyncAPIMessage{Name: request, Payload: schemaPayload(v.Metadata[RequestSchemaKey])}
+		doc.Components.Messages[response] = AsyncAPIMessage{Name: response, Payload: schemaPayload(v.Metadata[ResponseSchemaKey])}
+
+		doc.Operations[v.Name] = AsyncAPIOperation{
+			Action:   "receive",
+			Channel:  AsyncAPIRef{Ref: "#/channels/" + v.Name},
+			Summary:  v.Metadata["description"],
+			Messages: []AsyncAPIRef{{Ref: fmt.Sprintf("#/channels/%s/messages/request", v.Name)}},
+			Reply: &AsyncAPIReply{
+				Channel:  AsyncAPIRef{Ref: "#/channels/" + replyChannel},
+				Messages: []AsyncAPIRef{{Ref: fmt.Sprintf("#/channels/%s/messages/response", replyChannel)}},
+			},
+		}
+	}
+
+	return doc
+}
+
+// asyncAPIAddress replaces wildcard tokens with parameters. The fourth token is the request ID used by
+// SubjectToRequestID.
+func asyncAPIAddress(subject string) (string, map[string]AsyncAPIParameter) {
+	tokens := strings.Split(subject, ".")
+	params := make(map[string]AsyncAPIParameter)
+
+	for i, v := range tokens {
+		var name string
+		switch {
+		case v == "*" && i == 3:
+			name = "requestId"
+			params[name] = AsyncAPIParameter{Description: "KSUID request ID"}
+		case v == "*":
+			name = fmt.Sprintf("token%d", i)
+			params[name] = AsyncAPIParameter{}
+		case v == ">":
+			name = "rest"
+			params[name] = AsyncAPIParameter{Description: "One or more tokens"}
+		default:
+			continue
+		}
+		tokens[i] = "{" + name + "}"
+	}
+
+	if len(params) == 0 {
+		params = nil
+	}
+
+	return strings.Join(tokens, "."), params
+}
+
+// schemaPayload returns the schema metadata when it is valid JSON
+func schemaPayload(schema string) json.RawMessage {
+	if schema == "" || !json.Valid([]byte(schema)) {
+		return nil
+	}
+
+	return json.RawMessage(schema)
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/nats-io/nats.go/micro"
+)
+
+func TestAsyncAPI(t *testing.T) {
+	info := micro.Info{
+		ServiceIdentity: micro.ServiceIdentity{Name: "example", Version: "1.0.0"},
+		Description:     "Example service",
+		Endpoints: []micro.EndpointInfo{
+			{
+				Name:    "add",
+				Subject: "prime.services.example.*.math.add.get",
+				Metadata: map[string]string{
+					RequestSchemaKey:  `{"type":"object","properties":{"a":{"type":"integer"}}}`,
+					ResponseSchemaKey: `{"type":"object"}`,
+				},
+			},
+			{
+				Name:     "specific",
+				Subject:  "prime.example.specific",
+				Metadata: map[string]string{RequestSchemaKey: "not json"},
+			},
+		},
+	}
+
+	doc := AsyncAPI(info)
+
+	tt := []struct {
+		name     string
+		channel  string
+		address  string
+		params   int
+		request  bool
+		response bool
+	}{
+		{name: "wildcard subject", channel: "add", address: "prime.services.example.{requestId}.math.add.get", params: 1, request: true, response: true},
+		{name: "invalid schema", channel: "specific", address: "prime.example.specific"},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			ch, ok := doc.Channels[v.channel]
+			if !ok {
+				t.Fatalf("missing channel %s", v.channel)
+			}
+			if *ch.Address != v.address {
+				t.Errorf("expected address %s but got %s", v.address, *ch.Address)
+			}
+			if len(ch.Parameters) != v.params {
+				t.Errorf("expected %d params but got %d", v.params, len(ch.Parameters))
+			}
+
+			if reply := doc.Channels[v.channel+"Reply"]; reply.Address != nil {
+				t.Errorf("expected reply channel without an address")
+			}
+
+			op := doc.Operations[v.channel]
+			if op.Action != "receive" || op.Reply == nil {
+				t.Errorf("unexpected operation %+v", op)
+			}
+
+			if (doc.Components.Messages[v.channel+"Request"].Payload != nil) != v.request {
+				t.Errorf("expected request payload %t", v.request)
+			}
+			if (doc.Components.Messages[v.channel+"Response"].Payload != nil) != v.response {
+				t.Errorf("expected response payload %t", v.response)
+			}
+		})
+	}
+
+	if _, err := json.Marshal(doc); err != nil {
+		t.Errorf("error encoding document: %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CoverWhale/coverwhale-go/auth"
+	cwerrors "github.com/CoverWhale/coverwhale-go/errors"
+	"github.com/CoverWhale/coverwhale-go/opa"
+	"github.com/CoverWhale/logr"
+	"github.com/nats-io/nats.go/micro"
+)
+
+// DefaultDecisionTimeout is how long AuthzHandler waits for a decision from OPA
+const DefaultDecisionTimeout = 5 * time.Second
+
+var (
+	ErrUnauthorized = fmt.Errorf("unauthorized")
+	ErrForbidden    = fmt.Errorf("forbidden")
+)
+
+// AuthzInput is the input document AuthzHandler sends to OPA. Header names are canonicalized the same way as
+// the HTTP Authz middleware, so policies can be shared between transports.
+type AuthzInput struct {
+	Principal any               `json:"principal,omitempty"`
+	Subject   string            `json:"subject"`
+	Headers   map[string]string `json:"headers,omitempty"`
+}
+
+// PrincipalFunc returns the authenticated principal for the request and false if the request is anonymous. The
+// default is the auth.Principal of a request authenticated by auth.NATSHandler.
+type PrincipalFunc func(micro.Request) (any, bool)
+
+// AuthzOption is a functional option to modify AuthzHandler
+type AuthzOption func(*authorizer)
+
+type authorizer struct {
+	client    *opa.Client
+	pkg       string
+	principal PrincipalFunc
+	headers   []string
+	public    []string
+	timeout   time.Duration
+}
+
+// WithPrincipal sets how the authenticated principal is found for a request
+func WithPrincipal(p PrincipalFunc) AuthzOption {
+	return func(a *authorizer) {
+		a.principal = p
+	}
+}
+
+// WithHeaders adds the named request headers to the OPA input
+func WithHeaders(headers ...string) AuthzOption {
+	return func(a *authorizer) {
+		a.headers = append(a.headers, headers...)
+	}
+}
+
+// WithDecisionTimeout sets how long to wait for a decision from OPA
+func WithDecisionTimeout(d time.Duration) AuthzOption {
+	return func(a *authorizer) {
+		a.timeout = d
+	}
+}
+
+// WithPublicSubjects skips OPA for requests on matching subjects. Subjects can use the * and > wildcards.
+func WithPublicSubjects(subjects ...string) AuthzOption {
+	return func(a *authorizer) {
+		a.public = append(a.public, subjects...)
+	}
+}
+
+// AuthzHandler is the micro equivalent of the HTTP Authz middleware. It authorizes requests with the OPA package
+// using the principal, subject, and selected headers before calling the handler. Denied requests return a
+// 401 client error if anonymous and a 403 client error if authenticated.
+func AuthzHandler(client *opa.Client, pkg string, h HandlerWithErrors, opts ...AuthzOption) HandlerWithErrors {
+	a := &authorizer{
+		client: client,
+		pkg:    pkg,
+		principal: func(r micro.Request) (any, bool) {
+			return auth.NATSPrincipal(r)
+		},
+		timeout: DefaultDecisionTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return func(logger *logr.Logger, r micro.Request) error {
+		for _, v := range a.public {
+			if auth.SubjectMatches(v, r.Subject()) {
+				return h(logger, r)
+			}
+		}
+
+		principal, authenticated := a.principal(r)
+		input := AuthzInput{
+			Principal: principal,
+			Subject:   r.Subject(),
+		}
+
+		for _, v := range a.headers {
+			if val := headerValue(r.Headers(), v); val != "" {
+				if input.Headers == nil {
+					input.Headers = make(map[string]string)
+				}
+				input.Headers[http.CanonicalHeaderKey(v)] = val
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(HeaderContext(context.Background(), r.Headers()), a.timeout)
+		defer cancel()
+
+		var result opa.Result
+		data, err := a.client.Decide(ctx, a.pkg, input)
+		switch {
+		case errors.Is(err, opa.ErrUndefined):
+			// an undefined decision is never an allow
+		case err != nil:
+			return fmt.Errorf("error querying OPA: %w", err)
+		default:
+			if err := json.Unmarshal(data, &result); err != nil {
+				return fmt.Errorf("error decoding response from OPA: %w", err)
+			}
+		}
+
+		if result.IsAllowed() {
+			return h(logger, r)
+		}
+
+		if !authenticated {
+			return cwerrors.NewClientError(ErrUnauthorized, http.StatusUnauthorized, cwerrors.WithAdditionalParams(denials(result)))
+		}
+
+		return cwerrors.NewClientError(ErrForbidden, http.StatusForbidden, cwerrors.WithAdditionalParams(denials(result)))
+	}
+}
+
+// headerValue returns the first value of a header regardless of case, since NATS header names are case-sensitive
+func headerValue(h micro.Headers, name string) string {
+	if val := h.Get(name); val != "" {
+		return val
+	}
+
+	for k, v := range h {
+		if strings.EqualFold(k, name) && len(v) > 0 {
+			return v[0]
+		}
+	}
+
+	return ""
+}
+
+func denials(r opa.Result) map[string]any {
+	if len(r.Deny) == 0 {
+		return nil
+	}
+
+	return map[string]any{"deny": r.Deny}
+}
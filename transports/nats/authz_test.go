@@ -0,0 +1,95 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	cwerrors "github.com/CoverWhale/coverwhale-go/errors"
+	"github.com/CoverWhale/coverwhale-go/opa"
+	"github.com/CoverWhale/logr"
+	"github.com/nats-io/nats.go/micro"
+)
+
+type testRequest struct {
+	micro.Request
+	subject string
+	headers micro.Headers
+}
+
+func (t testRequest) Subject() string {
+	return t.subject
+}
+
+func (t testRequest) Headers() micro.Headers {
+	return t.headers
+}
+
+func TestAuthzHandler(t *testing.T) {
+	client := opa.NewClient(opa.SetEvaluator(opa.Policies{
+		"cw/authz": func(ctx context.Context, data json.RawMessage) (any, error) {
+			if _, ok := ctx.Deadline(); !ok {
+				return nil, errors.New("expected a decision deadline")
+			}
+
+			var input AuthzInput
+			if err := json.Unmarshal(data, &input); err != nil {
+				return nil, err
+			}
+
+			return opa.Result{Allow: input.Headers["X-Tenant"] == "acme"}, nil
+		},
+	}))
+
+	tt := []struct {
+		name    string
+		subject string
+		headers micro.Headers
+		status  int
+	}{
+		{name: "canonical header", subject: "products.get", headers: micro.Headers{"X-Tenant": {"acme"}}},
+		{name: "lower case header", subject: "products.get", headers: micro.Headers{"x-tenant": {"acme"}}},
+		{name: "denied", subject: "products.get", headers: micro.Headers{"X-Tenant": {"other"}}, status: http.StatusUnauthorized},
+		{name: "public", subject: "products.health", headers: micro.Headers{}},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			ok := func(l *logr.Logger, r micro.Request) error { return nil }
+			h := AuthzHandler(client, "cw/authz", ok,
+				WithHeaders("x-tenant"),
+				WithPublicSubjects("products.health"),
+				WithPrincipal(func(r micro.Request) (any, bool) { return nil, false }),
+			)
+
+			err := h(logr.NewLogger(), testRequest{subject: v.subject, headers: v.headers})
+			if v.status == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			var ce cwerrors.ClientError
+			if !errors.As(err, &ce) || ce.Status != v.status {
+				t.Fatalf("expected %d client error but got %v", v.status, err)
+			}
+		})
+	}
+}
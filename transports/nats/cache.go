@@ -0,0 +1,78 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// queryCache is an LRU cache of parsed queries and persisted query strings
+type queryCache struct {
+	mu    sync.Mutex
+	size  int
+	items map[string]*list.Element
+	order *list.List
+}
+
+type queryCacheEntry struct {
+	key   string
+	value any
+}
+
+// NewQueryCache returns an in memory LRU cache for the executor's parsed queries or for automatic persisted
+// queries
+func NewQueryCache(size int) graphql.Cache {
+	return &queryCache{
+		size:  size,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+func (q *queryCache) Get(ctx context.Context, key string) (any, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	elem, ok := q.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	q.order.MoveToFront(elem)
+	return elem.Value.(*queryCacheEntry).value, true
+}
+
+func (q *queryCache) Add(ctx context.Context, key string, value any) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if elem, ok := q.items[key]; ok {
+		elem.Value.(*queryCacheEntry).value = value
+		q.order.MoveToFront(elem)
+		return
+	}
+
+	q.items[key] = q.order.PushFront(&queryCacheEntry{key: key, value: value})
+
+	if q.order.Len() > q.size {
+		oldest := q.order.Back()
+		q.order.Remove(oldest)
+		delete(q.items, oldest.Value.(*queryCacheEntry).key)
+	}
+}
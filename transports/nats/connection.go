@@ -0,0 +1,398 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/CoverWhale/coverwhale-go/config"
+	"github.com/CoverWhale/coverwhale-go/metrics"
+	"github.com/CoverWhale/logr"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultConnectTimeout is how long Connect waits for the first connection
+const DefaultConnectTimeout = 10 * time.Second
+
+var ErrConnectTimeout = fmt.Errorf("timed out waiting for NATS connection")
+
+// ConnectionStatus is a change in the state of the NATS connection
+type ConnectionStatus string
+
+const (
+	StatusConnected    ConnectionStatus = "connected"
+	StatusDisconnected ConnectionStatus = "disconnected"
+	StatusReconnected  ConnectionStatus = "reconnected"
+	StatusClosed       ConnectionStatus = "closed"
+	StatusError        ConnectionStatus = "error"
+)
+
+// ConnectionEvent is passed to the handler set with SetConnectionHandler
+type ConnectionEvent struct {
+	Status ConnectionStatus
+	// URL is the server the client is connected to with credentials redacted
+	URL string
+	Err error
+}
+
+// ConnectionConfig holds the NATS connection settings. The JSON names match the #Nats definition in the
+// generated CUE config schema so the nats section can be decoded into it with config.Unmarshal, and the
+// generated config.NATS type converts to it.
+type ConnectionConfig struct {
+	// URLs is a comma separated list of NATS servers
+	URLs            string `json:"urls"`
+	Name            string `json:"name,omitempty"`
+	CredentialsFile string `json:"credentials_file,omitempty"`
+	// NKeyFile is the path to an NKey seed file
+	NKeyFile string        `json:"nkey_file,omitempty"`
+	JWT      config.Secret `json:"jwt,omitempty"`
+	Seed     config.Secret `json:"seed,omitempty"`
+	// TLSCertFile and TLSKeyFile are a client certificate for mTLS. TLSCAFile verifies the server.
+	TLSCertFile string `json:"tls_cert_file,omitempty"`
+	TLSKeyFile  string `json:"tls_key_file,omitempty"`
+	TLSCAFile   string `json:"tls_ca_file,omitempty"`
+	InboxPrefix string `json:"inbox_prefix,omitempty"`
+	// ConnectTimeout is how many seconds Connect waits for the first connection
+	ConnectTimeout int `json:"connect_timeout,omitempty"`
+	// ReconnectWait is how many seconds to wait between reconnect attempts
+	ReconnectWait int `json:"reconnect_wait,omitempty"`
+	// MaxReconnects is the number of reconnect attempts. -1 reconnects forever and 0 uses the nats.go default.
+	MaxReconnects int `json:"max_reconnects,omitempty"`
+}
+
+// the connection metrics are shared by every client and labeled by connection name
+var (
+	connectionEvents = metrics.NewCounterVec("nats_connection_events_total", "NATS connection status changes", []string{"name", "status"})
+	connectionUp     = metrics.NewGaugeVec("nats_connected", "Whether the NATS connection is connected", []string{"name"})
+)
+
+// ConnectionMetrics returns the connection metrics so they can be registered manually when SetExporter isn't
+// used. They are shared by every client so only register them once.
+func ConnectionMetrics() []prometheus.Collector {
+	return []prometheus.Collector{connectionEvents, connectionUp}
+}
+
+// SetConnectionConfig applies the settings from the config
+func SetConnectionConfig(c ConnectionConfig) ClientOpt {
+	return func(n *NATSClient) {
+		var opts []ClientOpt
+
+		if c.URLs != "" {
+			opts = append(opts, SetServers(c.URLs))
+		}
+		if c.Name != "" {
+			opts = append(opts, SetName(c.Name))
+		}
+		if c.CredentialsFile != "" {
+			opts = append(opts, SetCredentials(c.CredentialsFile))
+		}
+		if c.NKeyFile != "" {
+			opts = append(opts, SetNKey(c.NKeyFile))
+		}
+		if c.JWT != "" {
+			opts = append(opts, SetJWT(c.JWT.Value(), c.Seed.Value()))
+		}
+		if c.TLSCertFile != "" || c.TLSCAFile != "" {
+			opts = append(opts, SetTLS(c.TLSCertFile, c.TLSKeyFile, c.TLSCAFile))
+		}
+		if c.InboxPrefix != "" {
+			opts = append(opts, SetInboxPrefix(c.InboxPrefix))
+		}
+		if c.ConnectTimeout > 0 {
+			opts = append(opts, SetConnectTimeout(time.Duration(c.ConnectTimeout)*time.Second))
+		}
+		if c.ReconnectWait > 0 {
+			opts = append(opts, SetReconnectWait(time.Duration(c.ReconnectWait)*time.Second))
+		}
+		if c.MaxReconnects != 0 {
+			opts = append(opts, SetMaxReconnects(c.MaxReconnects))
+		}
+
+		for _, v := range opts {
+			v(n)
+		}
+	}
+}
+
+// SetName sets the connection name shown in server monitoring and used as the metrics label
+func SetName(name string) ClientOpt {
+	return func(n *NATSClient) {
+		n.connOpts = append(n.connOpts, nats.Name(name))
+	}
+}
+
+// SetCredentials authenticates with a user credentials file
+func SetCredentials(file string) ClientOpt {
+	return func(n *NATSClient) {
+		n.connOpts = append(n.connOpts, nats.UserCredentials(file))
+	}
+}
+
+// SetNKey authenticates with an NKey seed file. Errors reading the file are returned by Connect.
+func SetNKey(seedFile string) ClientOpt {
+	return func(n *NATSClient) {
+		opt, err := nats.NkeyOptionFromSeed(seedFile)
+		if err != nil {
+			n.optErr = fmt.Errorf("error reading nkey seed: %w", err)
+			return
+		}
+		n.connOpts = append(n.connOpts, opt)
+	}
+}
+
+// SetJWT authenticates with a user JWT and NKey seed
+func SetJWT(jwt, seed string) ClientOpt {
+	return func(n *NATSClient) {
+		n.connOpts = append(n.connOpts, nats.UserJWTAndSeed(jwt, seed))
+	}
+}
+
+// SetTLS sets a client certificate and a CA to verify the server. Either can be empty.
+func SetTLS(certFile, keyFile, caFile string) ClientOpt {
+	return func(n *NATSClient) {
+		if certFile != "" {
+			n.connOpts = append(n.connOpts, nats.ClientCert(certFile, keyFile))
+		}
+		if caFile != "" {
+			n.connOpts = append(n.connOpts, nats.RootCAs(caFile))
+		}
+	}
+}
+
+// SetInboxPrefix sets the prefix of reply subjects, for accounts that only allow replies under a prefix
+func SetInboxPrefix(prefix string) ClientOpt {
+	return func(n *NATSClient) {
+		n.connOpts = append(n.connOpts, nats.CustomInboxPrefix(prefix))
+	}
+}
+
+// SetConnectTimeout sets how long Connect waits for the first connection
+func SetConnectTimeout(d time.Duration) ClientOpt {
+	return func(n *NATSClient) {
+		n.connectTimeout = d
+	}
+}
+
+// SetReconnectWait sets how long to wait between reconnect attempts
+func SetReconnectWait(d time.Duration) ClientOpt {
+	return func(n *NATSClient) {
+		n.connOpts = append(n.connOpts, nats.ReconnectWait(d))
+	}
+}
+
+// SetMaxReconnects sets the number of reconnect attempts. -1 reconnects forever.
+func SetMaxReconnects(max int) ClientOpt {
+	return func(n *NATSClient) {
+		n.connOpts = append(n.connOpts, nats.MaxReconnects(max))
+	}
+}
+
+// SetExporter adds the connection metrics to the exporter so they are registered when the server starts.
+// Clients share the metrics, so several can use the same exporter.
+func SetExporter(e *metrics.Exporter) ClientOpt {
+	return func(n *NATSClient) {
+		e.Add(ConnectionMetrics()...)
+	}
+}
+
+// SetConnectionHandler is called whenever the connection status changes. The client sets the nats.go
+// connect, disconnect, reconnect, closed, and error handlers itself, so use this instead of passing them
+// with SetOptions.
+func SetConnectionHandler(f func(ConnectionEvent)) ClientOpt {
+	return func(n *NATSClient) {
+		n.connectionHandler = f
+	}
+}
+
+// Connect connects to NATS and waits for the first connection. The connection is retried until the connect
+// timeout, which defaults to 10 seconds, and the timeout error wraps the last connection error. Authorization
+// errors fail without waiting for the timeout.
+func (n *NATSClient) Connect() error {
+	if n.optErr != nil {
+		return n.optErr
+	}
+
+	timeout := n.connectTimeout
+	if timeout == 0 {
+		timeout = DefaultConnectTimeout
+	}
+
+	connected := make(chan struct{})
+	closed := make(chan struct{})
+	var connectOnce, closeOnce sync.Once
+	markConnected := func() {
+		connectOnce.Do(func() { close(connected) })
+	}
+
+	opts := append(append([]nats.Option{}, n.Options...), n.connOpts...)
+	opts = append(opts,
+		nats.RetryOnFailedConnect(true),
+		nats.ConnectHandler(func(nc *nats.Conn) {
+			n.connectionEvent(nc, StatusConnected, nil)
+			markConnected()
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			n.connectionEvent(nc, StatusReconnected, nil)
+			markConnected()
+		}),
+		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+			n.connectionEvent(nc, StatusDisconnected, err)
+		}),
+		nats.ClosedHandler(func(nc *nats.Conn) {
+			n.connectionEvent(nc, StatusClosed, nil)
+			closeOnce.Do(func() { close(closed) })
+		}),
+		nats.ErrorHandler(func(nc *nats.Conn, sub *nats.Subscription, err error) {
+			if sub != nil {
+				err = fmt.Errorf("subscription %s: %w", sub.Subject, err)
+			}
+			n.connectionEvent(nc, StatusError, err)
+		}),
+	)
+
+	nc, err := nats.Connect(n.Servers, opts...)
+	if err != nil {
+		return err
+	}
+
+	if nc.IsConnected() {
+		markConnected()
+	}
+
+	if err := waitForConnection(nc, connected, closed, timeout); err != nil {
+		nc.Close()
+		return fmt.Errorf("error connecting to %s: %w", n.Servers, err)
+	}
+
+	n.Conn = nc
+	js, err := nc.JetStream()
+	if err != nil {
+		return err
+	}
+
+	n.JS = js
+
+	return nil
+}
+
+// waitForConnection waits for the first connection. nats.go doesn't call the error handlers until the client
+// has connected, so the connection's last error is checked instead.
+func waitForConnection(nc *nats.Conn, connected, closed <-chan struct{}, timeout time.Duration) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	expired := time.After(timeout)
+
+	var lastErr error
+	for {
+		select {
+		case <-connected:
+			return nil
+		case <-closed:
+			if err := nc.LastError(); err != nil {
+				return err
+			}
+			return nats.ErrConnectionClosed
+		case <-ticker.C:
+			if err := nc.LastError(); err != nil {
+				lastErr = err
+			}
+			if isAuthError(lastErr) {
+				return lastErr
+			}
+		case <-expired:
+			if lastErr != nil {
+				return fmt.Errorf("%w after %s: %w", ErrConnectTimeout, timeout, lastErr)
+			}
+			return fmt.Errorf("%w after %s", ErrConnectTimeout, timeout)
+		}
+	}
+}
+
+// isAuthError reports whether the server rejected the credentials, which retrying won't fix
+func isAuthError(err error) bool {
+	for _, v := range []error{nats.ErrAuthorization, nats.ErrAuthExpired, nats.ErrAuthRevoked, nats.ErrAccountAuthExpired} {
+		if errors.Is(err, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Drain shuts down the resolver, drains every subscription on the connection, and waits for the connection
+// to close or for the context to be done
+func (n *NATSClient) Drain(ctx context.Context) error {
+	if n.Conn == nil {
+		return nil
+	}
+
+	if err := n.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	if err := n.Conn.Drain(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+		return err
+	}
+
+	return waitFor(ctx, n.Conn.IsClosed)
+}
+
+// connectionEvent logs the status change, records metrics, and calls the connection handler
+func (n *NATSClient) connectionEvent(nc *nats.Conn, status ConnectionStatus, err error) {
+	event := ConnectionEvent{
+		Status: status,
+		URL:    nc.ConnectedUrlRedacted(),
+		Err:    err,
+	}
+
+	if err != nil {
+		logr.Errorf("NATS connection %s: %v", status, err)
+	} else {
+		logr.Infof("NATS connection %s %s", status, event.URL)
+	}
+
+	connectionEvents.WithLabelValues(nc.Opts.Name, string(status)).Inc()
+	switch status {
+	case StatusConnected, StatusReconnected:
+		connectionUp.WithLabelValues(nc.Opts.Name).Set(1)
+	case StatusDisconnected, StatusClosed:
+		connectionUp.WithLabelValues(nc.Opts.Name).Set(0)
+	}
+
+	if n.connectionHandler != nil {
+		n.connectionHandler(event)
+	}
+}
+
+// waitFor polls until done returns true or the context is done
+func waitFor(ctx context.Context, done func() bool) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for !done() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
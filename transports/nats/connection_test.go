@@ -0,0 +1,190 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CoverWhale/coverwhale-go/metrics"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestConnect(t *testing.T) {
+	tt := []struct {
+		name string
+		opts []ClientOpt
+		err  string
+	}{
+		{
+			name: "timeout",
+			opts: []ClientOpt{SetConnectTimeout(100 * time.Millisecond)},
+			err:  ErrConnectTimeout.Error(),
+		},
+		{
+			name: "missing nkey",
+			opts: []ClientOpt{SetNKey("testdata/missing.nk")},
+			err:  "error reading nkey seed",
+		},
+		{
+			name: "config",
+			opts: []ClientOpt{SetConnectionConfig(ConnectionConfig{URLs: "nats://127.0.0.1:1", Name: "test", NKeyFile: "testdata/missing.nk"})},
+			err:  "error reading nkey seed",
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			n := NewNATSClient("prime.services.products.>", []string{"nats://127.0.0.1:1"}, v.opts...)
+
+			err := n.Connect()
+			if err == nil || !strings.Contains(err.Error(), v.err) {
+				t.Errorf("expected %s but got %v", v.err, err)
+			}
+		})
+	}
+}
+
+// authServer is a NATS server that rejects every connection as unauthorized
+func authServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte("INFO {\"server_id\":\"test\",\"version\":\"2.10.0\",\"max_payload\":1048576}\r\n"))
+
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if strings.HasPrefix(line, "PING") {
+						conn.Write([]byte("-ERR 'Authorization Violation'\r\n"))
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	return "nats://" + l.Addr().String()
+}
+
+func TestConnectAuthorization(t *testing.T) {
+	n := NewNATSClient("prime.services.products.>", []string{authServer(t)},
+		SetConnectTimeout(5*time.Second),
+		SetReconnectWait(10*time.Millisecond),
+	)
+
+	start := time.Now()
+	err := n.Connect()
+	if !errors.Is(err, nats.ErrAuthorization) {
+		t.Fatalf("expected %v but got %v", nats.ErrAuthorization, err)
+	}
+	if errors.Is(err, ErrConnectTimeout) || time.Since(start) > 2*time.Second {
+		t.Errorf("expected Connect to fail without waiting for the timeout but it took %s", time.Since(start))
+	}
+}
+
+func TestSetConnectionConfig(t *testing.T) {
+	n := NewNATSClient("prime.services.products.>", []string{"nats://localhost:4222"}, SetConnectionConfig(ConnectionConfig{
+		URLs:           "nats://nats-1:4222,nats://nats-2:4222",
+		Name:           "products",
+		JWT:            "jwt",
+		Seed:           "seed",
+		InboxPrefix:    "_INBOX.products",
+		ConnectTimeout: 5,
+		MaxReconnects:  -1,
+	}))
+
+	if n.Servers != "nats://nats-1:4222,nats://nats-2:4222" {
+		t.Errorf("expected servers from config but got %s", n.Servers)
+	}
+	if n.connectTimeout != 5*time.Second {
+		t.Errorf("expected connect timeout 5s but got %s", n.connectTimeout)
+	}
+
+	opts := nats.GetDefaultOptions()
+	for _, v := range n.connOpts {
+		if err := v(&opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if opts.Name != "products" || opts.InboxPrefix != "_INBOX.products" || opts.MaxReconnect != -1 || opts.UserJWT == nil {
+		t.Errorf("expected options from config but got name %s inbox %s max reconnects %d", opts.Name, opts.InboxPrefix, opts.MaxReconnect)
+	}
+}
+
+func TestConnectionHandler(t *testing.T) {
+	events := make(chan ConnectionEvent, 10)
+	n := NewNATSClient("prime.services.products.>", []string{"nats://127.0.0.1:1"},
+		SetConnectTimeout(100*time.Millisecond),
+		SetConnectionHandler(func(e ConnectionEvent) {
+			events <- e
+		}),
+	)
+
+	if err := n.Connect(); !errors.Is(err, ErrConnectTimeout) {
+		t.Fatalf("expected %v but got %v", ErrConnectTimeout, err)
+	}
+
+	// the closed handler runs asynchronously after the connection is closed
+	select {
+	case e := <-events:
+		if e.Status != StatusClosed {
+			t.Errorf("expected a closed event but got %s", e.Status)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected a closed event")
+	}
+}
+
+func TestSetExporter(t *testing.T) {
+	exporter := metrics.NewExporter()
+	for i := 0; i < 2; i++ {
+		n := NewNATSClient("prime.services.products.>", []string{"nats://127.0.0.1:1"}, SetExporter(exporter), SetConnectTimeout(10*time.Millisecond))
+		if err := n.Connect(); !errors.Is(err, ErrConnectTimeout) {
+			t.Fatalf("expected %v but got %v", ErrConnectTimeout, err)
+		}
+	}
+
+	registry := prometheus.NewRegistry()
+	for _, v := range exporter.Metrics {
+		if err := registry.Register(v); err != nil {
+			t.Errorf("expected clients to share metrics but got %v", err)
+		}
+	}
+	if len(exporter.Metrics) != len(ConnectionMetrics()) {
+		t.Errorf("expected %d metrics but got %d", len(ConnectionMetrics()), len(exporter.Metrics))
+	}
+}
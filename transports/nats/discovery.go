@@ -0,0 +1,125 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+)
+
+const (
+	// RequestSchemaKey and ResponseSchemaKey are the endpoint metadata keys for the JSON schemas of an endpoint
+	RequestSchemaKey  = "request_schema"
+	ResponseSchemaKey = "response_schema"
+
+	DefaultDiscoveryTimeout = 2 * time.Second
+)
+
+// PingResult is a ping response from a service instance and the round trip time
+type PingResult struct {
+	micro.Ping
+	RTT time.Duration `json:"rtt"`
+}
+
+// DiscoverServices returns the info of every running instance of the service. All services are returned when
+// name is empty. Responses are collected until the timeout.
+func DiscoverServices(nc *nats.Conn, name string, timeout time.Duration) ([]micro.Info, error) {
+	var infos []micro.Info
+	err := discover(nc, micro.InfoVerb, name, timeout, func(data []byte, _ time.Duration) error {
+		var info micro.Info
+		if err := json.Unmarshal(data, &info); err != nil {
+			return err
+		}
+		infos = append(infos, info)
+		return nil
+	})
+
+	return infos, err
+}
+
+// ServiceStats returns the stats of every running instance of the service
+func ServiceStats(nc *nats.Conn, name string, timeout time.Duration) ([]micro.Stats, error) {
+	var stats []micro.Stats
+	err := discover(nc, micro.StatsVerb, name, timeout, func(data []byte, _ time.Duration) error {
+		var s micro.Stats
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		stats = append(stats, s)
+		return nil
+	})
+
+	return stats, err
+}
+
+// PingServices pings every running instance of the service
+func PingServices(nc *nats.Conn, name string, timeout time.Duration) ([]PingResult, error) {
+	var pings []PingResult
+	err := discover(nc, micro.PingVerb, name, timeout, func(data []byte, rtt time.Duration) error {
+		var p micro.Ping
+		if err := json.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		pings = append(pings, PingResult{Ping: p, RTT: rtt})
+		return nil
+	})
+
+	return pings, err
+}
+
+// discover sends a request on the control subject for the verb and passes each response to fn
+func discover(nc *nats.Conn, verb micro.Verb, name string, timeout time.Duration, fn func([]byte, time.Duration) error) error {
+	subject, err := micro.ControlSubject(verb, name, "")
+	if err != nil {
+		return err
+	}
+
+	inbox := nc.NewInbox()
+	sub, err := nc.SubscribeSync(inbox)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	start := time.Now()
+	if err := nc.PublishRequest(subject, inbox, nil); err != nil {
+		return err
+	}
+
+	deadline := start.Add(timeout)
+	for {
+		msg, err := sub.NextMsg(time.Until(deadline))
+		if errors.Is(err, nats.ErrTimeout) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// the server replies with a 503 status when nothing is subscribed to the subject
+		if msg.Header.Get("Status") == "503" {
+			return nil
+		}
+
+		if err := fn(msg.Data, time.Since(start)); err != nil {
+			return fmt.Errorf("error decoding response from %s: %w", subject, err)
+		}
+	}
+}
@@ -111,7 +111,18 @@ func handleRequestError(logger *logr.Logger, err error, r micro.Request) {
 	ce, ok := err.(ClientError)
 	if ok {
 		logger.Error(ce.LoggedError())
-		r.Error(fmt.Sprintf("%d", ce.Code()), http.StatusText(ce.Code()), ce.Body())
+
+		var opts []micro.RespondOpt
+		if h, ok := ce.(interface{ ResponseHeaders() map[string]string }); ok && len(h.ResponseHeaders()) > 0 {
+			headers := micro.Headers{}
+			for k, v := range h.ResponseHeaders() {
+				headers[k] = []string{v}
+			}
+			opts = append(opts, micro.WithHeaders(headers))
+		}
+
+		r.Error(fmt.Sprintf("%d", ce.Code()), http.StatusText(ce.Code()), ce.Body(), opts...)
+		return
 	}
 
 	logger.Error(err.Error())
@@ -135,6 +146,60 @@ func SubjectToRequestID(s string) (string, error) {
 	return id, nil
 }
 
+// RequestSubject fills in the wildcards of an endpoint subject such as prime.services.example.*.math.add.get.
+// Services use <env>.services.<name>.* as the group subject, so the wildcard after the service name is the request
+// ID and gets a new KSUID. The other wildcards are filled with tokens in order. A trailing > uses all remaining
+// tokens.
+func RequestSubject(pattern string, tokens ...string) (string, error) {
+	return requestSubject(pattern, ksuid.New().String(), tokens...)
+}
+
+// RequestSubjectWithID is like RequestSubject but fills the request ID wildcard with id, so the same ID can be
+// sent in the X-Request-ID header
+func RequestSubjectWithID(pattern, id string, tokens ...string) (string, error) {
+	return requestSubject(pattern, id, tokens...)
+}
+
+func requestSubject(pattern, id string, tokens ...string) (string, error) {
+	split := strings.Split(pattern, ".")
+	idIndex := requestIDIndex(split)
+
+	for i, v := range split {
+		switch {
+		case v == "*" && i == idIndex:
+			split[i] = id
+		case v == "*":
+			if len(tokens) == 0 {
+				return "", fmt.Errorf("missing token for wildcard %d in %s", i, pattern)
+			}
+			split[i], tokens = tokens[0], tokens[1:]
+		case v == ">":
+			if len(tokens) == 0 {
+				return "", fmt.Errorf("missing tokens for > in %s", pattern)
+			}
+			split[i], tokens = strings.Join(tokens, "."), nil
+		}
+	}
+
+	if len(tokens) > 0 {
+		return "", fmt.Errorf("too many tokens for %s", pattern)
+	}
+
+	return strings.Join(split, "."), nil
+}
+
+// requestIDIndex returns the position of the request ID wildcard, which follows the service name, or -1 if the
+// subject doesn't have one
+func requestIDIndex(split []string) int {
+	for i, v := range split {
+		if v == "services" && i+2 < len(split) && split[i+2] == "*" {
+			return i + 2
+		}
+	}
+
+	return -1
+}
+
 func RequestLogger(l *logr.Logger, subject string) (*logr.Logger, error) {
 	id, err := SubjectToRequestID(subject)
 	if err != nil {
@@ -0,0 +1,84 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/segmentio/ksuid"
+)
+
+func TestRequestSubject(t *testing.T) {
+	tt := []struct {
+		name     string
+		pattern  string
+		tokens   []string
+		expected string
+		err      bool
+	}{
+		{name: "request id", pattern: "prime.services.example.*.math.add.get", expected: "prime.services.example.{id}.math.add.get"},
+		{name: "no wildcards", pattern: "prime.example.specific", expected: "prime.example.specific"},
+		{name: "tokens", pattern: "prime.services.example.*.*.>", tokens: []string{"add", "a", "b"}, expected: "prime.services.example.{id}.add.a.b"},
+		{name: "tokens before the request id", pattern: "*.prime.services.example.*.math", tokens: []string{"us"}, expected: "us.prime.services.example.{id}.math"},
+		{name: "no request id", pattern: "prime.*.example.*", tokens: []string{"us", "add"}, expected: "prime.us.example.add"},
+		{name: "missing token", pattern: "prime.*.example", err: true},
+		{name: "extra token", pattern: "prime.example", tokens: []string{"a"}, err: true},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			subject, err := RequestSubject(v.pattern, v.tokens...)
+			if (err != nil) != v.err {
+				t.Fatalf("expected error %t but got %v", v.err, err)
+			}
+			if v.err {
+				return
+			}
+
+			expected := strings.Split(v.expected, ".")
+			for i, token := range expected {
+				if token != "{id}" {
+					continue
+				}
+				split := strings.Split(subject, ".")
+				if len(split) != len(expected) {
+					t.Fatalf("expected %s but got %s", v.expected, subject)
+				}
+				if _, err := ksuid.Parse(split[i]); err != nil {
+					t.Fatalf("expected a request ID in %s: %v", subject, err)
+				}
+				expected[i] = split[i]
+			}
+
+			if subject != strings.Join(expected, ".") {
+				t.Errorf("expected %s but got %s", v.expected, subject)
+			}
+		})
+	}
+}
+
+func TestRequestSubjectWithID(t *testing.T) {
+	id := ksuid.New().String()
+
+	subject, err := RequestSubjectWithID("prime.services.example.*.math.*", id, "add")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "prime.services.example." + id + ".math.add"; subject != expected {
+		t.Errorf("expected %s but got %s", expected, subject)
+	}
+}
@@ -17,18 +17,30 @@ package nats
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/99designs/gqlgen/graphql"
 	"github.com/99designs/gqlgen/graphql/executor"
+	"github.com/99designs/gqlgen/graphql/handler/apollotracing"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
 	"github.com/CoverWhale/logr"
 	"github.com/nats-io/nats.go"
+	"github.com/vektah/gqlparser/v2/ast"
 	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
+const (
+	// DefaultQueueGroup is the queue group resolvers subscribe with so requests are spread across instances
+	DefaultQueueGroup = "graphql"
+	// TimeoutHeader is a duration, such as 5s, that bounds how long the resolver works on a request
+	TimeoutHeader = "X-Timeout"
+)
+
 type NATSClient struct {
 	Subject string
 	Servers string
@@ -36,11 +48,30 @@ type NATSClient struct {
 	Conn    *nats.Conn
 	JS      nats.JetStreamContext
 	NATSGraph
+
+	connOpts          []nats.Option
+	optErr            error
+	connectTimeout    time.Duration
+	connectionHandler func(ConnectionEvent)
+
+	sub      *nats.Subscription
+	inflight sync.WaitGroup
+	stopOnce sync.Once
+	stopCtx  context.Context
+	stop     context.CancelFunc
 }
 
 type NATSGraph struct {
 	ExecutableSchema graphql.ExecutableSchema
 	Exec             *executor.Executor
+
+	queueGroup string
+	extensions []graphql.HandlerExtension
+
+	// subscriptionStream is the subject prefix for subscription events published with JetStream
+	subscriptionStream string
+	// subscriptionIdle ends subscriptions when the client hasn't sent a keepalive for this long
+	subscriptionIdle time.Duration
 }
 
 type ClientOpt func(*NATSClient)
@@ -49,6 +80,9 @@ func NewNATSClient(subject string, servers []string, opts ...ClientOpt) *NATSCli
 	n := NATSClient{
 		Subject: subject,
 		Servers: strings.Join(servers, ","),
+		NATSGraph: NATSGraph{
+			queueGroup: DefaultQueueGroup,
+		},
 	}
 
 	for _, v := range opts {
@@ -77,59 +111,163 @@ func SetSubject(s string) ClientOpt {
 }
 
 func SetGraphQLExecutableSchema(e graphql.ExecutableSchema) ClientOpt {
-	ng := NATSGraph{
-		ExecutableSchema: e,
-		Exec:             executor.New(e),
+	return func(n *NATSClient) {
+		n.NATSGraph.ExecutableSchema = e
+		n.NATSGraph.Exec = executor.New(e)
+		n.NATSGraph.Exec.SetQueryCache(NewQueryCache(1000))
+		for _, v := range n.NATSGraph.extensions {
+			n.NATSGraph.Exec.Use(v)
+		}
 	}
+}
+
+// SetQueueGroup sets the queue group the resolver subscribes with. An empty group makes every instance
+// handle every request.
+func SetQueueGroup(q string) ClientOpt {
 	return func(n *NATSClient) {
-		n.NATSGraph = ng
+		n.NATSGraph.queueGroup = q
 	}
 }
 
-func (n *NATSClient) Connect() error {
-	nc, err := nats.Connect(n.Servers, n.Options...)
-	if err != nil {
-		return err
+// SetGraphQLExtensions adds gqlgen extensions, such as extension.Introspection{}, to the executor
+func SetGraphQLExtensions(exts ...graphql.HandlerExtension) ClientOpt {
+	return func(n *NATSClient) {
+		n.NATSGraph.extensions = append(n.NATSGraph.extensions, exts...)
+		if n.NATSGraph.Exec != nil {
+			for _, v := range exts {
+				n.NATSGraph.Exec.Use(v)
+			}
+		}
 	}
+}
 
-	n.Conn = nc
-	js, err := nc.JetStream()
-	if err != nil {
-		return err
+// SetComplexityLimit rejects operations with a complexity over the limit
+func SetComplexityLimit(limit int) ClientOpt {
+	return SetGraphQLExtensions(extension.FixedComplexityLimit(limit))
+}
+
+// SetAutomaticPersistedQueries lets clients send a query hash instead of the full query. A nil cache uses an
+// in memory cache of 100 queries.
+func SetAutomaticPersistedQueries(cache graphql.Cache) ClientOpt {
+	if cache == nil {
+		cache = NewQueryCache(100)
 	}
 
-	n.JS = js
+	return SetGraphQLExtensions(extension.AutomaticPersistedQuery{Cache: cache})
+}
 
-	return nil
+// SetTracing adds Apollo tracing timings to the response extensions
+func SetTracing() ClientOpt {
+	return SetGraphQLExtensions(apollotracing.Tracer{})
 }
 
 func (n *NATSClient) Resolve(errChan chan<- error) {
 	if n.NATSGraph.ExecutableSchema == nil || n.NATSGraph.Exec == nil {
 		errChan <- fmt.Errorf("executable schema must be set")
+		return
+	}
+
+	if err := n.resolve(); err != nil {
+		errChan <- err
+	}
+}
+
+// Shutdown stops receiving requests, ends active subscriptions, and waits for in-flight requests to finish
+// or for the context to be done. The connection stays open.
+func (n *NATSClient) Shutdown(ctx context.Context) error {
+	if n.sub != nil {
+		if err := n.sub.Drain(); err != nil && !errors.Is(err, nats.ErrBadSubscription) {
+			return err
+		}
+
+		// Drain returns right away and the subscription is closed once pending messages are handled
+		if err := waitFor(ctx, func() bool { return !n.sub.IsValid() }); err != nil {
+			return err
+		}
 	}
 
-	n.resolve()
+	n.init()
+	n.stop()
+
+	done := make(chan struct{})
+	go func() {
+		n.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// init sets up the context that is cancelled when the resolver shuts down
+func (n *NATSClient) init() {
+	n.stopOnce.Do(func() {
+		n.stopCtx, n.stop = context.WithCancel(context.Background())
+	})
 }
 
-func (n *NATSClient) resolve() {
-	subject := fmt.Sprintf("%s.graphql", strings.TrimSuffix(n.Subject, ".>"))
+// graphqlSubject is the subject the resolver listens on
+func (n *NATSClient) graphqlSubject() string {
+	return fmt.Sprintf("%s.graphql", strings.TrimSuffix(n.Subject, ".>"))
+}
+
+func (n *NATSClient) resolve() error {
+	subject := n.graphqlSubject()
 	logr.Infof("listening for requests on %s", subject)
 
-	_, err := n.Conn.Subscribe(subject, n.HandleAndLogRequests)
+	sub, err := n.Conn.QueueSubscribe(subject, n.queueGroup, n.HandleAndLogRequests)
 	if err != nil {
-		logr.Errorf("Error in subscribing: %s", err)
+		return fmt.Errorf("error subscribing to %s: %w", subject, err)
+	}
+
+	n.sub = sub
+	return nil
+}
+
+type headersKey struct{}
+
+// HeadersFromContext returns the headers of the request the resolver is handling, such as Authorization
+func HeadersFromContext(ctx context.Context) (nats.Header, bool) {
+	h, ok := ctx.Value(headersKey{}).(nats.Header)
+	return h, ok
+}
+
+// requestContext returns a context with the request headers, trace context, and correlation ID
+func requestContext(m *nats.Msg) context.Context {
+	ctx := HeaderContext(context.Background(), m.Header)
+	if m.Header != nil {
+		ctx = context.WithValue(ctx, headersKey{}, m.Header)
+	}
+
+	return ctx
+}
+
+// withRequestTimeout bounds the context by the X-Timeout header
+func withRequestTimeout(ctx context.Context, h nats.Header) (context.Context, context.CancelFunc) {
+	if d, err := time.ParseDuration(h.Get(TimeoutHeader)); err == nil && d > 0 {
+		return context.WithTimeout(ctx, d)
 	}
+
+	return context.WithCancel(ctx)
 }
 
 func (n *NATSClient) HandleAndLogRequests(m *nats.Msg) {
-	ctx := context.Background()
+	n.inflight.Add(1)
+	defer n.inflight.Done()
+
+	ctx := requestContext(m)
 
 	defer func() {
 		if err := recover(); err != nil {
-			err := n.Exec.PresentRecoveredError(ctx, err)
-			gqlErr, _ := err.(*gqlerror.Error)
-			resp := &graphql.Response{Errors: []*gqlerror.Error{gqlErr}}
-			natsResponse(resp)
+			gqlErr, ok := n.Exec.PresentRecoveredError(ctx, err).(*gqlerror.Error)
+			if !ok {
+				gqlErr = gqlerror.Errorf("internal system error")
+			}
+			n.respond(m, natsResponse(&graphql.Response{Errors: gqlerror.List{gqlErr}}))
 		}
 	}()
 
@@ -153,22 +291,40 @@ func (n *NATSClient) HandleAndLogRequests(m *nats.Msg) {
 			string(m.Data),
 		)
 		resp := n.Exec.DispatchError(ctx, gqlerror.List{gqlErr})
-		if err := m.RespondMsg(natsResponse(resp)); err != nil {
-			logr.Errorf("error sending message: %s", err)
-		}
+		n.respond(m, natsResponse(resp))
 		return
 	}
 
 	rc, Operr := n.Exec.CreateOperationContext(ctx, params)
 	if Operr != nil {
 		resp := n.Exec.DispatchError(graphql.WithOperationContext(ctx, rc), Operr)
-		m.RespondMsg(natsResponse(resp))
+		n.respond(m, natsResponse(resp))
 		return
 	}
 
+	if rc.Operation != nil && rc.Operation.Operation == ast.Subscription {
+		// subscriptions stream until the client cancels so they can't block the subscription callback. They
+		// end when the resolver shuts down.
+		n.init()
+		subCtx, cancel := context.WithCancel(ctx)
+		stop := context.AfterFunc(n.stopCtx, cancel)
+
+		n.inflight.Add(1)
+		go func() {
+			defer n.inflight.Done()
+			defer stop()
+			defer cancel()
+			n.subscribe(subCtx, m, rc)
+		}()
+		return
+	}
+
+	ctx, cancel := withRequestTimeout(ctx, m.Header)
+	defer cancel()
+
 	var responses graphql.ResponseHandler
 	responses, ctx = n.Exec.DispatchOperation(ctx, rc)
-	m.RespondMsg(natsResponse(responses(ctx)))
+	n.respond(m, natsResponse(responses(ctx)))
 }
 
 func jsonDecode(r io.Reader, val interface{}) error {
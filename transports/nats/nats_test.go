@@ -0,0 +1,132 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestResolveWithoutSchema(t *testing.T) {
+	errChan := make(chan error, 1)
+	NewNATSClient("prime.services.products.>", nil).Resolve(errChan)
+
+	select {
+	case err := <-errChan:
+		if err.Error() != "executable schema must be set" {
+			t.Errorf("expected schema error but got %v", err)
+		}
+	default:
+		t.Error("expected an error")
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	tt := []struct {
+		name        string
+		headers     nats.Header
+		deadline    bool
+		correlation string
+	}{
+		{name: "no headers"},
+		{
+			name: "timeout",
+			headers: nats.Header{
+				TimeoutHeader:       []string{"5s"},
+				CorrelationIDHeader: []string{"abc"},
+				"Authorization":     []string{"Bearer token"},
+			},
+			deadline:    true,
+			correlation: "abc",
+		},
+		{
+			name:    "invalid timeout",
+			headers: nats.Header{TimeoutHeader: []string{"soon"}},
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			ctx, cancel := withRequestTimeout(requestContext(&nats.Msg{Header: v.headers}), v.headers)
+			defer cancel()
+
+			deadline, ok := ctx.Deadline()
+			if ok != v.deadline {
+				t.Fatalf("expected deadline %t but got %t", v.deadline, ok)
+			}
+			if ok && time.Until(deadline) > 5*time.Second {
+				t.Errorf("expected deadline within 5s but got %s", time.Until(deadline))
+			}
+
+			id, _ := CorrelationIDFromContext(ctx)
+			if id != v.correlation {
+				t.Errorf("expected correlation ID %q but got %q", v.correlation, id)
+			}
+
+			headers, ok := HeadersFromContext(ctx)
+			if ok != (v.headers != nil) {
+				t.Fatalf("expected headers %t but got %t", v.headers != nil, ok)
+			}
+			if headers.Get("Authorization") != v.headers.Get("Authorization") {
+				t.Errorf("expected authorization %q but got %q", v.headers.Get("Authorization"), headers.Get("Authorization"))
+			}
+		})
+	}
+}
+
+func TestShutdownWithoutResolver(t *testing.T) {
+	n := NewNATSClient("prime.services.products.>", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := n.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if n.stopCtx.Err() == nil {
+		t.Error("expected subscriptions to be stopped")
+	}
+}
+
+func TestQueryCache(t *testing.T) {
+	ctx := context.Background()
+	cache := NewQueryCache(2)
+
+	cache.Add(ctx, "a", 1)
+	cache.Add(ctx, "b", 2)
+	cache.Get(ctx, "a")
+	cache.Add(ctx, "c", 3)
+
+	tt := []struct {
+		key   string
+		found bool
+	}{
+		{key: "a", found: true},
+		{key: "b", found: false},
+		{key: "c", found: true},
+	}
+
+	for _, v := range tt {
+		t.Run(v.key, func(t *testing.T) {
+			if _, ok := cache.Get(ctx, v.key); ok != v.found {
+				t.Errorf("expected found %t but got %t", v.found, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	cwerrors "github.com/CoverWhale/coverwhale-go/errors"
+	"github.com/CoverWhale/coverwhale-go/transports/correlation"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	RequestIDHeader     = "X-Request-ID"
+	CorrelationIDHeader = correlation.Header
+)
+
+// WithCorrelationID adds a correlation ID to the context. RequestClient sends it in the X-Correlation-Id header.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return correlation.WithID(ctx, id)
+}
+
+// CorrelationIDFromContext returns the correlation ID added by WithCorrelationID or HeaderContext
+func CorrelationIDFromContext(ctx context.Context) (string, bool) {
+	return correlation.FromContext(ctx)
+}
+
+// HeaderContext returns a context with the trace context and correlation ID from request headers, so a
+// handler can pass them on to the requests it makes
+func HeaderContext(ctx context.Context, headers map[string][]string) context.Context {
+	return correlation.Extract(ctx, headers)
+}
+
+// RequestClient sends typed requests to micro service endpoints
+type RequestClient struct {
+	conn       *nats.Conn
+	timeout    time.Duration
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	// retryTimeouts retries requests that timed out, which may have already been handled
+	retryTimeouts bool
+}
+
+// RequestClientOpt is a functional option to modify the request client
+type RequestClientOpt func(*RequestClient)
+
+// NewRequestClient returns a client with a 5s timeout that retries no responders twice, waiting 100ms and then
+// 200ms
+func NewRequestClient(nc *nats.Conn, opts ...RequestClientOpt) *RequestClient {
+	c := &RequestClient{
+		conn:       nc,
+		timeout:    5 * time.Second,
+		retries:    2,
+		backoff:    100 * time.Millisecond,
+		maxBackoff: 2 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// SetRequestTimeout sets how long each attempt waits for a reply
+func SetRequestTimeout(d time.Duration) RequestClientOpt {
+	return func(c *RequestClient) {
+		c.timeout = d
+	}
+}
+
+// SetRetries sets how many times a request is retried after no responders, or a timeout with SetRetryTimeouts
+func SetRetries(n int) RequestClientOpt {
+	return func(c *RequestClient) {
+		c.retries = n
+	}
+}
+
+// SetRetryTimeouts also retries requests that time out. A timed out request may still have been handled, so
+// only use this for idempotent endpoints or services that dedupe retries by the X-Request-ID header, which is
+// the same for every attempt.
+func SetRetryTimeouts() RequestClientOpt {
+	return func(c *RequestClient) {
+		c.retryTimeouts = true
+	}
+}
+
+// SetRetryBackoff sets the wait before the first retry, which doubles for each retry up to max
+func SetRetryBackoff(initial, max time.Duration) RequestClientOpt {
+	return func(c *RequestClient) {
+		c.backoff = initial
+		c.maxBackoff = max
+	}
+}
+
+// RequestOpt is a functional option for a single request
+type RequestOpt func(*requestOptions)
+
+type requestOptions struct {
+	tokens  []string
+	headers nats.Header
+}
+
+// WithSubjectTokens fills subject wildcards other than the request ID, as in RequestSubject
+func WithSubjectTokens(tokens ...string) RequestOpt {
+	return func(o *requestOptions) {
+		o.tokens = append(o.tokens, tokens...)
+	}
+}
+
+// WithRequestHeader adds a header to the request
+func WithRequestHeader(key, value string) RequestOpt {
+	return func(o *requestOptions) {
+		o.headers.Add(key, value)
+	}
+}
+
+// Request sends req as JSON to an endpoint subject such as prime.services.example.*.math.add.get and decodes
+// the reply into Resp. The request ID wildcard gets a new KSUID, which is also sent in the X-Request-ID header
+// along with the trace context and correlation ID from ctx. Error replies are returned as errors.ClientError
+// values with the reply headers, such as Retry-After, in Headers. No responders are retried with backoff. Timeouts
+// are only retried with SetRetryTimeouts since the service may have handled the request; every attempt uses the
+// same request ID so services can dedupe them.
+func Request[Req, Resp any](ctx context.Context, c *RequestClient, subject string, req Req, opts ...RequestOpt) (Resp, error) {
+	var resp Resp
+
+	o := requestOptions{headers: nats.Header{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	id := ksuid.New().String()
+	subject, err := requestSubject(subject, id, o.tokens...)
+	if err != nil {
+		return resp, err
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return resp, fmt.Errorf("error encoding request: %w", err)
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	for k, v := range o.headers {
+		msg.Header[k] = v
+	}
+	msg.Header.Set(RequestIDHeader, id)
+	correlation.Inject(ctx, msg.Header)
+
+	reply, err := c.request(ctx, msg)
+	if err != nil {
+		return resp, err
+	}
+
+	return decodeReply[Resp](reply)
+}
+
+// request sends the message, retrying when nothing responds in time
+func (c *RequestClient) request(ctx context.Context, msg *nats.Msg) (*nats.Msg, error) {
+	backoff := c.backoff
+
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		reply, err := c.conn.RequestMsgWithContext(attemptCtx, msg)
+		cancel()
+
+		if err == nil {
+			return reply, nil
+		}
+
+		// the caller's context ending is never retried
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if !c.retryable(err) || attempt >= c.retries {
+			return nil, fmt.Errorf("error sending request on %s: %w", msg.Subject, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if c.maxBackoff > 0 && backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+	}
+}
+
+// retryable reports whether a request can be sent again. Nothing received a request with no responders, but a
+// request that timed out may have been handled.
+func (c *RequestClient) retryable(err error) bool {
+	if errors.Is(err, nats.ErrNoResponders) {
+		return true
+	}
+
+	return c.retryTimeouts && (errors.Is(err, nats.ErrTimeout) || errors.Is(err, context.DeadlineExceeded))
+}
+
+// decodeReply decodes a reply into Resp or returns the client error from an error reply. The reply headers,
+// other than the error headers, are copied to the client error so they can be passed on.
+func decodeReply[Resp any](reply *nats.Msg) (Resp, error) {
+	var resp Resp
+
+	if code := reply.Header.Get(micro.ErrorCodeHeader); code != "" {
+		status, err := strconv.Atoi(code)
+		if err != nil {
+			status = http.StatusInternalServerError
+		}
+
+		headers := make(map[string]string)
+		for k := range reply.Header {
+			if k != micro.ErrorCodeHeader && k != micro.ErrorHeader {
+				headers[k] = reply.Header.Get(k)
+			}
+		}
+
+		ce, err := cwerrors.ParseClientError(status, reply.Data)
+		if err != nil {
+			description := reply.Header.Get(micro.ErrorHeader)
+			if description == "" {
+				description = http.StatusText(status)
+			}
+			ce = cwerrors.NewClientError(fmt.Errorf("%s", description), status)
+		}
+
+		if len(headers) > 0 {
+			cwerrors.WithHeaders(headers)(&ce)
+		}
+
+		return resp, ce
+	}
+
+	if err := json.Unmarshal(reply.Data, &resp); err != nil {
+		return resp, fmt.Errorf("error decoding reply: %w", err)
+	}
+
+	return resp, nil
+}
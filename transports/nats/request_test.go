@@ -0,0 +1,146 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	cwerrors "github.com/CoverWhale/coverwhale-go/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type testReply struct {
+	Result int `json:"result"`
+}
+
+func TestDecodeReply(t *testing.T) {
+	tt := []struct {
+		name     string
+		data     string
+		headers  map[string]string
+		expected int
+		status   int
+		code     string
+		response map[string]string
+	}{
+		{name: "reply", data: `{"result": 3}`, expected: 3},
+		{
+			name:     "client error",
+			data:     string(cwerrors.RateLimited(0).Body()),
+			headers:  map[string]string{micro.ErrorCodeHeader: "429", micro.ErrorHeader: "Too Many Requests", "Retry-After": "5"},
+			status:   http.StatusTooManyRequests,
+			code:     "CWRATE1",
+			response: map[string]string{"Retry-After": "5"},
+		},
+		{
+			name:    "error without envelope",
+			data:    "boom",
+			headers: map[string]string{micro.ErrorCodeHeader: "500", micro.ErrorHeader: "internal server error"},
+			status:  http.StatusInternalServerError,
+			code:    "CWGEN1",
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			msg := nats.NewMsg("reply")
+			msg.Data = []byte(v.data)
+			for k, val := range v.headers {
+				msg.Header.Set(k, val)
+			}
+
+			resp, err := decodeReply[testReply](msg)
+			if v.status == 0 {
+				if err != nil || resp.Result != v.expected {
+					t.Fatalf("expected result %d but got %d, %v", v.expected, resp.Result, err)
+				}
+				return
+			}
+
+			var ce cwerrors.ClientError
+			if !errors.As(err, &ce) {
+				t.Fatalf("expected a client error but got %v", err)
+			}
+			if ce.Status != v.status || ce.ErrorsWithMetadata[0].Code != v.code {
+				t.Errorf("expected status %d and code %s but got %+v", v.status, v.code, ce)
+			}
+			if len(ce.ResponseHeaders()) != len(v.response) {
+				t.Errorf("expected headers %v but got %v", v.response, ce.ResponseHeaders())
+			}
+			for k, val := range v.response {
+				if ce.ResponseHeaders()[k] != val {
+					t.Errorf("expected header %s to be %q but got %q", k, val, ce.ResponseHeaders()[k])
+				}
+			}
+		})
+	}
+}
+
+func TestRequestRetryable(t *testing.T) {
+	tt := []struct {
+		name      string
+		opts      []RequestClientOpt
+		err       error
+		retryable bool
+	}{
+		{name: "no responders", err: nats.ErrNoResponders, retryable: true},
+		{name: "timeout", err: nats.ErrTimeout},
+		{name: "deadline", err: context.DeadlineExceeded},
+		{name: "retry timeout", opts: []RequestClientOpt{SetRetryTimeouts()}, err: nats.ErrTimeout, retryable: true},
+		{name: "retry deadline", opts: []RequestClientOpt{SetRetryTimeouts()}, err: context.DeadlineExceeded, retryable: true},
+		{name: "other error", opts: []RequestClientOpt{SetRetryTimeouts()}, err: nats.ErrConnectionClosed},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			c := NewRequestClient(nil, v.opts...)
+			if c.retryable(v.err) != v.retryable {
+				t.Errorf("expected retryable to be %t", v.retryable)
+			}
+		})
+	}
+}
+
+func TestHeaderContext(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(prev)
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled})
+
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+	ctx = WithCorrelationID(ctx, "abc")
+
+	headers := nats.Header{}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(headers))
+	headers.Set(CorrelationIDHeader, "abc")
+
+	got := HeaderContext(context.Background(), headers)
+	if id, _ := CorrelationIDFromContext(got); id != "abc" {
+		t.Errorf("expected correlation ID abc but got %q", id)
+	}
+	if trace.SpanContextFromContext(got).TraceID() != traceID {
+		t.Errorf("expected trace ID %s but got %s", traceID, trace.SpanContextFromContext(got).TraceID())
+	}
+}
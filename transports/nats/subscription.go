@@ -0,0 +1,147 @@
+// Copyright 2023 Cover Whale Insurance Solutions Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/CoverWhale/logr"
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/ksuid"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const (
+	// GraphQLEventHeader is the type of a subscription message: next, complete, or stream
+	GraphQLEventHeader = "Graphql-Event"
+	// GraphQLControlHeader is the subject the client publishes keepalives and complete to
+	GraphQLControlHeader = "Graphql-Control-Subject"
+	// GraphQLStreamHeader is the JetStream subject events are published to when a subscription stream is set
+	GraphQLStreamHeader = "Graphql-Stream-Subject"
+
+	GraphQLEventNext     = "next"
+	GraphQLEventComplete = "complete"
+	GraphQLEventStream   = "stream"
+
+	DefaultSubscriptionIdle = time.Minute
+)
+
+// SetSubscriptionStream publishes subscription events with JetStream to <prefix>.<subscription id> instead
+// of the reply inbox, so a client can resume from the stream after a disconnect. A stream must capture
+// <prefix>.>.
+func SetSubscriptionStream(prefix string) ClientOpt {
+	return func(n *NATSClient) {
+		n.NATSGraph.subscriptionStream = prefix
+	}
+}
+
+// SetSubscriptionIdleTimeout ends subscriptions when the client hasn't published to the control subject for
+// the duration. Clients should send a keepalive more often than this.
+func SetSubscriptionIdleTimeout(d time.Duration) ClientOpt {
+	return func(n *NATSClient) {
+		n.NATSGraph.subscriptionIdle = d
+	}
+}
+
+// subscribe streams the responses of a subscription operation until the resolver ends it, the client
+// publishes complete to the control subject, or the client stops sending keepalives
+func (n *NATSClient) subscribe(ctx context.Context, m *nats.Msg, rc *graphql.OperationContext) {
+	if m.Reply == "" {
+		logr.Errorf("subscription on %s has no reply subject", m.Subject)
+		return
+	}
+
+	id := ksuid.New().String()
+	control := fmt.Sprintf("%s.control.%s", n.graphqlSubject(), id)
+
+	idle := n.subscriptionIdle
+	if idle == 0 {
+		idle = DefaultSubscriptionIdle
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	timer := time.AfterFunc(idle, cancel)
+	defer timer.Stop()
+
+	sub, err := n.Conn.Subscribe(control, func(msg *nats.Msg) {
+		if string(msg.Data) == GraphQLEventComplete {
+			cancel()
+			return
+		}
+		timer.Reset(idle)
+	})
+	if err != nil {
+		logr.Errorf("error subscribing to %s: %v", control, err)
+		n.respond(m, natsResponse(n.Exec.DispatchError(ctx, gqlerror.List{gqlerror.Errorf("error starting subscription")})))
+		return
+	}
+	defer sub.Unsubscribe()
+
+	deliver := m.Reply
+	publish := n.Conn.PublishMsg
+	if n.subscriptionStream != "" {
+		deliver = fmt.Sprintf("%s.%s", n.subscriptionStream, id)
+		publish = func(msg *nats.Msg) error {
+			_, err := n.JS.PublishMsg(msg)
+			return err
+		}
+
+		// the first reply tells the client where to read events from
+		start := subscriptionMsg(m.Reply, GraphQLEventStream, control, nil)
+		start.Header.Set(GraphQLStreamHeader, deliver)
+		if err := n.Conn.PublishMsg(start); err != nil {
+			logr.Errorf("error starting subscription %s: %v", id, err)
+			return
+		}
+	}
+
+	responses, ctx := n.Exec.DispatchOperation(ctx, rc)
+	for {
+		resp := responses(ctx)
+		if resp == nil {
+			break
+		}
+
+		if err := publish(subscriptionMsg(deliver, GraphQLEventNext, control, natsResponse(resp).Data)); err != nil {
+			logr.Errorf("error publishing subscription %s event: %v", id, err)
+			return
+		}
+	}
+
+	if err := publish(subscriptionMsg(deliver, GraphQLEventComplete, control, nil)); err != nil {
+		logr.Errorf("error completing subscription %s: %v", id, err)
+	}
+}
+
+func subscriptionMsg(subject, event, control string, data []byte) *nats.Msg {
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	msg.Header.Set(GraphQLEventHeader, event)
+	msg.Header.Set(GraphQLControlHeader, control)
+
+	return msg
+}
+
+// respond sends a reply and logs when it fails
+func (n *NATSClient) respond(m *nats.Msg, reply *nats.Msg) {
+	if err := m.RespondMsg(reply); err != nil {
+		logr.Errorf("error sending message: %v", err)
+	}
+}